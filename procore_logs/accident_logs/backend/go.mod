@@ -2,9 +2,18 @@ module procore-accident-logs
 
 go 1.24.2
 
+require github.com/joho/godotenv v1.5.1
+
 require (
-	github.com/gin-gonic/gin v1.9.1
-	github.com/joho/godotenv v1.5.1
+	github.com/gin-gonic/gin v1.9.1 // indirect
+	github.com/go-pdf/fpdf v0.9.0 // indirect
+	github.com/richardlehane/mscfb v1.0.4 // indirect
+	github.com/richardlehane/msoleps v1.0.4 // indirect
+	github.com/tiendc/go-deepcopy v1.6.0 // indirect
+	github.com/xuri/efp v0.0.1 // indirect
+	github.com/xuri/excelize/v2 v2.9.1 // indirect
+	github.com/xuri/nfp v0.0.1 // indirect
+	go.etcd.io/bbolt v1.4.3 // indirect
 )
 
 require (
@@ -26,10 +35,13 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.11 // indirect
 	golang.org/x/arch v0.3.0 // indirect
-	golang.org/x/crypto v0.9.0 // indirect
-	golang.org/x/net v0.10.0 // indirect
-	golang.org/x/sys v0.8.0 // indirect
-	golang.org/x/text v0.9.0 // indirect
+	golang.org/x/crypto v0.38.0 // indirect
+	golang.org/x/net v0.40.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.25.0 // indirect
 	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
+	procore-common v0.0.0
 )
+
+replace procore-common => ../../common
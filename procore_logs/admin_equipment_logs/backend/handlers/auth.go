@@ -1,80 +0,0 @@
-package handlers
-
-// import (
-// 	"encoding/json"
-// 	"io"
-// 	"net/http"
-// 	"net/url"
-// 	"os"
-// 	"strings"
-
-// 	"github.com/gin-gonic/gin"
-// )
-
-// type TokenResponse struct {
-// 	AccessToken  string `json:"access_token"`
-// 	TokenType    string `json:"token_type"`
-// 	ExpiresIn    int    `json:"expires_in"`
-// 	RefreshToken string `json:"refresh_token"`
-// 	Scope        string `json:"scope"`
-// 	CreatedAt    int    `json:"created_at"`
-// 	ExpiresAt    int    `json:"expires_at"`
-// }
-
-// func GetAuthToken(c *gin.Context) {
-// 	// Parse request body
-// 	var request struct {
-// 		Code string `json:"code"`
-// 	}
-
-// 	if err := c.ShouldBindJSON(&request); err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-// 		return
-// 	}
-
-// 	code := request.Code
-// 	if code == "" {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization code is required"})
-// 		return
-// 	}
-
-// 	// Prepare form data
-// 	formData := url.Values{}
-// 	formData.Set("grant_type", "authorization_code")
-// 	formData.Set("code", code)
-// 	formData.Set("client_id", os.Getenv("PROCORE_CLIENT_ID"))
-// 	formData.Set("client_secret", os.Getenv("PROCORE_CLIENT_SECRET"))
-// 	formData.Set("redirect_uri", "urn:ietf:wg:oauth:2.0:oob")
-
-// 	// Create and send request to Procore
-// 	req, err := http.NewRequest("POST", "https://login-sandbox.procore.com/oauth/token", strings.NewReader(formData.Encode()))
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 		return
-// 	}
-
-// 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-// 	client := &http.Client{}
-// 	resp, err := client.Do(req)
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 		return
-// 	}
-// 	defer resp.Body.Close()
-
-// 	// Handle response
-// 	if resp.StatusCode != http.StatusOK {
-// 		body, _ := io.ReadAll(resp.Body)
-// 		c.JSON(resp.StatusCode, gin.H{"error": string(body)})
-// 		return
-// 	}
-
-// 	var tokenResponse TokenResponse
-// 	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-// 		return
-// 	}
-
-// 	c.JSON(http.StatusOK, gin.H{"access_token": tokenResponse.AccessToken})
-// }
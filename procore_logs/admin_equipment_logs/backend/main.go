@@ -1,13 +1,11 @@
 package main
 
 import (
-	"equipment_logs/handlers"
 	"log"
-	"os"
 
-	// "procore-equipment_logs/handlers"
+	"procore-common/logs"
+	"procore-common/server"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
@@ -18,41 +16,18 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
-	// Initialize Gin router
-	router := gin.Default()
-	frontendURL := os.Getenv("FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "http://localhost:3001"
+	procoreCfg, err := logs.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Configure CORS
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", frontendURL)
-
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
-
-	// Routes
-	router.POST("/api/auth/token", handlers.GetAuthToken)
-	router.GET("/api/equipment_logs", handlers.GetEquipmentLogs)
-	router.GET("/api/equipment_logs/filter", handlers.GetFilteredEquipmentLogs)
-	router.POST("/api/equipment_logs", handlers.CreateEquipmentLogs)
-	router.PUT("/api/equipment_logs/:id", handlers.UpdateEquipmentLogs)
-	router.DELETE("/api/equipment_logs/:id", handlers.DeleteEquipmentLogs)
-	router.GET("/api/equipment_logs/:id", handlers.GetEquipmentLogsDetails)
+	cfg := server.LoadConfig("8081", "http://localhost:3001")
+	svc, err := logs.NewService(procoreCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	router := server.New(cfg, svc, logs.EquipmentLogs)
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
-	}
-	router.Run(":" + port)
+	log.Fatal(server.Run(router, cfg))
 }
@@ -0,0 +1,104 @@
+package logs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// accessCheckInterval is how long a caller's access to a project is
+	// trusted before Procore is asked again.
+	accessCheckInterval = 5 * time.Minute
+	// accessMemory is how long it is trusted while Procore is unreachable.
+	accessMemory = 24 * time.Hour
+)
+
+// accessCache remembers when a token was last seen to reach a project.
+type accessCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// projectClient is newClient for routes serving local data, which also
+// checks the caller's access to the project with authorize.
+func (s *Service) projectClient(c *gin.Context) (*procore.Client, bool) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return nil, false
+	}
+	if err := s.authorize(c.Request.Context(), client); err != nil {
+		listError(c, err)
+		return nil, false
+	}
+	return client, true
+}
+
+// authorize checks that the caller's token can reach the client's project
+// before local data (the mirror, the outbox) is shown to it, since that
+// data is shared by every caller and Procore is not asked for it.
+func (s *Service) authorize(ctx context.Context, client *procore.Client) error {
+	token, err := client.Tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	verified, ok := s.access.verified(token, client.CompanyID, client.ProjectID)
+	if ok && time.Since(verified) <= accessCheckInterval {
+		return nil
+	}
+
+	projects, err := client.Projects(ctx)
+	if err != nil {
+		if ok && time.Since(verified) <= accessMemory && offline(err) {
+			return nil
+		}
+		return err
+	}
+	s.access.grant(token, client.CompanyID, projects)
+	for _, p := range projects {
+		if strconv.Itoa(p.ID) == client.ProjectID {
+			return nil
+		}
+	}
+	return &procore.APIError{StatusCode: http.StatusForbidden, Body: "project " + client.ProjectID + " is not accessible"}
+}
+
+func accessKey(token, companyID, projectID string) string {
+	sum := sha256.Sum256([]byte(token + "\x00" + companyID + "\x00" + projectID))
+	return hex.EncodeToString(sum[:])
+}
+
+// verified returns when token was last seen to reach a project.
+func (a *accessCache) verified(token, companyID, projectID string) (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	at, ok := a.seen[accessKey(token, companyID, projectID)]
+	return at, ok
+}
+
+// grant records that token reaches projects of the company, as a project
+// list Procore returned for it shows.
+func (a *accessCache) grant(token, companyID string, projects []procore.Project) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.seen == nil {
+		a.seen = map[string]time.Time{}
+	}
+	for other, at := range a.seen {
+		if time.Since(at) > accessMemory {
+			delete(a.seen, other)
+		}
+	}
+	now := time.Now()
+	for _, p := range projects {
+		a.seen[accessKey(token, companyID, strconv.Itoa(p.ID))] = now
+	}
+}
@@ -0,0 +1,370 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccidentType is one entry of the accident type taxonomy.
+type AccidentType struct {
+	// Code is what logs store and the API accepts, e.g. "struck_by".
+	Code  string `json:"code"`
+	Label string `json:"label"`
+	// Aliases are other names that resolve to the type, such as the free
+	// text of legacy [Type: ...] comments.
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// Taxonomy is the list of types accident logs are typed against.
+type Taxonomy []AccidentType
+
+// DefaultAccidentTypes is the taxonomy used unless ACCIDENT_TYPES_FILE
+// replaces it.
+var DefaultAccidentTypes = Taxonomy{
+	{Code: "slip_trip_fall", Label: "Slip, trip or fall", Aliases: []string{"slip", "trip", "fall", "slip/trip/fall"}},
+	{Code: "fall_from_height", Label: "Fall from height", Aliases: []string{"ladder", "scaffold", "roof"}},
+	{Code: "struck_by", Label: "Struck by", Aliases: []string{"struck", "falling object"}},
+	{Code: "caught_between", Label: "Caught in or between", Aliases: []string{"caught", "caught in", "pinch"}},
+	{Code: "electrical", Label: "Electrical", Aliases: []string{"electrocution", "shock"}},
+	{Code: "cut_laceration", Label: "Cut or laceration", Aliases: []string{"cut", "laceration"}},
+	{Code: "overexertion", Label: "Overexertion or strain", Aliases: []string{"strain", "sprain", "lifting"}},
+	{Code: "burn", Label: "Burn", Aliases: []string{"fire", "hot work"}},
+	{Code: "vehicle_equipment", Label: "Vehicle or equipment", Aliases: []string{"vehicle", "equipment"}},
+	{Code: "exposure", Label: "Exposure to harmful substance", Aliases: []string{"chemical", "inhalation", "dust"}},
+	{Code: "other", Label: "Other"},
+}
+
+// LoadAccidentTypes reads a taxonomy from a JSON file holding an array of
+// {"code", "label", "aliases"} objects.
+func LoadAccidentTypes(path string) (Taxonomy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read accident types: %w", err)
+	}
+	var types Taxonomy
+	if err := json.Unmarshal(data, &types); err != nil {
+		return nil, fmt.Errorf("failed to parse accident types %s: %w", path, err)
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("accident types %s: no types defined", path)
+	}
+	seen := map[string]bool{}
+	for _, t := range types {
+		if t.Code == "" || seen[typeKey(t.Code)] {
+			return nil, fmt.Errorf("accident types %s: codes must be set and unique (%q)", path, t.Code)
+		}
+		seen[typeKey(t.Code)] = true
+	}
+	return types, nil
+}
+
+// typeMarkerPattern finds the type marker of a log's comments: the current
+// [AccidentType: code] and the legacy free-text [Type: ...].
+var typeMarkerPattern = regexp.MustCompile(`(?i)\s*\[(?:AccidentType|Type):\s*([^\]]*)\]\s*`)
+
+var typeKeyPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// typeKey normalizes a code, label or alias for comparison, so "Struck-by"
+// matches struck_by.
+func typeKey(value string) string {
+	return strings.Trim(typeKeyPattern.ReplaceAllString(strings.ToLower(value), "_"), "_")
+}
+
+// lookup finds the type a code, label or alias names.
+func (types Taxonomy) lookup(value string) (AccidentType, bool) {
+	key := typeKey(value)
+	if key == "" {
+		return AccidentType{}, false
+	}
+	for _, t := range types {
+		if typeKey(t.Code) == key || typeKey(t.Label) == key {
+			return t, true
+		}
+		for _, alias := range t.Aliases {
+			if typeKey(alias) == key {
+				return t, true
+			}
+		}
+	}
+	return AccidentType{}, false
+}
+
+// resolve returns the code value names, or value itself when it is not in
+// the taxonomy.
+func (types Taxonomy) resolve(value string) string {
+	if t, ok := types.lookup(value); ok {
+		return t.Code
+	}
+	return strings.TrimSpace(value)
+}
+
+// label returns the label of a code, or the code itself when it is not in
+// the taxonomy.
+func (types Taxonomy) label(code string) string {
+	for _, t := range types {
+		if t.Code == code {
+			return t.Label
+		}
+	}
+	return code
+}
+
+// splitType returns the value of the first type marker in comments and the
+// comments without any markers.
+func splitType(comments string) (value, rest string) {
+	if matches := typeMarkerPattern.FindStringSubmatch(comments); len(matches) > 1 {
+		value = strings.TrimSpace(matches[1])
+	}
+	return value, strings.TrimSpace(typeMarkerPattern.ReplaceAllString(comments, " "))
+}
+
+// codes lists the codes of the taxonomy.
+func (types Taxonomy) codes() []string {
+	codes := make([]string, len(types))
+	for i, t := range types {
+		codes[i] = t.Code
+	}
+	return codes
+}
+
+// encode puts the type a value names at the start of comments as an
+// [AccidentType: code] marker; an empty value leaves the comments untyped.
+func (types Taxonomy) encode(value, comments string) string {
+	code := types.resolve(value)
+	if code == "" {
+		return comments
+	}
+	marker := "[AccidentType: " + code + "]"
+	if comments == "" {
+		return marker
+	}
+	return marker + " " + comments
+}
+
+// extract reads the type of a log from its comments, as a code when the
+// taxonomy knows it and as written otherwise.
+func (types Taxonomy) extract(comments string) string {
+	value, _ := splitType(comments)
+	return types.resolve(value)
+}
+
+// encodeLog moves the type of a new log into its comments, normalizing a
+// marker the comments already carry.
+func (s *Service) encodeLog(r *Resource, log *procore.Log) {
+	if !r.Typed {
+		return
+	}
+	value, rest := splitType(log.Comments)
+	if log.Type != "" {
+		value = log.Type
+	}
+	if value == "" {
+		return
+	}
+	types := s.Config.AccidentTypes
+	log.Comments = types.encode(value, rest)
+	log.Type = types.resolve(value)
+}
+
+// encodePatch is encodeLog for an update. Changing only the type or only
+// the comments needs the other half, so the current log is fetched.
+func (s *Service) encodePatch(ctx context.Context, r *Resource, client *procore.Client, id string, patch *procore.LogPatch) error {
+	if !r.Typed || (!patch.Type.Set && !patch.Comments.Set) {
+		return nil
+	}
+
+	var value, rest string
+	if patch.Comments.Set {
+		value, rest = splitType(patch.Comments.Value)
+	}
+	if patch.Type.Set {
+		value = patch.Type.Value
+	}
+	if !patch.Comments.Set || (!patch.Type.Set && value == "") {
+		resp, err := r.LogResource.Get(ctx, client, id)
+		if err != nil {
+			return err
+		}
+		var current procore.Log
+		if err := procore.DecodeResponse(resp, &current); err != nil {
+			return err
+		}
+		currentValue, currentRest := splitType(current.Comments)
+		if !patch.Comments.Set {
+			rest = currentRest
+		}
+		if !patch.Type.Set {
+			value = currentValue
+		}
+	}
+
+	types := s.Config.AccidentTypes
+	patch.Comments = procore.Value(types.encode(value, rest))
+	patch.Type = procore.Value(types.resolve(value))
+	return nil
+}
+
+type AccidentTypeResponse struct {
+	AccidentLogID int    `json:"accident_log_id"`
+	Type          string `json:"type"`
+	AccidentType  string `json:"accident_type"`
+	Date          string `json:"date"`
+	ReportedBy    string `json:"reported_by"`
+	Comments      string `json:"comments"`
+}
+
+// AccidentTypes lists typed accident logs, optionally narrowed to one
+// accident_type, given as a code, label or alias.
+func (s *Service) AccidentTypes(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+
+	accidentType := c.Query("accident_type")
+
+	filters, ok := parseFilters(c)
+	if !ok {
+		return
+	}
+
+	records, ok := fetchLogs[map[string]interface{}](c, s, r, client, filters)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, filterAccidentTypes(s.Config.AccidentTypes, records, accidentType))
+}
+
+func filterAccidentTypes(types Taxonomy, records []map[string]interface{}, accidentType string) []AccidentTypeResponse {
+	want := types.resolve(accidentType)
+	results := make([]AccidentTypeResponse, 0)
+	for _, record := range records {
+		log := recordLog(record)
+		if log.Type != "" && (want == "" || strings.EqualFold(log.Type, want)) {
+			results = append(results, AccidentTypeResponse{
+				AccidentLogID: log.ID,
+				Type:          log.Type,
+				AccidentType:  types.label(log.Type),
+				Date:          log.Date,
+				ReportedBy:    reportedBy(record),
+				Comments:      log.Comments,
+			})
+		}
+	}
+	return results
+}
+
+// reportedBy names the Procore user who created a log.
+func reportedBy(record map[string]interface{}) string {
+	user, _ := record["created_by"].(map[string]interface{})
+	name, _ := user["name"].(string)
+	login, _ := user["login"].(string)
+	return firstNonEmpty(name, login)
+}
+
+// ListAccidentTypes returns the taxonomy.
+func (s *Service) ListAccidentTypes(r *Resource, c *gin.Context) {
+	c.JSON(http.StatusOK, s.Config.AccidentTypes)
+}
+
+// TypeMigration reports one log whose type marker was, or would be,
+// rewritten.
+type TypeMigration struct {
+	ID     int    `json:"id"`
+	From   string `json:"from"`
+	Type   string `json:"type,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type TypeMigrationResponse struct {
+	DryRun   bool            `json:"dry_run"`
+	Scanned  int             `json:"scanned"`
+	Migrated []TypeMigration `json:"migrated"`
+	// Unmapped are typed logs whose type is not in the taxonomy; they are
+	// left as they are.
+	Unmapped []TypeMigration `json:"unmapped"`
+	Failed   int             `json:"failed"`
+}
+
+// MigrateAccidentTypes rewrites the type markers of the logs matching the
+// Filter parameters into the [AccidentType: code] encoding, e.g. legacy
+// "[Type: Slip]" comments become "[AccidentType: slip_trip_fall]". Logs
+// already encoded are skipped and types the taxonomy does not know are
+// reported as unmapped. dry_run=true only reports what would change.
+func (s *Service) MigrateAccidentTypes(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+	filters, ok := parseFilters(c)
+	if !ok {
+		return
+	}
+
+	logs, ok := fetchLogs[procore.Log](c, s, r, client, filters)
+	if !ok {
+		return
+	}
+
+	response := TypeMigrationResponse{
+		DryRun:   c.Query("dry_run") == "true",
+		Migrated: make([]TypeMigration, 0),
+		Unmapped: make([]TypeMigration, 0),
+	}
+	var writes []bulkWrite
+	for _, log := range logs {
+		response.Scanned++
+		value, rest := splitType(log.Comments)
+		if value == "" {
+			continue
+		}
+		t, ok := s.Config.AccidentTypes.lookup(value)
+		if !ok {
+			response.Unmapped = append(response.Unmapped, TypeMigration{ID: log.ID, From: value})
+			continue
+		}
+		comments := s.Config.AccidentTypes.encode(t.Code, rest)
+		if comments == log.Comments {
+			continue
+		}
+		response.Migrated = append(response.Migrated, TypeMigration{ID: log.ID, From: value, Type: t.Code})
+		writes = append(writes, bulkWrite{
+			op:    OpUpdate,
+			id:    fmt.Sprint(log.ID),
+			patch: procore.LogPatch{Comments: procore.Value(comments)},
+		})
+	}
+
+	if response.DryRun || len(writes) == 0 {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	results := make([]BulkResult, len(writes))
+	s.runBulkWrites(c.Request.Context(), r, client, writes, results, defaultBulkConcurrency, false)
+	s.publishResults(r, client, results)
+	for i, result := range results {
+		response.Migrated[i].Status = result.Status
+		if !result.succeeded() {
+			response.Migrated[i].Error = result.Error
+			response.Failed++
+		}
+	}
+
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, response)
+}
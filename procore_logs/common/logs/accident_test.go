@@ -0,0 +1,164 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTaxonomy(t *testing.T) {
+	types := DefaultAccidentTypes
+	tests := []struct {
+		value, code string
+	}{
+		{"slip_trip_fall", "slip_trip_fall"},
+		{"Slip, trip or fall", "slip_trip_fall"},
+		{"SLIP", "slip_trip_fall"},
+		{"Slip/Trip/Fall", "slip_trip_fall"},
+		{"Struck-by", "struck_by"},
+		{"falling object", "struck_by"},
+		{" meteor ", "meteor"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := types.resolve(tt.value); got != tt.code {
+			t.Errorf("resolve(%q) = %q, want %q", tt.value, got, tt.code)
+		}
+	}
+
+	comments := []struct {
+		in, value, rest string
+	}{
+		{"[AccidentType: burn] hot pipe", "burn", "hot pipe"},
+		{"hot pipe [type: Fire]", "Fire", "hot pipe"},
+		{"[Type: Fire] [AccidentType: burn] pipe", "Fire", "pipe"},
+		{"no marker", "", "no marker"},
+	}
+	for _, tt := range comments {
+		if value, rest := splitType(tt.in); value != tt.value || rest != tt.rest {
+			t.Errorf("splitType(%q) = %q, %q; want %q, %q", tt.in, value, rest, tt.value, tt.rest)
+		}
+	}
+	if got := types.encode("Fire", "hot pipe"); got != "[AccidentType: burn] hot pipe" {
+		t.Errorf("encode = %q", got)
+	}
+}
+
+func TestLoadAccidentTypes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0o600)
+		return path
+	}
+
+	types, err := LoadAccidentTypes(write("ok.json", `[{"code":"pinch","label":"Pinch point","aliases":["nip"]}]`))
+	if err != nil || len(types) != 1 || types.resolve("nip") != "pinch" {
+		t.Errorf("LoadAccidentTypes = %+v, %v", types, err)
+	}
+	for name, content := range map[string]string{
+		"empty.json":     `[]`,
+		"invalid.json":   `{"code":"x"}`,
+		"no-code.json":   `[{"label":"x"}]`,
+		"duplicate.json": `[{"code":"a_b"},{"code":"A-B"}]`,
+	} {
+		if _, err := LoadAccidentTypes(write(name, content)); err == nil {
+			t.Errorf("%s was accepted", name)
+		}
+	}
+	if _, err := LoadAccidentTypes(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("a missing file was accepted")
+	}
+}
+
+// migrationAPI serves accident logs with legacy, current and unknown type
+// markers and records in updates the comments each update writes.
+// Updating log 5 fails.
+func migrationAPI(updates map[string]string) *apiStub {
+	return &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			w.Write([]byte(`[
+				{"id":1,"comments":"[Type: Slip] wet floor"},
+				{"id":2,"comments":"[AccidentType: burn] hot pipe"},
+				{"id":3,"comments":"[Type: Meteor]"},
+				{"id":4,"comments":"no marker"},
+				{"id":5,"comments":"cable [type: shock]"},
+				{"id":6,"comments":"[AccidentType: Burn]"}
+			]`))
+			return
+		}
+		id := strings.TrimPrefix(req.URL.Path, "/rest/v1.0/projects/2/accident_logs/")
+		if id == "5" {
+			http.Error(w, `{"errors":"locked"}`, http.StatusConflict)
+			return
+		}
+		updates[id] = req.PostForm.Get("accident_log[comments]")
+		w.Write([]byte(`{"id":` + id + `}`))
+	}}
+}
+
+func migrate(t *testing.T, updates map[string]string, query string) (int, TypeMigrationResponse) {
+	t.Helper()
+	router := newTestRouter(t, migrationAPI(updates), AccidentLogs)
+	w := serve(router, http.MethodPost, "/api/accident-logs/types/migrate?"+query, "")
+	var response TypeMigrationResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body %s: %v", w.Body, err)
+	}
+	return w.Code, response
+}
+
+func migrationIDs(migrations []TypeMigration) []int {
+	ids := []int{}
+	for _, m := range migrations {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestMigrateAccidentTypesDryRun(t *testing.T) {
+	updates := map[string]string{}
+	status, response := migrate(t, updates, "dry_run=true")
+
+	if status != http.StatusOK || !response.DryRun || len(updates) != 0 {
+		t.Fatalf("status %d, dry run %v, updates %v", status, response.DryRun, updates)
+	}
+	if response.Scanned != 6 {
+		t.Errorf("scanned %d, want 6", response.Scanned)
+	}
+	if got := migrationIDs(response.Migrated); !reflect.DeepEqual(got, []int{1, 5, 6}) {
+		t.Errorf("migrated %v, want 1, 5 and 6", got)
+	}
+	if m := response.Migrated[0]; m.From != "Slip" || m.Type != "slip_trip_fall" {
+		t.Errorf("migration of log 1 = %+v", m)
+	}
+	if !reflect.DeepEqual(response.Unmapped, []TypeMigration{{ID: 3, From: "Meteor"}}) {
+		t.Errorf("unmapped = %+v", response.Unmapped)
+	}
+}
+
+func TestMigrateAccidentTypes(t *testing.T) {
+	updates := map[string]string{}
+	status, response := migrate(t, updates, "")
+
+	if status != http.StatusMultiStatus || response.Failed != 1 {
+		t.Fatalf("status %d, failed %d", status, response.Failed)
+	}
+	want := map[string]string{
+		"1": "[AccidentType: slip_trip_fall] wet floor",
+		"6": "[AccidentType: burn]",
+	}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates %v, want %v", updates, want)
+	}
+	for _, m := range response.Migrated {
+		failed := m.ID == 5
+		if failed != (m.Error != "") || failed && m.Status != http.StatusConflict || !failed && m.Status != http.StatusOK {
+			t.Errorf("migration of log %d = %+v", m.ID, m)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package logs
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAggregateConcurrency = 4
+	maxAggregateConcurrency     = 10
+)
+
+// ProjectResult reports how one project contributed to an aggregate query.
+type ProjectResult struct {
+	ProjectID   int    `json:"project_id"`
+	ProjectName string `json:"project_name"`
+	Count       int    `json:"count"`
+	// Source is SourceLive or SourceCache.
+	Source string `json:"source,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type AggregateResponse struct {
+	Logs     []map[string]interface{} `json:"logs"`
+	Projects []ProjectResult          `json:"projects"`
+	Failed   int                      `json:"failed"`
+}
+
+// Aggregate runs the Filter query against many projects of a company
+// concurrently and merges the results, tagging each log with project_id and
+// project_name. projects=1,2,3 limits the query to those projects (default:
+// every project the caller can access) and concurrency bounds the number of
+// projects queried at once. The merged logs are ordered and projected as a
+// whole. A project that fails is reported in projects rather than failing
+// the whole query. format=csv, xlsx or pdf downloads the merged logs.
+func (s *Service) Aggregate(r *Resource, c *gin.Context) {
+	client, ok := s.companyClient(c)
+	if !ok {
+		return
+	}
+
+	token, err := client.Tokens.Token(c.Request.Context())
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	projects, err := client.Projects(c.Request.Context())
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	// The list is the access check of every project in it, so reading the
+	// mirror of each does not list them again.
+	s.access.grant(token, client.CompanyID, projects)
+
+	if ids := splitIDs(c.Query("projects")); len(ids) > 0 {
+		projects = slices.DeleteFunc(projects, func(p procore.Project) bool {
+			return !slices.Contains(ids, strconv.Itoa(p.ID))
+		})
+	}
+
+	concurrency := defaultAggregateConcurrency
+	if n, err := strconv.Atoi(c.Query("concurrency")); err == nil && n > 0 {
+		concurrency = min(n, maxAggregateConcurrency)
+	}
+
+	filters, ok := parseFilters(c)
+	if !ok {
+		return
+	}
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	results := make([]ProjectResult, len(projects))
+	projectLogs := make([][]map[string]interface{}, len(projects))
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, project := range projects {
+		wg.Add(1)
+		go func(i int, project procore.Project) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = ProjectResult{ProjectID: project.ID, ProjectName: project.Name}
+
+			projectClient := client.ForProject(strconv.Itoa(project.ID))
+			logs, info, err := listLogs[map[string]interface{}](c.Request.Context(), s, r, projectClient, filters)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].Source = info.Source
+
+			logs = filters.filter(logs)
+			for _, log := range logs {
+				log["project_id"] = project.ID
+				log["project_name"] = project.Name
+			}
+			projectLogs[i] = logs
+			results[i].Count = len(logs)
+		}(i, project)
+	}
+	wg.Wait()
+
+	response := AggregateResponse{Logs: make([]map[string]interface{}, 0), Projects: results}
+	for i, logs := range projectLogs {
+		response.Logs = append(response.Logs, logs...)
+		if results[i].Error != "" {
+			response.Failed++
+		}
+	}
+	response.Logs = filters.order(response.Logs)
+	c.Header(SourceHeader, aggregateSource(results))
+
+	if format != "" && response.Failed < len(projects) {
+		report := s.exportReport(c, r, client, filters)
+		report.Project = "All accessible projects"
+		if ids := c.Query("projects"); ids != "" {
+			report.Project = "Projects " + ids
+		}
+		columns := exportFields(filters)
+		if filters.Query == nil || len(filters.Query.Fields) == 0 {
+			columns = append([]string{"project_id", "project_name"}, columns...)
+		}
+		writeExport(c, format, columns, report, filters.project(response.Logs))
+		return
+	}
+	response.Logs = filters.project(response.Logs)
+
+	status := http.StatusOK
+	if len(projects) > 0 && response.Failed == len(projects) {
+		status = http.StatusBadGateway
+	}
+	c.JSON(status, response)
+}
+
+// aggregateSource is the source of a merged read: live or cache when every
+// project agrees, mixed otherwise.
+func aggregateSource(results []ProjectResult) string {
+	source := ""
+	for _, result := range results {
+		switch {
+		case result.Source == "":
+		case source == "":
+			source = result.Source
+		case source != result.Source:
+			return SourceMixed
+		}
+	}
+	return firstNonEmpty(source, SourceLive)
+}
+
+func splitIDs(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
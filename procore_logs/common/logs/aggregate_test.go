@@ -0,0 +1,85 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// aggregateAPI is Procore with three projects of company 1, each with one
+// call log. It answers the project listings with projectsStatus when that
+// is set.
+func aggregateAPI(projectsStatus int) *apiStub {
+	return &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/rest/v1.0/projects":
+			if projectsStatus != 0 {
+				http.Error(w, `{"errors":"unauthorized"}`, projectsStatus)
+				return
+			}
+			w.Write([]byte(`[{"id":2,"name":"Two"},{"id":3,"name":"Three"},{"id":4,"name":"Four"}]`))
+		case "/rest/v1.0/projects/2/call_logs", "/rest/v1.0/projects/3/call_logs", "/rest/v1.0/projects/4/call_logs":
+			w.Write([]byte(`[{"id":1,"comments":"log"}]`))
+		default:
+			http.NotFound(w, req)
+		}
+	}}
+}
+
+// listings counts the project listings stub received.
+func listings(stub *apiStub) int {
+	n := 0
+	for _, req := range stub.sent() {
+		if req.Path == "/rest/v1.0/projects" {
+			n++
+		}
+	}
+	return n
+}
+
+func aggregate(router http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/call_logs/aggregate", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAggregateProjectListError(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		router := newTestRouter(t, aggregateAPI(status), CallLogs)
+		if w := aggregate(router, "bad-token"); w.Code != status {
+			t.Errorf("Procore %d: status = %d: %s", status, w.Code, w.Body)
+		}
+	}
+}
+
+func TestAggregateListsProjectsOnce(t *testing.T) {
+	stub := aggregateAPI(0)
+	router := newTestRouter(t, stub, CallLogs, func(cfg *Config) {
+		cfg.MirrorPath = filepath.Join(t.TempDir(), "mirror.db")
+	})
+
+	w := aggregate(router, "token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var response AggregateResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Logs) != 3 || response.Failed != 0 {
+		t.Errorf("response = %+v, want a log of each of 3 projects", response)
+	}
+	if n := listings(stub); n != 1 {
+		t.Errorf("%d project listings, want 1", n)
+	}
+
+	// Another caller is checked on its own.
+	aggregate(router, "other-token")
+	if n := listings(stub); n != 2 {
+		t.Errorf("%d project listings after a second caller, want 2", n)
+	}
+}
@@ -0,0 +1,252 @@
+package logs
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"procore-common/procore"
+	"procore-common/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHeader carries the opaque session ID when server-side sessions
+// are enabled. Browsers that went through Login send SessionCookie instead.
+const (
+	SessionHeader = "X-Session-Id"
+	SessionCookie = "procore_session"
+)
+
+// LoginStateCookie binds a login to the browser that started it: it holds
+// a digest of the login's state, which Callback requires to match.
+const LoginStateCookie = "procore_login_state"
+
+// ServiceAccountKeyHeader carries Config.ServiceAccountKey on the requests
+// that run as the service account.
+const ServiceAccountKeyHeader = "X-Api-Key"
+
+type AuthTokenRequest struct {
+	Code string `json:"code"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// GetAuthToken exchanges the authorization code pasted into the frontend
+// for a Procore access token. It is the manual fallback for Login.
+func (s *Service) GetAuthToken(c *gin.Context) {
+	var req AuthTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization code is required"})
+		return
+	}
+
+	tokenResp, err := s.OAuth().ExchangeCode(c.Request.Context(), req.Code, procore.OutOfBandRedirectURI, "")
+	if err != nil {
+		tokenError(c, err)
+		return
+	}
+
+	s.respondToken(c, "", tokenResp.Token())
+}
+
+// RefreshAuthToken renews an access token. With server-side sessions the
+// session named by the X-Session-Id header is refreshed; otherwise the
+// caller posts its refresh_token.
+func (s *Service) RefreshAuthToken(c *gin.Context) {
+	if id := sessionID(c); id != "" && s.Sessions != nil {
+		token, err := s.Sessions.Refresh(c.Request.Context(), id)
+		if err != nil {
+			tokenError(c, err)
+			return
+		}
+		s.respondToken(c, id, token)
+		return
+	}
+
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+		return
+	}
+
+	tokenResp, err := s.OAuth().Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		tokenError(c, err)
+		return
+	}
+
+	s.respondToken(c, "", tokenResp.Token())
+}
+
+// Login starts the browser login flow: it redirects to Procore's authorize
+// page with a fresh state and PKCE challenge, and sets LoginStateCookie.
+// return_to, when given, must be one of the frontend URLs.
+func (s *Service) Login(c *gin.Context) {
+	if s.Config.RedirectURI == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "PROCORE_REDIRECT_URI is not configured"})
+		return
+	}
+
+	returnTo := c.Query("return_to")
+	if returnTo == "" && len(s.ReturnURLs) > 0 {
+		returnTo = s.ReturnURLs[0]
+	} else if returnTo != "" && !slices.Contains(s.ReturnURLs, returnTo) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "return_to is not an allowed frontend URL"})
+		return
+	}
+
+	login, err := s.Sessions.BeginLogin(returnTo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(LoginStateCookie, loginStateDigest(login.State), int(session.LoginTTL.Seconds()), "/", "", s.Config.SecureCookies, true)
+	c.Redirect(http.StatusFound, s.OAuth().AuthorizeURL(s.Config.RedirectURI, login.State, login.Challenge))
+}
+
+// loginStateDigest is the LoginStateCookie value of a login's state.
+func loginStateDigest(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// Callback finishes the browser login: it exchanges the code Procore
+// redirected back with, stores the token in a new session and hands the
+// session to the browser as an HttpOnly cookie. The login must have been
+// started by the same browser, so a callback URL from someone else's login
+// cannot sign the browser in as them.
+func (s *Service) Callback(c *gin.Context) {
+	stateDigest, _ := c.Cookie(LoginStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(LoginStateCookie, "", -1, "/", "", s.Config.SecureCookies, true)
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errCode + ": " + c.Query("error_description")})
+		return
+	}
+
+	if s.Config.RedirectURI == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "PROCORE_REDIRECT_URI is not configured"})
+		return
+	}
+
+	state := c.Query("state")
+	if stateDigest == "" || subtle.ConstantTimeCompare([]byte(stateDigest), []byte(loginStateDigest(state))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login was not started in this browser"})
+		return
+	}
+	login, ok := s.Sessions.FinishLogin(state)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authorization code is required"})
+		return
+	}
+
+	tokenResp, err := s.OAuth().ExchangeCode(c.Request.Context(), code, s.Config.RedirectURI, login.Verifier)
+	if err != nil {
+		tokenError(c, err)
+		return
+	}
+
+	id, err := s.Sessions.Create(tokenResp.Token())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(SessionCookie, id, 0, "/", "", s.Config.SecureCookies, true)
+
+	if login.ReturnTo == "" {
+		c.JSON(http.StatusOK, gin.H{"message": "Logged in"})
+		return
+	}
+	c.Redirect(http.StatusFound, login.ReturnTo)
+}
+
+// Logout forgets the caller's server-side session.
+func (s *Service) Logout(c *gin.Context) {
+	if id := sessionID(c); id != "" && s.Sessions != nil {
+		s.Sessions.Delete(id)
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(SessionCookie, "", -1, "/", "", s.Config.SecureCookies, true)
+	c.Status(http.StatusNoContent)
+}
+
+// respondToken returns token to the caller. With server-side sessions only
+// an opaque session ID leaves the backend, stored under id or a new one.
+func (s *Service) respondToken(c *gin.Context, id string, token *procore.Token) {
+	expiresIn := 0
+	if !token.Expiry.IsZero() {
+		expiresIn = int(time.Until(token.Expiry).Seconds())
+	}
+
+	if s.Sessions == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"access_token":  token.AccessToken,
+			"token_type":    token.TokenType,
+			"expires_in":    expiresIn,
+			"refresh_token": token.RefreshToken,
+		})
+		return
+	}
+
+	if id == "" {
+		var err error
+		if id, err = s.Sessions.Create(token); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"session_id": id,
+		"token_type": token.TokenType,
+		"expires_in": expiresIn,
+	})
+}
+
+func tokenError(c *gin.Context, err error) {
+	var apiErr *procore.APIError
+	switch {
+	case errors.Is(err, session.ErrExpired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.As(err, &apiErr):
+		c.JSON(apiErr.StatusCode, gin.H{"error": apiErr.Body})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func sessionID(c *gin.Context) string {
+	if id := c.GetHeader(SessionHeader); id != "" {
+		return id
+	}
+	id, _ := c.Cookie(SessionCookie)
+	return id
+}
@@ -0,0 +1,151 @@
+package logs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loginStub is Procore's token endpoint for the authorization-code grant.
+// It checks the PKCE verifier against the challenge of the last login.
+type loginStub struct {
+	challenge string
+	exchanged int
+}
+
+func (p *loginStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	sum := sha256.Sum256([]byte(req.PostFormValue("code_verifier")))
+	if req.PostFormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	p.exchanged++
+	w.Write([]byte(`{"access_token":"user-token","token_type":"Bearer","expires_in":7200,"refresh_token":"refresh"}`))
+}
+
+func newLoginRouter(t *testing.T, stub *loginStub) (*Service, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	s, err := NewService(Config{
+		Environment: procore.Environment{LoginBaseURL: server.URL},
+		RedirectURI: "http://gateway/api/auth/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ReturnURLs = []string{"http://frontend"}
+	router := gin.New()
+	router.GET("/api/auth/login", s.Login)
+	router.GET("/api/auth/callback", s.Callback)
+	return s, router
+}
+
+// startLogin runs Login and returns its state and state cookie.
+func startLogin(t *testing.T, router http.Handler, stub *loginStub) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body)
+	}
+	authorize, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorize.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("redirect_uri") != "http://gateway/api/auth/callback" {
+		t.Errorf("authorize URL = %s", authorize)
+	}
+	stub.challenge = query.Get("code_challenge")
+
+	cookie := responseCookie(w, LoginStateCookie)
+	if cookie == nil {
+		t.Fatal("login set no state cookie")
+	}
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Value == query.Get("state") {
+		t.Errorf("state cookie = %+v", cookie)
+	}
+	return query.Get("state"), cookie
+}
+
+func callback(router http.Handler, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/callback?code=code&state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestLoginCallback(t *testing.T) {
+	stub := &loginStub{}
+	s, router := newLoginRouter(t, stub)
+	state, cookie := startLogin(t, router, stub)
+
+	w := callback(router, state, cookie)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "http://frontend" {
+		t.Fatalf("callback = %d %s: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	session := responseCookie(w, SessionCookie)
+	if session == nil || !s.Sessions.Exists(session.Value) {
+		t.Errorf("session cookie = %+v", session)
+	}
+	if cleared := responseCookie(w, LoginStateCookie); cleared == nil || cleared.MaxAge >= 0 {
+		t.Errorf("state cookie not cleared: %+v", cleared)
+	}
+
+	if w := callback(router, state, cookie); w.Code != http.StatusBadRequest {
+		t.Errorf("replayed callback = %d, want 400", w.Code)
+	}
+}
+
+func TestLoginCallbackNeedsStateCookie(t *testing.T) {
+	stub := &loginStub{}
+	_, router := newLoginRouter(t, stub)
+	state, _ := startLogin(t, router, stub)
+
+	w := callback(router, state, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("callback without the state cookie = %d, want 400", w.Code)
+	}
+	if responseCookie(w, SessionCookie) != nil || stub.exchanged != 0 {
+		t.Error("callback without the state cookie signed the browser in")
+	}
+}
+
+func TestLoginCallbackFromAnotherBrowser(t *testing.T) {
+	stub := &loginStub{}
+	_, router := newLoginRouter(t, stub)
+	// The attacker starts a login and stops at the callback URL; the
+	// victim's browser has a state cookie of a login of its own.
+	attackerState, _ := startLogin(t, router, stub)
+	_, victimCookie := startLogin(t, router, stub)
+
+	w := callback(router, attackerState, victimCookie)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("callback with another login's state = %d, want 400", w.Code)
+	}
+	if responseCookie(w, SessionCookie) != nil || stub.exchanged != 0 {
+		t.Error("callback with another login's state signed the browser in")
+	}
+}
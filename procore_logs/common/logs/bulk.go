@@ -0,0 +1,320 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBulkConcurrency = 4
+	maxBulkConcurrency     = 10
+	maxBulkOperations      = 500
+	// bulkRollbackTimeout bounds the deletes undoing a failed atomic batch.
+	bulkRollbackTimeout = time.Minute
+)
+
+// Bulk operation kinds.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// BulkOperation is one write of a bulk request. Log is the new log for a
+// create and the merge patch for an update; ID names the log to update or
+// delete.
+type BulkOperation struct {
+	Op  string          `json:"op"`
+	ID  json.Number     `json:"id,omitempty"`
+	Log json.RawMessage `json:"log,omitempty"`
+}
+
+type BulkRequest struct {
+	Operations []BulkOperation `json:"operations"`
+	// Atomic makes the request all-or-nothing: nothing is sent unless every
+	// operation validates, and logs created before a failure are deleted.
+	Atomic      bool `json:"atomic"`
+	Concurrency int  `json:"concurrency"`
+}
+
+// BulkResult reports the outcome of one operation, in request order.
+// Status is Procore's HTTP status, or 0 when the operation was not sent.
+type BulkResult struct {
+	Index      int              `json:"index"`
+	Op         string           `json:"op"`
+	ID         string           `json:"id,omitempty"`
+	Status     int              `json:"status"`
+	Log        json.RawMessage  `json:"log,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Fields     ValidationErrors `json:"fields,omitempty"`
+	RolledBack bool             `json:"rolled_back,omitempty"`
+}
+
+type BulkResponse struct {
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	// RolledBack reports that a failed atomic batch deleted every log it
+	// created.
+	RolledBack bool `json:"rolled_back,omitempty"`
+	// LeftBehind are the indexes of the creates of a failed atomic batch
+	// whose logs could not be deleted.
+	LeftBehind []int `json:"left_behind,omitempty"`
+}
+
+// bulkWrite is a validated operation ready to send.
+type bulkWrite struct {
+	op    string
+	id    string
+	log   procore.Log
+	patch procore.LogPatch
+}
+
+// Bulk runs a batch of creates, updates and deletes, at most concurrency
+// (default 4, max 10) at a time, and reports each one. Every operation is
+// validated first. In atomic mode a validation failure sends nothing, and
+// a failed write stops the operations not yet started and deletes the logs
+// the batch created; updates and deletes already applied are not undone.
+// The response is 200 when every operation succeeded and 207 otherwise.
+func (s *Service) Bulk(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+
+	var req BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		validationError(c, bindingErrors(err))
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBulkOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "operations must hold between 1 and " + strconv.Itoa(maxBulkOperations) + " items"})
+		return
+	}
+
+	response := BulkResponse{Results: make([]BulkResult, len(req.Operations))}
+	writes := make([]bulkWrite, len(req.Operations))
+	invalid := false
+	for i, op := range req.Operations {
+		response.Results[i] = BulkResult{Index: i, Op: op.Op, ID: op.ID.String()}
+		write, errs := s.prepareBulkWrite(r, op)
+		if len(errs) > 0 {
+			response.Results[i].Status = http.StatusBadRequest
+			response.Results[i].Error = "Invalid log"
+			response.Results[i].Fields = errs
+			invalid = true
+			continue
+		}
+		writes[i] = write
+	}
+	if invalid && req.Atomic {
+		response.count()
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	concurrency := defaultBulkConcurrency
+	if req.Concurrency > 0 {
+		concurrency = min(req.Concurrency, maxBulkConcurrency)
+	}
+
+	s.runBulkWrites(c.Request.Context(), r, client, writes, response.Results, concurrency, req.Atomic)
+
+	response.count()
+	if req.Atomic && response.Failed > 0 {
+		// The batch may have failed because the caller went away; its
+		// creates are undone all the same.
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), bulkRollbackTimeout)
+		response.LeftBehind = rollbackCreates(ctx, r, client, response.Results)
+		cancel()
+		response.RolledBack = len(response.LeftBehind) == 0
+	}
+	s.publishResults(r, client, response.Results)
+
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, response)
+}
+
+// runBulkWrites sends the writes whose result has no status yet, at most
+// concurrency at a time, recording each outcome in results. Writes start
+// in order; with allOrNothing the first failure stops the ones not yet
+// started, while writes in flight run to completion.
+func (s *Service) runBulkWrites(ctx context.Context, r *Resource, client *procore.Client, writes []bulkWrite, results []BulkResult, concurrency int, allOrNothing bool) {
+	var stopped atomic.Bool
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, write := range writes {
+		result := &results[i]
+		if result.Status != 0 {
+			continue
+		}
+		sem <- struct{}{}
+		if stopped.Load() {
+			result.Error = "Not sent: an earlier operation failed"
+			<-sem
+			continue
+		}
+
+		wg.Add(1)
+		go func(write bulkWrite) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.sendBulkWrite(ctx, r, client, write, result)
+			if !result.succeeded() && allOrNothing {
+				stopped.Store(true)
+			}
+		}(write)
+	}
+	wg.Wait()
+}
+
+// prepareBulkWrite decodes and validates one operation.
+func (s *Service) prepareBulkWrite(r *Resource, op BulkOperation) (bulkWrite, ValidationErrors) {
+	write := bulkWrite{op: op.Op, id: op.ID.String()}
+	var errs ValidationErrors
+
+	if op.Op != OpCreate && op.Op != OpUpdate && op.Op != OpDelete {
+		errs.add("op", "must be one of create, update, delete")
+		return write, errs
+	}
+	if op.Op != OpCreate && write.id == "" {
+		errs.add("id", "is required")
+		return write, errs
+	}
+
+	if op.Op != OpDelete && len(op.Log) == 0 {
+		errs.add("log", "is required")
+		return write, errs
+	}
+
+	switch op.Op {
+	case OpCreate:
+		if err := json.Unmarshal(op.Log, &write.log); err != nil {
+			return write, bindingErrors(err)
+		}
+		normalizeSeverity(&write.log.Severity)
+		if r.Validate != nil {
+			errs = r.Validate(s, write.log.Patch(), true)
+		}
+	case OpUpdate:
+		if err := json.Unmarshal(op.Log, &write.patch); err != nil {
+			return write, bindingErrors(err)
+		}
+		normalizeSeverity(&write.patch.Severity.Value)
+		if r.Validate != nil {
+			errs = r.Validate(s, write.patch, false)
+		}
+	}
+	return write, errs
+}
+
+// sendBulkWrite performs one write and records Procore's answer.
+func (s *Service) sendBulkWrite(ctx context.Context, r *Resource, client *procore.Client, write bulkWrite, result *BulkResult) {
+	var resp *http.Response
+	var err error
+	switch write.op {
+	case OpCreate:
+		s.encodeLog(r, &write.log)
+		resp, err = r.LogResource.Create(ctx, client, write.log)
+	case OpUpdate:
+		if err = s.encodePatch(ctx, r, client, write.id, &write.patch); err == nil {
+			resp, err = r.LogResource.Update(ctx, client, write.id, write.patch)
+		}
+	case OpDelete:
+		resp, err = r.LogResource.Delete(ctx, client, write.id)
+	}
+	var apiErr *procore.APIError
+	if errors.As(err, &apiErr) {
+		result.Status = apiErr.StatusCode
+		result.Error = apiErr.Body
+		return
+	}
+	if err != nil {
+		result.Status = http.StatusBadGateway
+		result.Error = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	result.Status = resp.StatusCode
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	if !result.succeeded() {
+		result.Error = string(body)
+		return
+	}
+	if json.Valid(body) {
+		result.Log = body
+	}
+
+	if write.op == OpCreate {
+		var created struct {
+			ID json.Number `json:"id"`
+		}
+		if json.Unmarshal(body, &created) == nil {
+			result.ID = created.ID.String()
+		}
+	}
+}
+
+// rollbackCreates deletes the logs created by a failed atomic batch and
+// returns the indexes of those it could not delete.
+func rollbackCreates(ctx context.Context, r *Resource, client *procore.Client, results []BulkResult) []int {
+	var leftBehind []int
+	for i := range results {
+		result := &results[i]
+		if result.Op != OpCreate || !result.succeeded() {
+			continue
+		}
+		if err := rollbackCreate(ctx, r, client, result.ID); err != nil {
+			result.Error = "Rollback failed: " + err.Error()
+			leftBehind = append(leftBehind, result.Index)
+			continue
+		}
+		result.RolledBack = true
+	}
+	return leftBehind
+}
+
+func rollbackCreate(ctx context.Context, r *Resource, client *procore.Client, id string) error {
+	if id == "" {
+		return errors.New("Procore did not return the log's id")
+	}
+	resp, err := r.LogResource.Delete(ctx, client, id)
+	if err != nil {
+		return err
+	}
+	return procore.DecodeResponse(resp, nil)
+}
+
+func (r *BulkResult) succeeded() bool {
+	return r.Status >= 200 && r.Status <= 299
+}
+
+func (r *BulkResponse) count() {
+	r.Succeeded, r.Failed = 0, 0
+	for _, result := range r.Results {
+		if result.succeeded() {
+			r.Succeeded++
+		} else {
+			r.Failed++
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bulkAPI is Procore's call log endpoints. Creates get ids from 11 up and
+// fail for the involved name "fail"; deleting log locked fails. The ids of
+// the logs it deletes are added to deleted.
+func bulkAPI(locked string, deleted *[]string) *apiStub {
+	nextID := 10
+	return &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		id := strings.TrimPrefix(req.URL.Path, "/rest/v1.0/projects/2/call_logs/")
+		switch {
+		case req.Method == http.MethodPost && req.PostForm.Get("call_log[involved_name]") == "fail":
+			http.Error(w, `{"errors":"rejected"}`, http.StatusUnprocessableEntity)
+		case req.Method == http.MethodPost:
+			nextID++
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"id":%d}`, nextID)
+		case req.Method == http.MethodDelete && id == locked:
+			http.Error(w, `{"errors":"locked"}`, http.StatusConflict)
+		case req.Method == http.MethodDelete:
+			*deleted = append(*deleted, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Write([]byte(`{"id":` + id + `}`))
+		}
+	}}
+}
+
+func bulk(t *testing.T, stub *apiStub, body string) (int, BulkResponse) {
+	t.Helper()
+	w := serve(newTestRouter(t, stub, CallLogs), http.MethodPost, "/api/call_logs/bulk", body)
+	var response BulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body %s: %v", w.Body, err)
+	}
+	return w.Code, response
+}
+
+func TestBulkAtomicRollback(t *testing.T) {
+	var deleted []string
+	status, response := bulk(t, bulkAPI("", &deleted), `{"atomic":true,"concurrency":1,"operations":[
+		{"op":"create","log":{"involved_name":"a"}},
+		{"op":"update","id":7,"log":{"comments":"x"}},
+		{"op":"create","log":{"involved_name":"b"}},
+		{"op":"create","log":{"involved_name":"fail"}},
+		{"op":"create","log":{"involved_name":"c"}}
+	]}`)
+
+	if status != http.StatusMultiStatus || !response.RolledBack || len(response.LeftBehind) != 0 {
+		t.Fatalf("status %d, response %+v; want 207 rolled back", status, response)
+	}
+	if want := []string{"11", "12"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted %v, want the batch's creates %v", deleted, want)
+	}
+	results := response.Results
+	if !results[0].RolledBack || !results[2].RolledBack || results[1].RolledBack {
+		t.Errorf("rolled back flags = %v %v %v", results[0].RolledBack, results[1].RolledBack, results[2].RolledBack)
+	}
+	if results[3].Status != http.StatusUnprocessableEntity {
+		t.Errorf("failed create = %+v", results[3])
+	}
+	if results[4].Status != 0 || results[4].Error == "" {
+		t.Errorf("create after the failure = %+v, want not sent", results[4])
+	}
+	if response.Succeeded != 3 || response.Failed != 2 {
+		t.Errorf("succeeded %d, failed %d", response.Succeeded, response.Failed)
+	}
+}
+
+func TestBulkAtomicRollbackLeftBehind(t *testing.T) {
+	var deleted []string
+	_, response := bulk(t, bulkAPI("12", &deleted), `{"atomic":true,"concurrency":1,"operations":[
+		{"op":"create","log":{"involved_name":"a"}},
+		{"op":"create","log":{"involved_name":"b"}},
+		{"op":"create","log":{"involved_name":"fail"}}
+	]}`)
+
+	if response.RolledBack || !reflect.DeepEqual(response.LeftBehind, []int{1}) {
+		t.Errorf("rolled back %v, left behind %v; want log 12 of operation 1 left behind", response.RolledBack, response.LeftBehind)
+	}
+	if !reflect.DeepEqual(deleted, []string{"11"}) {
+		t.Errorf("deleted %v", deleted)
+	}
+	if result := response.Results[1]; result.RolledBack || !strings.HasPrefix(result.Error, "Rollback failed") {
+		t.Errorf("left behind result = %+v", result)
+	}
+}
+
+func TestBulkAtomicValidation(t *testing.T) {
+	stub := bulkAPI("", new([]string))
+	status, response := bulk(t, stub, `{"atomic":true,"operations":[
+		{"op":"create","log":{"involved_name":"a"}},
+		{"op":"update","log":{"comments":"no id"}},
+		{"op":"create","log":{"time_hour":"nine"}},
+		{"op":"archive","id":3}
+	]}`)
+
+	if sent := stub.sent(); status != http.StatusBadRequest || len(sent) != 0 {
+		t.Fatalf("status %d, sent %v; want 400 with nothing sent", status, sent)
+	}
+	for i, field := range []string{"", "id", "time_hour", "op"} {
+		result := response.Results[i]
+		if field == "" {
+			if result.Status != 0 {
+				t.Errorf("valid operation %d = %+v", i, result)
+			}
+			continue
+		}
+		if result.Status != http.StatusBadRequest || len(result.Fields) != 1 || result.Fields[0].Field != field {
+			t.Errorf("operation %d = %+v, want %s rejected", i, result, field)
+		}
+	}
+}
+
+func TestBulkWithoutAtomic(t *testing.T) {
+	var deleted []string
+	status, response := bulk(t, bulkAPI("", &deleted), `{"concurrency":1,"operations":[
+		{"op":"create","log":{"involved_name":"a"}},
+		{"op":"create","log":{"involved_name":"fail"}},
+		{"op":"update","log":{}},
+		{"op":"delete","id":9}
+	]}`)
+
+	if status != http.StatusMultiStatus || response.Succeeded != 2 || response.Failed != 2 {
+		t.Fatalf("status %d, response %+v", status, response)
+	}
+	if response.RolledBack || !reflect.DeepEqual(deleted, []string{"9"}) {
+		t.Errorf("deleted %v, want only the requested delete", deleted)
+	}
+	if response.Results[0].ID != "11" {
+		t.Errorf("created id = %q", response.Results[0].ID)
+	}
+}
+
+func TestBulkAtomicRollbackAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var deleted []string
+	stub := bulkAPI("", &deleted)
+	// The caller goes away while the update, after the first create, is
+	// in flight.
+	api := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPut {
+			// Read the body, so the server notices the closed connection.
+			req.ParseForm()
+			cancel()
+			<-req.Context().Done()
+		}
+		stub.ServeHTTP(w, req)
+	})
+	router := newTestRouter(t, api, CallLogs)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/call_logs/bulk", strings.NewReader(`{"atomic":true,"concurrency":1,"operations":[
+		{"op":"create","log":{"involved_name":"a"}},
+		{"op":"update","id":7,"log":{"comments":"x"}},
+		{"op":"create","log":{"involved_name":"b"}}
+	]}`)).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response BulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("body %s: %v", w.Body, err)
+	}
+	if !response.RolledBack || !response.Results[0].RolledBack || !reflect.DeepEqual(deleted, []string{"11"}) {
+		t.Errorf("rolled back %v, left behind %v, deleted %v; want the create of log 11 undone", response.RolledBack, response.LeftBehind, deleted)
+	}
+}
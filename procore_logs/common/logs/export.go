@@ -0,0 +1,426 @@
+package logs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"procore-common/procore"
+	"procore-common/query"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// Export formats accepted by format= on the filter endpoints. Anything
+// else, or no format, is the usual JSON response.
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+	FormatPDF  = "pdf"
+)
+
+// exportColumns are the columns exported when fields is not given.
+var exportColumns = []string{
+	"id", "date", "time_hour", "time_minute", "involved_name",
+	"involved_company", "severity", "location", "comments",
+}
+
+// exportWeights size the PDF columns relative to each other; columns not
+// listed get 1.
+var exportWeights = map[string]float64{
+	"id":          0.6,
+	"date":        1,
+	"time_hour":   0.7,
+	"time_minute": 0.8,
+	"severity":    0.7,
+	"comments":    3,
+}
+
+// exportReport describes an export in the PDF header.
+type exportReport struct {
+	Title   string
+	Project string
+	Dates   string
+	Filters string
+}
+
+// exporter writes records as a file download, batch by batch. Nothing is
+// sent to the client before the first Write.
+type exporter interface {
+	Write(records []map[string]interface{}) error
+	Close() error
+}
+
+// exportFormat returns the requested export format, "" for JSON. It writes
+// a 400 and returns false for an unknown format.
+func exportFormat(c *gin.Context) (string, bool) {
+	switch format := strings.ToLower(c.Query("format")); format {
+	case "", "json":
+		return "", true
+	case FormatCSV, FormatXLSX, FormatPDF:
+		return format, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of json, csv, xlsx, pdf"})
+		return "", false
+	}
+}
+
+// streamable reports whether the filtered result can be exported page by
+// page as Procore returns it, which needs no search ranking, sort or page
+// window.
+func (f Filters) streamable(c *gin.Context) bool {
+	return f.Search.Empty() && (f.Query == nil || len(f.Query.Sort) == 0) && pageFromQuery(c).Number <= 0
+}
+
+// export writes the Filter result for r in format. When the result needs
+// no ordering and there is no mirror, each Procore page is filtered and
+// written as it arrives, so CSV rows reach the client while later pages
+// are still being fetched.
+func (s *Service) export(r *Resource, c *gin.Context, client *procore.Client, filters Filters, format string) {
+	report := s.exportReport(c, r, client, filters)
+
+	if !filters.streamable(c) || s.Mirror != nil {
+		logs, ok := fetchLogs[map[string]interface{}](c, s, r, client, filters)
+		if !ok {
+			return
+		}
+		writeExport(c, format, exportFields(filters), report, filters.project(paginate(c, filters.Apply(logs))))
+		return
+	}
+
+	setSource(c, readInfo{Source: SourceLive})
+	w := newExporter(c, format, exportFields(filters), report)
+	_, err := procore.EachPage(c.Request.Context(), client, client.ProjectPath(r.Name), filters.query(), procore.Page{},
+		func(batch []map[string]interface{}) error {
+			decodeLogs(s, r, batch)
+			return w.Write(filters.project(filters.filter(batch)))
+		})
+	if err == nil {
+		err = w.Close()
+	}
+	exportError(c, err)
+}
+
+// writeExport writes the columns of records, already filtered and ordered,
+// in format.
+func writeExport(c *gin.Context, format string, columns []string, report exportReport, records []map[string]interface{}) {
+	w := newExporter(c, format, columns, report)
+	err := w.Write(records)
+	if err == nil {
+		err = w.Close()
+	}
+	exportError(c, err)
+}
+
+// exportError reports a failed export. Once the download has started the
+// status can no longer change, so the error is only logged and the file
+// is cut short.
+func exportError(c *gin.Context, err error) {
+	if err == nil {
+		return
+	}
+	if !c.Writer.Written() {
+		listError(c, err)
+		return
+	}
+	c.Error(err)
+}
+
+func exportFields(filters Filters) []string {
+	if filters.Query != nil && len(filters.Query.Fields) > 0 {
+		return filters.Query.Fields
+	}
+	return exportColumns
+}
+
+// exportReport describes the export for the PDF header: the project, the
+// date window and the other query parameters that narrowed it.
+func (s *Service) exportReport(c *gin.Context, r *Resource, client *procore.Client, filters Filters) exportReport {
+	report := exportReport{
+		Title:   strings.ReplaceAll(r.Name, "_", " "),
+		Project: client.ProjectID,
+		Dates:   "All dates",
+		Filters: "None",
+	}
+	report.Title = strings.ToUpper(report.Title[:1]) + report.Title[1:]
+
+	if strings.ToLower(c.Query("format")) == FormatPDF {
+		// The name is only worth a Procore call for the PDF header.
+		if name := s.projectName(c, client); name != "" {
+			report.Project = name + " (" + client.ProjectID + ")"
+		}
+	}
+
+	if filters.StartDate != "" || filters.EndDate != "" {
+		report.Dates = firstNonEmpty(filters.StartDate, "...") + " to " + firstNonEmpty(filters.EndDate, "...")
+	}
+
+	query := c.Request.URL.Query()
+	var applied []string
+	for key, values := range query {
+		switch key {
+		case "format", "start_date", "end_date", "page", "per_page", "fields":
+			continue
+		}
+		for _, value := range values {
+			applied = append(applied, key+"="+value)
+		}
+	}
+	if len(applied) > 0 {
+		sort.Strings(applied)
+		report.Filters = strings.Join(applied, ", ")
+	}
+	return report
+}
+
+// projectName looks up the name of the client's project, "" when it is
+// unknown.
+func (s *Service) projectName(c *gin.Context, client *procore.Client) string {
+	if client.ProjectID == "" {
+		return ""
+	}
+	projects, err := client.Projects(c.Request.Context())
+	if err != nil {
+		return ""
+	}
+	for _, p := range projects {
+		if strconv.Itoa(p.ID) == client.ProjectID {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+func newExporter(c *gin.Context, format string, columns []string, report exportReport) exporter {
+	switch format {
+	case FormatXLSX:
+		return &xlsxExporter{c: c, columns: columns, report: report}
+	case FormatPDF:
+		return &pdfExporter{c: c, columns: columns, report: report}
+	default:
+		return &csvExporter{c: c, columns: columns, report: report}
+	}
+}
+
+// startDownload sets the headers of a file download named after the
+// report.
+func startDownload(c *gin.Context, report exportReport, contentType, ext string) {
+	name := strings.ReplaceAll(strings.ToLower(report.Title), " ", "-") + "-" + time.Now().Format(DateLayout) + "." + ext
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	c.Status(http.StatusOK)
+}
+
+// cellText formats a decoded JSON value for a file cell.
+func cellText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// formulaPrefixes start the text a spreadsheet runs as a formula.
+const formulaPrefixes = "=+-@\t\r"
+
+// spreadsheetCell is cellText for CSV files: text that a spreadsheet
+// would run as a formula is prefixed with ' so it stays text. Numbers are
+// left alone, negative ones included.
+func spreadsheetCell(value interface{}) string {
+	text := cellText(value)
+	if _, ok := value.(string); ok && text != "" && strings.ContainsRune(formulaPrefixes, rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// spreadsheetHeader is the header row of a CSV file.
+func spreadsheetHeader(columns []string) []string {
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = spreadsheetCell(column)
+	}
+	return header
+}
+
+// xlsxCell is a decoded JSON value as a typed worksheet cell. Text is
+// stored as a string cell, which Excel never runs as a formula, so unlike
+// CSV it is written as is.
+func xlsxCell(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, float64, bool:
+		return v
+	default:
+		return cellText(v)
+	}
+}
+
+// xlsxRow is the typed cells of the columns of record.
+func xlsxRow(columns []string, record map[string]interface{}) []interface{} {
+	cells := make([]interface{}, len(columns))
+	for i, column := range columns {
+		value, _ := query.Lookup(record, column)
+		cells[i] = xlsxCell(value)
+	}
+	return cells
+}
+
+// rowValues formats the columns of record with cell.
+func rowValues(columns []string, record map[string]interface{}, cell func(interface{}) string) []string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value, _ := query.Lookup(record, column)
+		values[i] = cell(value)
+	}
+	return values
+}
+
+// csvExporter writes rows straight to the client, flushing after each
+// batch.
+type csvExporter struct {
+	c       *gin.Context
+	columns []string
+	report  exportReport
+	w       *csv.Writer
+}
+
+func (e *csvExporter) Write(records []map[string]interface{}) error {
+	if e.w == nil {
+		startDownload(e.c, e.report, "text/csv; charset=utf-8", FormatCSV)
+		e.w = csv.NewWriter(e.c.Writer)
+		if err := e.w.Write(spreadsheetHeader(e.columns)); err != nil {
+			return err
+		}
+	}
+	for _, record := range records {
+		if err := e.w.Write(rowValues(e.columns, record, spreadsheetCell)); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	e.c.Writer.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) Close() error {
+	if e.w == nil {
+		return e.Write(nil)
+	}
+	return nil
+}
+
+// xlsxExporter streams rows into a worksheet, which excelize keeps on disk
+// once it grows, and sends the workbook on Close.
+type xlsxExporter struct {
+	c       *gin.Context
+	columns []string
+	report  exportReport
+	file    *excelize.File
+	sheet   *excelize.StreamWriter
+	row     int
+}
+
+func (e *xlsxExporter) Write(records []map[string]interface{}) error {
+	if e.file == nil {
+		e.file = excelize.NewFile()
+		sheet, err := e.file.NewStreamWriter("Sheet1")
+		if err != nil {
+			return err
+		}
+		e.sheet = sheet
+		header := make([]interface{}, len(e.columns))
+		for i, column := range e.columns {
+			header[i] = column
+		}
+		if err := e.writeRow(header); err != nil {
+			return err
+		}
+	}
+	for _, record := range records {
+		if err := e.writeRow(xlsxRow(e.columns, record)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *xlsxExporter) writeRow(cells []interface{}) error {
+	e.row++
+	cell, err := excelize.CoordinatesToCellName(1, e.row)
+	if err != nil {
+		return err
+	}
+	return e.sheet.SetRow(cell, cells)
+}
+
+func (e *xlsxExporter) Close() error {
+	if e.file == nil {
+		if err := e.Write(nil); err != nil {
+			return err
+		}
+	}
+	defer e.file.Close()
+	if err := e.sheet.Flush(); err != nil {
+		return err
+	}
+	startDownload(e.c, e.report, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", FormatXLSX)
+	_, err := e.file.WriteTo(e.c.Writer)
+	return err
+}
+
+// pdfExporter lays rows out as a report table. PDF needs the whole
+// document before it can be written, so it is sent on Close.
+type pdfExporter struct {
+	c       *gin.Context
+	columns []string
+	report  exportReport
+	pdf     *pdfReport
+}
+
+func (e *pdfExporter) Write(records []map[string]interface{}) error {
+	if e.pdf == nil {
+		e.pdf = newPDFReport(e.report.Title, [][2]string{
+			{"Project", e.report.Project},
+			{"Dates", e.report.Dates},
+			{"Filters", e.report.Filters},
+			{"Generated", time.Now().Format("2006-01-02 15:04 MST")},
+		})
+		weights := make([]float64, len(e.columns))
+		for i, column := range e.columns {
+			weights[i] = 1
+			if w, ok := exportWeights[column]; ok {
+				weights[i] = w
+			}
+		}
+		e.pdf.Table(e.columns, weights)
+	}
+	for _, record := range records {
+		e.pdf.Row(rowValues(e.columns, record, cellText))
+	}
+	return nil
+}
+
+func (e *pdfExporter) Close() error {
+	if e.pdf == nil {
+		e.Write(nil)
+	}
+	startDownload(e.c, e.report, "application/pdf", FormatPDF)
+	return e.pdf.Output(e.c.Writer)
+}
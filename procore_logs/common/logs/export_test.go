@@ -0,0 +1,137 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestSpreadsheetCell(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"plain", "plain"},
+		{"", ""},
+		{`=HYPERLINK("http://evil","x")`, `'=HYPERLINK("http://evil","x")`},
+		{"+1+2", "'+1+2"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+		{float64(-5), "-5"},
+		{float64(2.5), "2.5"},
+		{true, "true"},
+		{nil, ""},
+		{[]interface{}{"=x"}, `["=x"]`},
+	}
+	for _, tt := range tests {
+		if got := spreadsheetCell(tt.value); got != tt.want {
+			t.Errorf("spreadsheetCell(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+const exportLogs = `[
+	{"id":1,"date":"2024-03-01","involved_name":"=cmd|' /C calc'!A0","comments":"-10 crates","time_hour":-1},
+	{"id":2,"date":"2024-03-02","involved_name":"Jane","comments":"@home"}
+]`
+
+func exportRouter(t *testing.T) http.Handler {
+	t.Helper()
+	return newTestRouter(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/rest/v1.0/projects/2/call_logs" {
+			w.Write([]byte(`{"id":2,"name":"Tower"}`))
+			return
+		}
+		w.Write([]byte(exportLogs))
+	}), CallLogs)
+}
+
+func exportRequest(router http.Handler, query string) *httptest.ResponseRecorder {
+	return serve(router, http.MethodGet, "/api/call_logs/filter?"+query, "")
+}
+
+// wantExportRows are exportLogs' id, involved_name, comments and
+// time_hour with formulas escaped.
+var wantExportRows = [][]string{
+	{"id", "involved_name", "comments", "time_hour"},
+	{"1", `'=cmd|' /C calc'!A0`, "'-10 crates", "-1"},
+	{"2", "Jane", "'@home", ""},
+}
+
+func TestExportCSV(t *testing.T) {
+	router := exportRouter(t)
+	for _, query := range []string{"format=csv&fields=id,involved_name,comments,time_hour", "format=CSV&fields=id,involved_name,comments,time_hour&sort=id"} {
+		w := exportRequest(router, query)
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+			t.Fatalf("%s: status %d, content type %s: %s", query, w.Code, w.Header().Get("Content-Type"), w.Body)
+		}
+		if !strings.Contains(w.Header().Get("Content-Disposition"), "attachment") {
+			t.Errorf("%s: Content-Disposition = %s", query, w.Header().Get("Content-Disposition"))
+		}
+		rows, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rows, wantExportRows) {
+			t.Errorf("%s: rows = %q, want %q", query, rows, wantExportRows)
+		}
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	w := exportRequest(exportRouter(t), "format=xlsx&fields=id,involved_name,comments,time_hour")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	book, err := excelize.OpenReader(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer book.Close()
+	sheet := book.GetSheetName(0)
+	rows, err := book.GetRows(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Text is kept as written: string cells are never run as formulas.
+	want := [][]string{
+		{"id", "involved_name", "comments", "time_hour"},
+		{"1", "=cmd|' /C calc'!A0", "-10 crates", "-1"},
+		{"2", "Jane", "@home"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+	for _, cell := range []string{"B2", "C2", "C3"} {
+		if formula, _ := book.GetCellFormula(sheet, cell); formula != "" {
+			t.Errorf("%s has formula %q", cell, formula)
+		}
+		if kind, _ := book.GetCellType(sheet, cell); kind != excelize.CellTypeInlineString && kind != excelize.CellTypeSharedString {
+			t.Errorf("%s has type %v, want a string", cell, kind)
+		}
+	}
+	for _, cell := range []string{"A2", "D2", "A3"} {
+		if kind, _ := book.GetCellType(sheet, cell); kind != excelize.CellTypeNumber && kind != excelize.CellTypeUnset {
+			t.Errorf("%s has type %v, want a number", cell, kind)
+		}
+	}
+}
+
+func TestExportFormat(t *testing.T) {
+	router := exportRouter(t)
+	if w := exportRequest(router, "format=docx"); w.Code != http.StatusBadRequest {
+		t.Errorf("format=docx: status %d, want 400", w.Code)
+	}
+	if w := exportRequest(router, "format=JSON"); w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("format=JSON: status %d, content type %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
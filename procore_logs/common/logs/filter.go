@@ -0,0 +1,226 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"procore-common/procore"
+	"procore-common/query"
+	"procore-common/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Filters narrow a log listing. The date window is passed to Procore; the
+// other fields are applied locally since Procore does not filter on them.
+type Filters struct {
+	StartDate string
+	EndDate   string
+	Severity  string
+	Company   string
+	// Search is the parsed search query parameter, see package search.
+	Search search.Query
+	// Query holds the comparisons, sort keys and field projection, see
+	// package query.
+	Query *query.Query
+	// Live reads from Procore even when the mirror has a fresh copy.
+	Live bool
+}
+
+// parseFilters reads the filters from the request, writing a 400 when the
+// query language parameters do not parse.
+func parseFilters(c *gin.Context) (Filters, bool) {
+	q, err := query.Parse(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return Filters{}, false
+	}
+	tagFilters(q, c.Request.URL.Query())
+	return Filters{
+		StartDate: c.Query("start_date"),
+		EndDate:   c.Query("end_date"),
+		Severity:  c.Query("severity"),
+		Company:   c.Query("company"),
+		Search:    search.Parse(c.Query("search")),
+		Query:     q,
+		Live:      c.Query("live") == "true",
+	}, true
+}
+
+// query returns the Procore query parameters for the date window.
+func (f Filters) query() url.Values {
+	query := url.Values{}
+	if f.StartDate != "" {
+		query.Set("start_date", f.StartDate)
+	}
+	if f.EndDate != "" {
+		query.Set("end_date", f.EndDate)
+	}
+	return query
+}
+
+// inWindow reports whether a raw record falls in the date window, which the
+// mirror applies itself since it holds every log.
+func (f Filters) inWindow(record json.RawMessage) bool {
+	if f.StartDate == "" && f.EndDate == "" {
+		return true
+	}
+	var head struct {
+		Date string `json:"date"`
+	}
+	json.Unmarshal(record, &head)
+	return (f.StartDate == "" || head.Date >= f.StartDate) && (f.EndDate == "" || head.Date <= f.EndDate)
+}
+
+// Match reports whether log passes the severity, company, comparison and
+// search filters.
+func (f Filters) Match(log map[string]interface{}) bool {
+	if f.Severity != "" {
+		logSeverity, ok := log["severity"].(string)
+		if !ok || !strings.EqualFold(logSeverity, f.Severity) {
+			return false
+		}
+	}
+
+	if f.Company != "" {
+		logCompany, ok := log["involved_company"].(string)
+		if !ok || !strings.Contains(strings.ToLower(logCompany), strings.ToLower(f.Company)) {
+			return false
+		}
+	}
+
+	if f.Query != nil && !f.Query.Where.Match(log) {
+		return false
+	}
+	if !f.Search.Empty() {
+		if _, ok := f.Search.Score(log); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the logs that Match, ordered.
+func (f Filters) Apply(logs []map[string]interface{}) []map[string]interface{} {
+	return f.order(f.filter(logs))
+}
+
+func (f Filters) filter(logs []map[string]interface{}) []map[string]interface{} {
+	filteredLogs := make([]map[string]interface{}, 0)
+	for _, log := range logs {
+		if f.Match(log) {
+			filteredLogs = append(filteredLogs, log)
+		}
+	}
+	return filteredLogs
+}
+
+// order puts the most relevant search matches first and then applies the
+// sort keys, which win over relevance.
+func (f Filters) order(logs []map[string]interface{}) []map[string]interface{} {
+	if !f.Search.Empty() {
+		logs = f.Search.Rank(logs)
+	}
+	if f.Query != nil {
+		f.Query.SortRecords(logs)
+	}
+	return logs
+}
+
+// project trims logs to the requested fields.
+func (f Filters) project(logs []map[string]interface{}) []map[string]interface{} {
+	if f.Query == nil {
+		return logs
+	}
+	return f.Query.Project(logs)
+}
+
+// Filter lists logs between start_date and end_date and narrows them
+// locally by severity, company, comparisons such as time_hour>=12 and the
+// search query. Every Procore page is fetched before filtering; the result
+// is sorted, windowed by page and per_page, and trimmed to fields.
+// format=csv, xlsx or pdf downloads the same result as a file.
+func (s *Service) Filter(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+
+	filters, ok := parseFilters(c)
+	if !ok {
+		return
+	}
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	if format != "" {
+		s.export(r, c, client, filters, format)
+		return
+	}
+
+	logs, ok := fetchLogs[map[string]interface{}](c, s, r, client, filters)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, filters.project(paginate(c, filters.Apply(logs))))
+}
+
+// listLogs returns the resource's logs in the filters' date window, from
+// the mirror when one is configured and from every Procore page otherwise.
+func listLogs[T any](ctx context.Context, s *Service, r *Resource, client *procore.Client, filters Filters) ([]T, readInfo, error) {
+	if s.Mirror == nil {
+		logs, _, err := procore.ListPages[T](ctx, client, client.ProjectPath(r.Name), filters.query(), procore.Page{})
+		decodeLogs(s, r, logs)
+		return logs, readInfo{Source: SourceLive}, err
+	}
+
+	if err := s.authorize(ctx, client); err != nil {
+		return nil, readInfo{}, err
+	}
+	records, info, err := s.Mirror.records(ctx, r, client, filters.Live)
+	if err != nil {
+		return nil, info, err
+	}
+	logs := make([]T, 0, len(records))
+	for _, record := range records {
+		if !filters.inWindow(record) {
+			continue
+		}
+		var log T
+		if err := json.Unmarshal(record, &log); err != nil {
+			return nil, info, err
+		}
+		logs = append(logs, log)
+	}
+	decodeLogs(s, r, logs)
+	return logs, info, nil
+}
+
+// fetchLogs is listLogs for a handler. It reports the source of the logs
+// in the response headers, or writes the error response and returns false
+// on failure.
+func fetchLogs[T any](c *gin.Context, s *Service, r *Resource, client *procore.Client, filters Filters) ([]T, bool) {
+	logs, info, err := listLogs[T](c.Request.Context(), s, r, client, filters)
+	if err != nil {
+		listError(c, err)
+		return nil, false
+	}
+	setSource(c, info)
+	return logs, true
+}
+
+// listError reports a failed listing, passing Procore's own status through.
+func listError(c *gin.Context, err error) {
+	var apiErr *procore.APIError
+	if errors.As(err, &apiErr) {
+		c.JSON(apiErr.StatusCode, gin.H{"error": apiErr.Body})
+		return
+	}
+	requestError(c, "Failed to contact Procore API: ", err)
+}
@@ -0,0 +1,322 @@
+package logs
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"procore-common/mirror"
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// hookNamespace names the hooks the gateway registers in Procore.
+	hookNamespace = "procore-logs-gateway"
+	// hookTimeout bounds fetching and storing the log of one hook event.
+	hookTimeout = time.Minute
+)
+
+// hookEventTypes maps the event types of Procore triggers to event kinds.
+var hookEventTypes = map[string]string{
+	"create": mirror.Created,
+	"update": mirror.Updated,
+	"delete": mirror.Deleted,
+}
+
+// ProcoreHookEvent is the body of a Procore hook event. API version v2
+// names the resource in ResourceType, v1 in ResourceName.
+type ProcoreHookEvent struct {
+	ULID         string      `json:"ulid"`
+	EventType    string      `json:"event_type"`
+	ResourceType string      `json:"resource_type"`
+	ResourceName string      `json:"resource_name"`
+	ResourceID   json.Number `json:"resource_id"`
+	CompanyID    json.Number `json:"company_id"`
+	ProjectID    json.Number `json:"project_id"`
+}
+
+// hookAuthorization is the Authorization header registered hooks send.
+func hookAuthorization(secret string) string {
+	return "Bearer " + secret
+}
+
+// ProcoreHook receives the events of the hooks registered in Procore. It
+// answers as soon as the event is verified, then brings the mirror's copy
+// of the log up to date and publishes the change to the outbound webhook
+// subscribers. Events for other resources are acknowledged and ignored.
+func (s *Service) ProcoreHook(c *gin.Context) {
+	if s.Config.ProcoreHookSecret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "PROCORE_WEBHOOK_SECRET is not configured"})
+		return
+	}
+	want := hookAuthorization(s.Config.ProcoreHookSecret)
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte(want)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid hook credentials"})
+		return
+	}
+
+	var event ProcoreHookEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hook event: " + err.Error()})
+		return
+	}
+	if event.ResourceID == "" || event.ProjectID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hook event needs resource_id and project_id"})
+		return
+	}
+	r := s.resourceByHookName(firstNonEmpty(event.ResourceType, event.ResourceName))
+	kind, known := hookEventTypes[strings.ToLower(event.EventType)]
+	if r == nil || !known {
+		c.JSON(http.StatusOK, gin.H{"ignored": true})
+		return
+	}
+	// Procore retries an event until it is acknowledged, with the same ULID.
+	if event.ULID != "" && !s.published.first("procore/"+event.ULID) {
+		c.JSON(http.StatusOK, gin.H{"duplicate": true})
+		return
+	}
+
+	companyID := firstNonEmpty(event.CompanyID.String(), s.Config.CompanyID)
+	go s.applyHook(r, companyID, event.ProjectID.String(), kind, event.ResourceID.String())
+	c.JSON(http.StatusAccepted, gin.H{"received": true})
+}
+
+// resourceByHookName finds a registered log type by its HookName.
+func (s *Service) resourceByHookName(name string) *Resource {
+	for _, r := range s.registered() {
+		if strings.EqualFold(r.HookName, name) {
+			return r
+		}
+	}
+	return nil
+}
+
+// applyHook brings the mirror up to date with a change Procore reported
+// and publishes it. A created or updated log is fetched as the service
+// account; without one, or when the fetch fails, the mirror's copy is
+// only invalidated and the event carries just the log's id.
+func (s *Service) applyHook(r *Resource, companyID, projectID, kind, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	client := procore.NewClient(s.Config.Environment.RestURL(), companyID, projectID, nil)
+	key := mirrorKey(r, client)
+
+	var record json.RawMessage
+	if kind != mirror.Deleted {
+		var err error
+		if record, err = s.fetchHookRecord(ctx, r, client, id); err != nil {
+			var apiErr *procore.APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				kind = mirror.Deleted
+			} else {
+				log.Printf("hooks: failed to fetch %s %s: %v", key, id, err)
+				if s.Mirror != nil {
+					s.Mirror.Invalidate(key)
+				}
+				s.publishRaw(r, client, kind, SourceProcore, id, nil)
+				return
+			}
+		}
+	}
+
+	if s.Mirror != nil {
+		var changes []mirror.Change
+		var mirrored bool
+		var err error
+		if kind == mirror.Deleted {
+			changes, mirrored, err = s.Mirror.Store.Remove(key, id, time.Now())
+		} else {
+			changes, mirrored, err = s.Mirror.Store.Put(key, record, time.Now())
+		}
+		if err != nil {
+			log.Printf("hooks: failed to update mirror %s: %v", key, err)
+			s.Mirror.Invalidate(key)
+		} else if mirrored && (len(changes) > 0 || kind != mirror.Deleted) {
+			for _, change := range changes {
+				s.publishRaw(r, client, change.Kind, SourceProcore, change.ID, change.Record)
+			}
+			return
+		}
+	}
+	s.publishRaw(r, client, kind, SourceProcore, id, record)
+}
+
+// fetchHookRecord reads one log as the service account.
+func (s *Service) fetchHookRecord(ctx context.Context, r *Resource, client *procore.Client, id string) (json.RawMessage, error) {
+	if s.ServiceAccount == nil {
+		return nil, errors.New("PROCORE_SERVICE_ACCOUNT is not enabled")
+	}
+	client.Tokens = s.ServiceAccount
+	resp, err := r.LogResource.Get(ctx, client, id)
+	if err != nil {
+		return nil, err
+	}
+	var record json.RawMessage
+	if err := procore.DecodeResponse(resp, &record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// hooksClient is the client of the hook registration routes, which need
+// PROCORE_WEBHOOK_URL. Hooks send the gateway every change made in the
+// project, whoever made it, so they are managed as the service account,
+// by callers sending ServiceAccountKey; a caller's own token is refused
+// even when it may manage webhooks in Procore.
+func (s *Service) hooksClient(c *gin.Context) (*procore.Client, bool) {
+	if s.Config.ProcoreHookURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "PROCORE_WEBHOOK_URL is not configured"})
+		return nil, false
+	}
+	if s.ServiceAccount == nil || s.Config.ServiceAccountKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "PROCORE_SERVICE_ACCOUNT_KEY is not configured"})
+		return nil, false
+	}
+	key := c.GetHeader(ServiceAccountKeyHeader)
+	if key == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Procore hooks are managed with " + ServiceAccountKeyHeader})
+		return nil, false
+	}
+	if !s.validServiceAccountKey(key) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid " + ServiceAccountKeyHeader})
+		return nil, false
+	}
+
+	companyID, projectID := s.scope(c)
+	if companyID == "" || projectID == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Missing required environment variables"})
+		return nil, false
+	}
+	return procore.NewClient(s.Config.Environment.RestURL(), companyID, projectID, s.ServiceAccount), true
+}
+
+// gatewayHooks returns the hooks of the project that post to the gateway.
+func (s *Service) gatewayHooks(ctx context.Context, client *procore.Client) ([]procore.Hook, error) {
+	hooks, err := client.Hooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mine := make([]procore.Hook, 0, len(hooks))
+	for _, hook := range hooks {
+		if hook.DestinationURL == s.Config.ProcoreHookURL {
+			hook.DestinationHeaders = nil
+			mine = append(mine, hook)
+		}
+	}
+	return mine, nil
+}
+
+// ListProcoreHooks returns the hooks of the project that post to the
+// gateway.
+func (s *Service) ListProcoreHooks(c *gin.Context) {
+	client, ok := s.hooksClient(c)
+	if !ok {
+		return
+	}
+	hooks, err := s.gatewayHooks(c.Request.Context(), client)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, hooks)
+}
+
+// RegisterProcoreHooks registers a hook posting to the gateway in the
+// project, triggered by every create, update and delete of every
+// registered log type. Hooks registered before are replaced, once the new
+// one has all its triggers, so the project is never left without one.
+func (s *Service) RegisterProcoreHooks(c *gin.Context) {
+	client, ok := s.hooksClient(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	previous, err := s.gatewayHooks(ctx, client)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+
+	hook, err := client.CreateHook(ctx, procore.Hook{
+		Namespace:          hookNamespace,
+		APIVersion:         "v2",
+		DestinationURL:     s.Config.ProcoreHookURL,
+		DestinationHeaders: map[string]string{"Authorization": hookAuthorization(s.Config.ProcoreHookSecret)},
+	})
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	triggers := make([]procore.HookTrigger, 0)
+	for _, r := range s.registered() {
+		for _, eventType := range []string{"create", "update", "delete"} {
+			trigger, err := client.CreateHookTrigger(ctx, hook.ID, procore.HookTrigger{ResourceName: r.HookName, EventType: eventType})
+			if err != nil {
+				// A hook missing some of its triggers would drop changes
+				// silently, so none is left behind.
+				if err := client.DeleteHook(ctx, hook.ID); err != nil {
+					log.Printf("hooks: failed to delete incomplete hook %d: %v", hook.ID, err)
+				}
+				listError(c, err)
+				return
+			}
+			triggers = append(triggers, trigger)
+		}
+	}
+	hook.DestinationHeaders = nil
+	response := gin.H{"hook": hook, "triggers": triggers}
+
+	// The new hook is live, so failing to delete an earlier one only means
+	// Procore posts some events twice, which the receiver ignores.
+	replaced, err := deleteHooks(ctx, client, previous)
+	response["replaced"] = replaced
+	if err != nil {
+		log.Printf("hooks: failed to delete replaced hooks: %v", err)
+		response["error"] = "Failed to delete some earlier hooks: " + err.Error()
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// UnregisterProcoreHooks deletes the hooks of the project that post to
+// the gateway.
+func (s *Service) UnregisterProcoreHooks(c *gin.Context) {
+	client, ok := s.hooksClient(c)
+	if !ok {
+		return
+	}
+	deleted, err := s.unregisterHooks(c.Request.Context(), client)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// unregisterHooks deletes the hooks of the project that post to the
+// gateway and returns their IDs.
+func (s *Service) unregisterHooks(ctx context.Context, client *procore.Client) ([]int, error) {
+	hooks, err := s.gatewayHooks(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return deleteHooks(ctx, client, hooks)
+}
+
+// deleteHooks deletes hooks and returns the IDs of those it deleted.
+func deleteHooks(ctx context.Context, client *procore.Client, hooks []procore.Hook) ([]int, error) {
+	deleted := make([]int, 0, len(hooks))
+	for _, hook := range hooks {
+		if err := client.DeleteHook(ctx, hook.ID); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, hook.ID)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,215 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"procore-common/mirror"
+	"procore-common/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+func hookRouter(s *Service) http.Handler {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/webhooks/procore", s.ProcoreHook)
+	return router
+}
+
+func postHook(router http.Handler, authorization, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/procore", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestProcoreHookVerification(t *testing.T) {
+	const deleted = `{"ulid":"01HX","event_type":"delete","resource_type":"Call Logs","resource_id":7,"project_id":2}`
+	router := hookRouter(&Service{
+		Config:    Config{ProcoreHookSecret: "shh"},
+		resources: map[string]*Resource{CallLogs.Name: CallLogs},
+	})
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		status        int
+	}{
+		{"no credentials", "", deleted, http.StatusUnauthorized},
+		{"wrong secret", "Bearer other", deleted, http.StatusUnauthorized},
+		{"secret without the scheme", "shh", deleted, http.StatusUnauthorized},
+		{"invalid body", "Bearer shh", `{"resource_id":`, http.StatusBadRequest},
+		{"no project", "Bearer shh", `{"event_type":"delete","resource_type":"Call Logs","resource_id":7}`, http.StatusBadRequest},
+		{"unknown resource", "Bearer shh", `{"event_type":"delete","resource_type":"RFIs","resource_id":7,"project_id":2}`, http.StatusOK},
+		{"unknown event type", "Bearer shh", `{"event_type":"archive","resource_type":"Call Logs","resource_id":7,"project_id":2}`, http.StatusOK},
+		{"v1 resource name", "Bearer shh", `{"event_type":"Delete","resource_name":"call logs","resource_id":8,"project_id":2}`, http.StatusAccepted},
+		{"verified", "Bearer shh", deleted, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		if w := postHook(router, tt.authorization, tt.body); w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+		}
+	}
+
+	disabled := hookRouter(&Service{resources: map[string]*Resource{CallLogs.Name: CallLogs}})
+	if w := postHook(disabled, "Bearer ", deleted); w.Code != http.StatusNotFound {
+		t.Errorf("without PROCORE_WEBHOOK_SECRET: status %d, want 404", w.Code)
+	}
+}
+
+func TestProcoreHookDuplicates(t *testing.T) {
+	router := hookRouter(&Service{
+		Config:    Config{ProcoreHookSecret: "shh"},
+		resources: map[string]*Resource{CallLogs.Name: CallLogs},
+	})
+	post := func(ulid string, id int) gin.H {
+		t.Helper()
+		body, _ := json.Marshal(gin.H{"ulid": ulid, "event_type": "delete", "resource_type": "Call Logs", "resource_id": id, "project_id": 2})
+		w := postHook(router, "Bearer shh", string(body))
+		var response gin.H
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	if response := post("01HX", 7); response["received"] != true {
+		t.Fatalf("first delivery = %v, want received", response)
+	}
+	if response := post("01HX", 7); response["duplicate"] != true {
+		t.Errorf("retried delivery = %v, want duplicate", response)
+	}
+	if response := post("01HY", 7); response["received"] != true {
+		t.Errorf("another event = %v, want received", response)
+	}
+	// Without a ULID there is nothing to recognize a retry by.
+	for i := 0; i < 2; i++ {
+		if response := post("", 9); response["received"] != true {
+			t.Errorf("event without a ULID = %v, want received", response)
+		}
+	}
+}
+
+func TestApplyHook(t *testing.T) {
+	s := newWebhookService(t)
+	s.resources = map[string]*Resource{CallLogs.Name: CallLogs}
+	if err := s.Webhooks.AddSubscription(webhook.Subscription{ID: "sub", CompanyID: "1", ProjectID: "2", URL: "https://example.com/hook"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A deletion needs no fetch. A change cannot be fetched without the
+	// service account, so it is published with only the log's id.
+	s.applyHook(CallLogs, "1", "2", mirror.Deleted, "7")
+	s.applyHook(CallLogs, "1", "2", mirror.Updated, "8")
+
+	deliveries, err := s.Webhooks.Deliveries(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("%d deliveries, want 2", len(deliveries))
+	}
+	for i, want := range []struct{ id, kind string }{{"8", mirror.Updated}, {"7", mirror.Deleted}} {
+		var event webhook.Event
+		if err := json.Unmarshal(deliveries[i].Body, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.LogID != want.id || event.Type != want.kind || event.Source != SourceProcore || recordID(event.Record) != want.id {
+			t.Errorf("event = %+v, want %s of log %s from Procore", event, want.kind, want.id)
+		}
+	}
+}
+
+// hooksAPI is Procore's webhooks API for project 2, answering only the
+// service account's token.
+func hooksAPI() *apiStub {
+	return &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/oauth/token":
+			w.Write([]byte(`{"access_token":"app","token_type":"Bearer","expires_in":7200}`))
+		case req.Header.Get("Authorization") != "Bearer app":
+			http.Error(w, `{"errors":"unauthorized"}`, http.StatusUnauthorized)
+		case req.Method == http.MethodGet:
+			w.Write([]byte(`[{"id":4,"destination_url":"https://gateway.example.com/api/webhooks/procore"}]`))
+		case strings.HasSuffix(req.URL.Path, "/triggers"):
+			w.Write([]byte(`{"id":1,"resource_name":"Call Logs","event_type":"create"}`))
+		case req.Method == http.MethodPost:
+			w.Write([]byte(`{"id":5}`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}}
+}
+
+func TestProcoreHookRegistrationNeedsServiceAccountKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		key           string
+		status        int
+	}{
+		{"a caller's token", "Bearer token", "", http.StatusForbidden},
+		{"a wrong key", "", "guess", http.StatusUnauthorized},
+		{"the key", "", "key", 0},
+	}
+	routes := []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodPost, http.StatusCreated},
+		{http.MethodDelete, http.StatusOK},
+	}
+	for _, tt := range tests {
+		for _, route := range routes {
+			stub := hooksAPI()
+			s, _ := newTestService(t, stub, CallLogs, func(cfg *Config) {
+				cfg.ProcoreHookURL = "https://gateway.example.com/api/webhooks/procore"
+				cfg.ServiceAccount = true
+				cfg.ServiceAccountKey = "key"
+			})
+			router := gin.New()
+			router.GET("/api/webhooks/procore/hooks", s.ListProcoreHooks)
+			router.POST("/api/webhooks/procore/hooks", s.RegisterProcoreHooks)
+			router.DELETE("/api/webhooks/procore/hooks", s.UnregisterProcoreHooks)
+
+			req := httptest.NewRequest(route.method, "/api/webhooks/procore/hooks", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.key != "" {
+				req.Header.Set(ServiceAccountKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			want := tt.status
+			if want == 0 {
+				want = route.status
+			}
+			if w.Code != want {
+				t.Errorf("%s %s: status = %d, want %d: %s", route.method, tt.name, w.Code, want, w.Body)
+			}
+			if tt.status != 0 && len(stub.sent()) > 0 {
+				t.Errorf("%s %s: Procore got %+v, want nothing", route.method, tt.name, stub.sent())
+			}
+		}
+	}
+}
+
+func TestProcoreHookRegistrationWithoutServiceAccount(t *testing.T) {
+	s, _ := newTestService(t, hooksAPI(), CallLogs, func(cfg *Config) {
+		cfg.ProcoreHookURL = "https://gateway.example.com/api/webhooks/procore"
+	})
+	router := gin.New()
+	router.POST("/api/webhooks/procore/hooks", s.RegisterProcoreHooks)
+	if w := serve(router, http.MethodPost, "/api/webhooks/procore/hooks", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404: %s", w.Code, w.Body)
+	}
+}
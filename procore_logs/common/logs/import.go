@@ -0,0 +1,320 @@
+package logs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+const maxImportSize = 10 << 20
+
+// importFields are the log fields an import can fill, in form order.
+var importFields = []string{
+	"comments", "date", "datetime", "involved_company", "involved_name",
+	"time_hour", "time_minute", "severity", "location", "type",
+}
+
+// importAliases map common spreadsheet headers to log fields. Headers are
+// compared lower-cased with spaces and dashes turned into underscores, so
+// "Involved Name" matches involved_name without an alias.
+var importAliases = map[string]string{
+	"name":          "involved_name",
+	"person":        "involved_name",
+	"company":       "involved_company",
+	"comment":       "comments",
+	"notes":         "comments",
+	"hour":          "time_hour",
+	"minute":        "time_minute",
+	"accident_type": "type",
+	"category":      "type",
+}
+
+// importDateLayouts are the date formats accepted besides DateLayout.
+var importDateLayouts = []string{"1/2/2006", "01/02/2006", "2006/01/02", "01-02-06", "2-Jan-2006"}
+
+// ImportRow is one data row of an imported file. Row is its line in the
+// file, counting the header as 1.
+type ImportRow struct {
+	Row    int              `json:"row"`
+	Log    *procore.Log     `json:"log,omitempty"`
+	ID     string           `json:"id,omitempty"`
+	Status int              `json:"status,omitempty"`
+	Error  string           `json:"error,omitempty"`
+	Fields ValidationErrors `json:"fields,omitempty"`
+}
+
+type ImportResponse struct {
+	DryRun bool `json:"dry_run"`
+	Rows   int  `json:"rows"`
+	// Columns maps each used header to the log field it fills.
+	Columns  map[string]string `json:"columns"`
+	Ignored  []string          `json:"ignored_columns,omitempty"`
+	Accepted []ImportRow       `json:"accepted"`
+	Rejected []ImportRow       `json:"rejected"`
+}
+
+// Import creates logs from the rows of an uploaded CSV or XLSX file (the
+// multipart field "file"; for XLSX, the first sheet). Headers are matched
+// to log fields by name or alias, or by mapping, a JSON object such as
+// {"Injured person": "involved_name"}. Every row is validated like a
+// create; with dry_run=true the valid rows are only previewed, otherwise
+// they are created as a bulk write. Rejected rows are listed with the
+// reasons, whether from validation or from Procore.
+func (s *Service) Import(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A CSV or XLSX file is required in the file field"})
+		return
+	}
+
+	var mapping map[string]string
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of header to field"})
+			return
+		}
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	rows, err := readRows(f, file.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The file has no header row"})
+		return
+	}
+
+	columns, err := mapColumns(rows[0], mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := ImportResponse{
+		DryRun:   c.Query("dry_run") == "true" || c.PostForm("dry_run") == "true",
+		Columns:  map[string]string{},
+		Accepted: make([]ImportRow, 0),
+		Rejected: make([]ImportRow, 0),
+	}
+	for i, header := range rows[0] {
+		if columns[i] != "" {
+			response.Columns[header] = columns[i]
+		} else if header != "" {
+			response.Ignored = append(response.Ignored, header)
+		}
+	}
+
+	var accepted []ImportRow
+	var writes []bulkWrite
+	for i, row := range rows[1:] {
+		if blankRow(row) {
+			continue
+		}
+		response.Rows++
+
+		number := i + 2
+		log, errs := rowLog(s.Config.AccidentTypes, columns, row)
+		if len(errs) == 0 && r.Validate != nil {
+			errs = r.Validate(s, log.Patch(), true)
+		}
+		if len(errs) > 0 {
+			response.Rejected = append(response.Rejected, ImportRow{Row: number, Error: "Invalid log", Fields: errs})
+			continue
+		}
+		accepted = append(accepted, ImportRow{Row: number, Log: &log})
+		writes = append(writes, bulkWrite{op: OpCreate, log: log})
+	}
+
+	if response.DryRun {
+		response.Accepted = append(response.Accepted, accepted...)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	results := make([]BulkResult, len(writes))
+	s.runBulkWrites(c.Request.Context(), r, client, writes, results, defaultBulkConcurrency, false)
+	s.publishResults(r, client, results)
+	for i, result := range results {
+		row := accepted[i]
+		row.Status = result.Status
+		if !result.succeeded() {
+			row.Error = result.Error
+			response.Rejected = append(response.Rejected, row)
+			continue
+		}
+		row.ID = result.ID
+		response.Accepted = append(response.Accepted, row)
+	}
+
+	status := http.StatusOK
+	if len(response.Rejected) > 0 {
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, response)
+}
+
+// readRows reads a CSV file, or the first sheet of an XLSX file, by its
+// extension.
+func readRows(f io.Reader, filename string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(f)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		return rows, nil
+	case ".xlsx":
+		book, err := excelize.OpenReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read XLSX: %w", err)
+		}
+		defer book.Close()
+		rows, err := book.GetRows(book.GetSheetName(0))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read XLSX: %w", err)
+		}
+		return rows, nil
+	default:
+		return nil, errors.New("only .csv and .xlsx files can be imported")
+	}
+}
+
+// mapColumns returns the log field each header column fills, "" for
+// columns that are ignored. mapping takes precedence over names and
+// aliases; mapping a header to "" ignores it.
+func mapColumns(headers []string, mapping map[string]string) ([]string, error) {
+	for header, field := range mapping {
+		if field != "" && !slices.Contains(importFields, field) {
+			return nil, fmt.Errorf("mapping for %q: unknown field %q (want one of %s)", header, field, strings.Join(importFields, ", "))
+		}
+	}
+
+	columns := make([]string, len(headers))
+	used := map[string]string{}
+	for i, header := range headers {
+		field, ok := mapping[header]
+		if !ok {
+			key := strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(header)))
+			if slices.Contains(importFields, key) {
+				field = key
+			} else {
+				field = importAliases[key]
+			}
+		}
+		if field == "" {
+			continue
+		}
+		if other, ok := used[field]; ok {
+			return nil, fmt.Errorf("columns %q and %q both map to %s", other, header, field)
+		}
+		used[field] = header
+		columns[i] = field
+	}
+	return columns, nil
+}
+
+// rowLog builds a log from one row, reporting values that do not parse.
+func rowLog(types Taxonomy, columns []string, row []string) (procore.Log, ValidationErrors) {
+	var log procore.Log
+	var errs ValidationErrors
+	for i, field := range columns {
+		if field == "" || i >= len(row) {
+			continue
+		}
+		value := strings.TrimSpace(row[i])
+		switch field {
+		case "comments":
+			log.Comments = value
+		case "date":
+			date, ok := importDate(value)
+			if !ok {
+				errs.add(field, "must be a date in YYYY-MM-DD format")
+			}
+			log.Date = date
+		case "datetime":
+			log.Datetime = value
+		case "involved_company":
+			log.InvolvedCompany = value
+		case "involved_name":
+			log.InvolvedName = value
+		case "time_hour", "time_minute":
+			n := 0
+			if value != "" {
+				var err error
+				if n, err = strconv.Atoi(value); err != nil {
+					errs.add(field, "must be a number")
+				}
+			}
+			if field == "time_hour" {
+				log.TimeHour = n
+			} else {
+				log.TimeMinute = n
+			}
+		case "severity":
+			log.Severity = strings.ToLower(value)
+		case "location":
+			log.Location = value
+		case "type":
+			log.Type = types.resolve(value)
+		}
+	}
+	return log, errs
+}
+
+// importDate normalizes a spreadsheet date to DateLayout. Besides the
+// formats in importDateLayouts it accepts Excel's numeric date serials.
+func importDate(value string) (string, bool) {
+	if value == "" {
+		return "", true
+	}
+	for _, layout := range append([]string{DateLayout}, importDateLayouts...) {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(DateLayout), true
+		}
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil {
+		if t, err := excelize.ExcelDateToTime(serial, false); err == nil {
+			return t.Format(DateLayout), true
+		}
+	}
+	return value, false
+}
+
+func blankRow(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestMapColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		mapping map[string]string
+		want    []string
+		err     bool
+	}{
+		{"field names", []string{"date", "Involved Name", "involved-company", " TIME_HOUR "}, nil, []string{"date", "involved_name", "involved_company", "time_hour"}, false},
+		{"aliases", []string{"Person", "Notes", "Category", "Hour"}, nil, []string{"involved_name", "comments", "type", "time_hour"}, false},
+		{"unknown headers", []string{"date", "Foreman", ""}, nil, []string{"date", "", ""}, false},
+		{"mapping", []string{"Injured person", "Name"}, map[string]string{"Injured person": "involved_name", "Name": ""}, []string{"involved_name", ""}, false},
+		{"mapping wins over a name", []string{"date", "When"}, map[string]string{"date": "", "When": "date"}, []string{"", "date"}, false},
+		{"unknown mapped field", []string{"date"}, map[string]string{"date": "when"}, nil, true},
+		{"two columns for a field", []string{"Name", "Person"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := mapColumns(tt.headers, tt.mapping)
+		if (err != nil) != tt.err || !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mapColumns = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestImportDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"", "", true},
+		{"2024-03-01", "2024-03-01", true},
+		{"3/1/2024", "2024-03-01", true},
+		{"03/01/2024", "2024-03-01", true},
+		{"2024/03/01", "2024-03-01", true},
+		{"03-01-24", "2024-03-01", true},
+		{"1-Mar-2024", "2024-03-01", true},
+		{"45352", "2024-03-01", true},
+		{"45352.75", "2024-03-01", true},
+		{"yesterday", "yesterday", false},
+	}
+	for _, tt := range tests {
+		if got, ok := importDate(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("importDate(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// importAPI is Procore's accident log create endpoint. It rejects logs
+// located at "closed" and adds the others to created.
+func importAPI(created *[]map[string]string) *apiStub {
+	return &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		if req.PostForm.Get("accident_log[location]") == "closed" {
+			http.Error(w, `{"errors":"location closed"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		*created = append(*created, map[string]string{
+			"date":     req.PostForm.Get("accident_log[date]"),
+			"name":     req.PostForm.Get("accident_log[involved_name]"),
+			"comments": req.PostForm.Get("accident_log[comments]"),
+		})
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}}
+}
+
+func importFile(t *testing.T, created *[]map[string]string, filename string, content []byte, fields map[string]string) (int, ImportResponse) {
+	t.Helper()
+	router := newTestRouter(t, importAPI(created), AccidentLogs)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", filename)
+	part.Write(content)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/accident-logs/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response ImportResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+const importCSV = `Date,Injured person,Category,Location,Foreman
+2024-03-01,Jane,Slip,north gate,Bob
+,,,,
+3/2/2024,,fall,north gate,Bob
+tomorrow,Joe,,north gate,Bob
+2024-03-04,Ann,,closed,Bob
+`
+
+func TestImportDryRun(t *testing.T) {
+	var created []map[string]string
+	status, response := importFile(t, &created, "logs.csv", []byte(importCSV), map[string]string{
+		"dry_run": "true",
+		"mapping": `{"Injured person":"involved_name"}`,
+	})
+
+	if status != http.StatusOK || !response.DryRun || len(created) != 0 {
+		t.Fatalf("status %d, dry run %v, created %v", status, response.DryRun, created)
+	}
+	wantColumns := map[string]string{"Date": "date", "Injured person": "involved_name", "Category": "type", "Location": "location"}
+	if !reflect.DeepEqual(response.Columns, wantColumns) || !reflect.DeepEqual(response.Ignored, []string{"Foreman"}) {
+		t.Errorf("columns %v, ignored %v", response.Columns, response.Ignored)
+	}
+	if response.Rows != 4 || len(response.Accepted) != 2 || len(response.Rejected) != 2 {
+		t.Fatalf("rows %d, accepted %+v, rejected %+v", response.Rows, response.Accepted, response.Rejected)
+	}
+	if row := response.Accepted[0]; row.Row != 2 || row.Log.InvolvedName != "Jane" || row.Log.Date != "2024-03-01" {
+		t.Errorf("first accepted row = %+v %+v", row, row.Log)
+	}
+	rejected := map[int][]string{}
+	for _, row := range response.Rejected {
+		rejected[row.Row] = fieldNames(row.Fields)
+	}
+	if want := map[int][]string{4: {"involved_name"}, 5: {"date"}}; !reflect.DeepEqual(rejected, want) {
+		t.Errorf("rejected rows %v, want %v", rejected, want)
+	}
+}
+
+func TestImportCreates(t *testing.T) {
+	var created []map[string]string
+	status, response := importFile(t, &created, "logs.CSV", []byte(importCSV), map[string]string{
+		"mapping": `{"Injured person":"involved_name"}`,
+	})
+
+	if status != http.StatusMultiStatus || len(response.Accepted) != 1 || len(response.Rejected) != 3 {
+		t.Fatalf("status %d, accepted %+v, rejected %+v", status, response.Accepted, response.Rejected)
+	}
+	if len(created) != 1 || created[0]["name"] != "Jane" || !strings.Contains(created[0]["comments"], "slip_trip_fall") {
+		t.Errorf("created %v", created)
+	}
+	last := response.Rejected[len(response.Rejected)-1]
+	if last.Row != 6 || last.Status != http.StatusUnprocessableEntity || !strings.Contains(last.Error, "location closed") {
+		t.Errorf("row Procore rejected = %+v", last)
+	}
+}
+
+func TestImportXLSX(t *testing.T) {
+	book := excelize.NewFile()
+	sheet := book.GetSheetName(0)
+	book.SetSheetRow(sheet, "A1", &[]interface{}{"Date", "Name", "Hour"})
+	// A date cell without a number format comes back as Excel's serial.
+	book.SetSheetRow(sheet, "A2", &[]interface{}{45352, "Jane", 9})
+	var content bytes.Buffer
+	if err := book.Write(&content); err != nil {
+		t.Fatal(err)
+	}
+
+	var created []map[string]string
+	status, response := importFile(t, &created, "logs.xlsx", content.Bytes(), map[string]string{"dry_run": "true"})
+	if status != http.StatusOK || len(response.Accepted) != 1 {
+		t.Fatalf("status %d, response %+v", status, response)
+	}
+	if log := response.Accepted[0].Log; log.Date != "2024-03-01" || log.InvolvedName != "Jane" || log.TimeHour != 9 {
+		t.Errorf("log = %+v", log)
+	}
+}
+
+func TestImportRejectsFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		fields   map[string]string
+	}{
+		{"other extension", "logs.txt", "date\n2024-03-01\n", nil},
+		{"empty file", "logs.csv", "", nil},
+		{"bad mapping", "logs.csv", "date\n", map[string]string{"mapping": "[1]"}},
+		{"mapping to an unknown field", "logs.csv", "date\n", map[string]string{"mapping": `{"date":"when"}`}},
+	}
+	for _, tt := range tests {
+		if status, _ := importFile(t, new([]map[string]string), tt.filename, []byte(tt.content), tt.fields); status != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tt.name, status)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"procore-common/mirror"
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sources of a read, reported in the SourceHeader.
+const (
+	SourceLive  = "live"
+	SourceCache = "cache"
+	// SourceMixed is an aggregate read served partly from each.
+	SourceMixed = "mixed"
+)
+
+const (
+	// SourceHeader says whether a read came from Procore or the mirror.
+	SourceHeader = "X-Data-Source"
+	// SyncedAtHeader is when the data served was last fetched from Procore.
+	SyncedAtHeader = "X-Data-Synced-At"
+)
+
+const (
+	// DefaultMirrorMaxAge is the staleness window when MIRROR_MAX_AGE is
+	// not set.
+	DefaultMirrorMaxAge = 5 * time.Minute
+	// mirrorRefreshTimeout bounds a background refresh.
+	mirrorRefreshTimeout = 5 * time.Minute
+)
+
+// Mirror serves log reads from a local copy of each project's logs. A copy
+// younger than MaxAge is served as it is, and refreshed in the background
+// once it is past half that age; an older or Stale copy is refreshed
+// before it is served. When Procore cannot be reached, the copy is served
+// whatever its age.
+type Mirror struct {
+	Store  *mirror.Store
+	MaxAge time.Duration
+
+	mu         sync.Mutex
+	refreshing map[mirror.Key]bool
+	// invalidated is when each copy was last invalidated, so a refresh that
+	// raced a write does not pass its copy off as fresh.
+	invalidated map[mirror.Key]time.Time
+
+	// OnChange, when set, is called with what each refresh or sync found
+	// changed.
+	OnChange func(key mirror.Key, changes []mirror.Change)
+}
+
+func NewMirror(store *mirror.Store, maxAge time.Duration) *Mirror {
+	return &Mirror{
+		Store:       store,
+		MaxAge:      maxAge,
+		refreshing:  map[mirror.Key]bool{},
+		invalidated: map[mirror.Key]time.Time{},
+	}
+}
+
+// readInfo describes where a read was served from.
+type readInfo struct {
+	Source   string
+	SyncedAt time.Time
+}
+
+func setSource(c *gin.Context, info readInfo) {
+	c.Header(SourceHeader, info.Source)
+	if !info.SyncedAt.IsZero() {
+		c.Header(SyncedAtHeader, info.SyncedAt.UTC().Format(time.RFC3339))
+	}
+}
+
+func mirrorKey(r *Resource, client *procore.Client) mirror.Key {
+	return mirror.Key{CompanyID: client.CompanyID, ProjectID: client.ProjectID, Resource: r.Name}
+}
+
+// records returns every log of r in the client's project. live skips the
+// copy unless Procore cannot be reached. The caller must be authorized
+// first, see Service.authorize.
+func (m *Mirror) records(ctx context.Context, r *Resource, client *procore.Client, live bool) ([]json.RawMessage, readInfo, error) {
+	key := mirrorKey(r, client)
+	records, meta, ok, err := m.Store.Records(key)
+	if err != nil {
+		return nil, readInfo{}, err
+	}
+	age := time.Since(meta.SyncedAt)
+	if ok && !live && !meta.Stale && age <= m.MaxAge {
+		if age > m.MaxAge/2 {
+			m.refreshLater(key, r, client)
+		}
+		return records, readInfo{Source: SourceCache, SyncedAt: meta.SyncedAt}, nil
+	}
+
+	fresh, syncedAt, err := m.refresh(ctx, key, r, client)
+	if err != nil {
+		if ok && offline(err) {
+			return records, readInfo{Source: SourceCache, SyncedAt: meta.SyncedAt}, nil
+		}
+		return nil, readInfo{}, err
+	}
+	return fresh, readInfo{Source: SourceLive, SyncedAt: syncedAt}, nil
+}
+
+// record looks one log up in the copy. fresh reports whether it may be
+// served without asking Procore; a record that is not fresh is still
+// returned for use when Procore cannot be reached. The caller must be
+// authorized first.
+func (m *Mirror) record(r *Resource, client *procore.Client, id string) (record json.RawMessage, info readInfo, fresh bool) {
+	record, meta, ok, err := m.Store.Record(mirrorKey(r, client), id)
+	if err != nil || !ok {
+		return nil, readInfo{}, false
+	}
+	fresh = !meta.Stale && time.Since(meta.SyncedAt) <= m.MaxAge
+	return record, readInfo{Source: SourceCache, SyncedAt: meta.SyncedAt}, fresh
+}
+
+// refresh replaces the copy of key with every log Procore has. A copy that
+// cannot be written is logged; the logs are returned either way.
+func (m *Mirror) refresh(ctx context.Context, key mirror.Key, r *Resource, client *procore.Client) ([]json.RawMessage, time.Time, error) {
+	started := time.Now()
+	records, _, err := procore.ListPages[json.RawMessage](ctx, client, client.ProjectPath(r.Name), nil, procore.Page{})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	syncedAt := time.Now()
+	if changes, err := m.Store.Replace(key, records, syncedAt); err != nil {
+		log.Printf("mirror: failed to store %s: %v", key, err)
+	} else {
+		m.changed(key, changes)
+	}
+
+	m.mu.Lock()
+	raced := m.invalidated[key].After(started)
+	m.mu.Unlock()
+	if raced {
+		m.Invalidate(key)
+	}
+	return records, syncedAt, nil
+}
+
+// refreshLater refreshes key in the background, once at a time.
+func (m *Mirror) refreshLater(key mirror.Key, r *Resource, client *procore.Client) {
+	m.mu.Lock()
+	if m.refreshing[key] {
+		m.mu.Unlock()
+		return
+	}
+	m.refreshing[key] = true
+	m.mu.Unlock()
+
+	go func() {
+		defer func() {
+			m.mu.Lock()
+			delete(m.refreshing, key)
+			m.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), mirrorRefreshTimeout)
+		defer cancel()
+		if _, _, err := m.refresh(ctx, key, r, client); err != nil {
+			log.Printf("mirror: background refresh of %s failed: %v", key, err)
+		}
+	}()
+}
+
+func (m *Mirror) changed(key mirror.Key, changes []mirror.Change) {
+	if m.OnChange != nil && len(changes) > 0 {
+		m.OnChange(key, changes)
+	}
+}
+
+// Invalidate marks the copy of a log type Stale after a write.
+func (m *Mirror) Invalidate(key mirror.Key) {
+	m.mu.Lock()
+	m.invalidated[key] = time.Now()
+	m.mu.Unlock()
+	if err := m.Store.Invalidate(key); err != nil {
+		log.Printf("mirror: failed to invalidate %s: %v", key, err)
+	}
+}
+
+// offline reports whether err means Procore could not be reached, rather
+// than that it refused the request.
+func offline(err error) bool {
+	var apiErr *procore.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
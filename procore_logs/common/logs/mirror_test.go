@@ -0,0 +1,152 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"procore-common/mirror"
+)
+
+// mirrorAPI is Procore with one call log in project 2 that reads "live".
+func mirrorAPI() *apiStub {
+	return &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/rest/v1.0/projects":
+			w.Write([]byte(`[{"id":2,"name":"Two"}]`))
+		case "/rest/v1.0/projects/2/call_logs":
+			w.Write([]byte(`[{"id":1,"comments":"live"}]`))
+		case "/rest/v1.0/projects/2/call_logs/1":
+			w.Write([]byte(`{"id":1,"comments":"live"}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}}
+}
+
+// mirrored sets a mirror up in a temporary directory that serves copies
+// up to maxAge old.
+func mirrored(t *testing.T, maxAge time.Duration) func(*Config) {
+	return func(cfg *Config) {
+		cfg.MirrorPath = filepath.Join(t.TempDir(), "mirror.db")
+		cfg.MirrorMaxAge = maxAge
+	}
+}
+
+// seedMirror stores a copy of project 2's call logs that reads "cached",
+// synced at syncedAt.
+func seedMirror(t *testing.T, s *Service, syncedAt time.Time) {
+	t.Helper()
+	key := mirror.Key{CompanyID: "1", ProjectID: "2", Resource: CallLogs.Name}
+	if _, err := s.Mirror.Store.Replace(key, []json.RawMessage{json.RawMessage(`{"id":1,"comments":"cached"}`)}, syncedAt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// logReads returns the requests stub received for logs, leaving out the
+// project listings that check the caller's access.
+func logReads(stub *apiStub) []stubRequest {
+	var reads []stubRequest
+	for _, req := range stub.sent() {
+		if req.Path != "/rest/v1.0/projects" {
+			reads = append(reads, req)
+		}
+	}
+	return reads
+}
+
+// comments reads the comments of the logs a List or Details response holds.
+func comments(t *testing.T, body []byte) []string {
+	t.Helper()
+	var logs []map[string]interface{}
+	if err := json.Unmarshal(body, &logs); err != nil {
+		var log map[string]interface{}
+		if err := json.Unmarshal(body, &log); err != nil {
+			t.Fatalf("body %s: %v", body, err)
+		}
+		logs = append(logs, log)
+	}
+	var got []string
+	for _, log := range logs {
+		got = append(got, log["comments"].(string))
+	}
+	return got
+}
+
+func TestMirrorServesFreshCopy(t *testing.T) {
+	stub := mirrorAPI()
+	s, router := newTestService(t, stub, CallLogs, mirrored(t, time.Hour))
+	syncedAt := time.Now().Add(-time.Minute)
+	seedMirror(t, s, syncedAt)
+
+	for _, target := range []string{"/api/call_logs", "/api/call_logs/1"} {
+		w := serve(router, http.MethodGet, target, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d: %s", target, w.Code, w.Body)
+		}
+		if got := comments(t, w.Body.Bytes()); len(got) != 1 || got[0] != "cached" {
+			t.Errorf("GET %s: comments = %v, want the cached log", target, got)
+		}
+		if source := w.Header().Get(SourceHeader); source != SourceCache {
+			t.Errorf("GET %s: %s = %q, want %q", target, SourceHeader, source, SourceCache)
+		}
+		if synced := w.Header().Get(SyncedAtHeader); synced != syncedAt.UTC().Format(time.RFC3339) {
+			t.Errorf("GET %s: %s = %q, want %s", target, SyncedAtHeader, synced, syncedAt.UTC().Format(time.RFC3339))
+		}
+	}
+	if reads := logReads(stub); len(reads) != 0 {
+		t.Errorf("Procore was asked for %+v, want no log reads", reads)
+	}
+}
+
+func TestMirrorStaleCopyFallsBackToLive(t *testing.T) {
+	tests := []struct {
+		name  string
+		stale func(s *Service)
+	}{
+		{"expired", func(s *Service) { seedMirror(t, s, time.Now().Add(-2*time.Hour)) }},
+		{"invalidated", func(s *Service) {
+			seedMirror(t, s, time.Now())
+			s.Mirror.Invalidate(mirror.Key{CompanyID: "1", ProjectID: "2", Resource: CallLogs.Name})
+		}},
+	}
+	for _, tt := range tests {
+		for _, target := range []string{"/api/call_logs", "/api/call_logs/1"} {
+			stub := mirrorAPI()
+			s, router := newTestService(t, stub, CallLogs, mirrored(t, time.Hour))
+			tt.stale(s)
+
+			w := serve(router, http.MethodGet, target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: GET %s: status = %d: %s", tt.name, target, w.Code, w.Body)
+			}
+			if got := comments(t, w.Body.Bytes()); len(got) != 1 || got[0] != "live" {
+				t.Errorf("%s: GET %s: comments = %v, want the live log", tt.name, target, got)
+			}
+			if source := w.Header().Get(SourceHeader); source != SourceLive {
+				t.Errorf("%s: GET %s: %s = %q, want %q", tt.name, target, SourceHeader, source, SourceLive)
+			}
+			if len(logReads(stub)) == 0 {
+				t.Errorf("%s: GET %s: Procore was not asked", tt.name, target)
+			}
+		}
+	}
+}
+
+func TestMirrorLiveQuerySkipsCopy(t *testing.T) {
+	for _, target := range []string{"/api/call_logs?live=true", "/api/call_logs/1?live=true"} {
+		stub := mirrorAPI()
+		s, router := newTestService(t, stub, CallLogs, mirrored(t, time.Hour))
+		seedMirror(t, s, time.Now())
+
+		w := serve(router, http.MethodGet, target, "")
+		if got := comments(t, w.Body.Bytes()); len(got) != 1 || got[0] != "live" {
+			t.Errorf("GET %s: comments = %v, want the live log", target, got)
+		}
+		if source := w.Header().Get(SourceHeader); source != SourceLive {
+			t.Errorf("GET %s: %s = %q, want %q", target, SourceHeader, source, SourceLive)
+		}
+	}
+}
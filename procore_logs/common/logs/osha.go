@@ -0,0 +1,241 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unspecified labels cases without an accident type or severity.
+const unspecified = "Unspecified"
+
+// OSHACase is one line of the injury and illness log, after OSHA Form 300.
+type OSHACase struct {
+	CaseNumber   int    `json:"case_number"`
+	LogID        int    `json:"accident_log_id"`
+	Date         string `json:"date"`
+	Time         string `json:"time"`
+	InvolvedName string `json:"involved_name"`
+	Company      string `json:"involved_company"`
+	Location     string `json:"location"`
+	AccidentType string `json:"accident_type"`
+	Severity     string `json:"severity"`
+	Description  string `json:"description"`
+}
+
+// OSHAGroup counts the cases sharing a type, a severity or both.
+type OSHAGroup struct {
+	AccidentType string `json:"accident_type,omitempty"`
+	Severity     string `json:"severity,omitempty"`
+	Cases        int    `json:"cases"`
+}
+
+// OSHASummary totals the log, after OSHA Form 300A.
+type OSHASummary struct {
+	TotalCases        int         `json:"total_cases"`
+	ByType            []OSHAGroup `json:"by_type"`
+	BySeverity        []OSHAGroup `json:"by_severity"`
+	ByTypeAndSeverity []OSHAGroup `json:"by_type_and_severity"`
+}
+
+type OSHAReport struct {
+	ProjectID   string      `json:"project_id"`
+	ProjectName string      `json:"project_name"`
+	StartDate   string      `json:"start_date"`
+	EndDate     string      `json:"end_date"`
+	Cases       []OSHACase  `json:"cases"`
+	Summary     OSHASummary `json:"summary"`
+}
+
+// OSHA builds an annual injury and illness log and summary from the
+// accident logs of a period: year=2024, or start_date and end_date, and by
+// default the previous calendar year. The other filter parameters narrow
+// the cases. Cases are numbered by date and counted by accident type and
+// severity. format=pdf returns the report as a printable PDF.
+func (s *Service) OSHA(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+
+	filters, ok := parseFilters(c)
+	if !ok {
+		return
+	}
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+	if format != "" && format != FormatPDF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of json, pdf"})
+		return
+	}
+	if year := c.Query("year"); year != "" {
+		if _, err := strconv.Atoi(year); err != nil || len(year) != 4 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "year must be a four-digit year"})
+			return
+		}
+		filters.StartDate, filters.EndDate = year+"-01-01", year+"-12-31"
+	} else if filters.StartDate == "" && filters.EndDate == "" {
+		last := strconv.Itoa(time.Now().Year() - 1)
+		filters.StartDate, filters.EndDate = last+"-01-01", last+"-12-31"
+	}
+
+	records, ok := fetchLogs[map[string]interface{}](c, s, r, client, filters)
+	if !ok {
+		return
+	}
+
+	report := OSHAReport{
+		ProjectID:   client.ProjectID,
+		ProjectName: s.projectName(c, client),
+		StartDate:   filters.StartDate,
+		EndDate:     filters.EndDate,
+		Cases:       make([]OSHACase, 0),
+	}
+	for _, record := range filters.filter(records) {
+		log := recordLog(record)
+		if (filters.StartDate != "" && log.Date < filters.StartDate) || (filters.EndDate != "" && log.Date > filters.EndDate) {
+			continue
+		}
+		_, description := splitType(log.Comments)
+		report.Cases = append(report.Cases, OSHACase{
+			LogID:        log.ID,
+			Date:         log.Date,
+			Time:         clockTime(log.TimeHour, log.TimeMinute),
+			InvolvedName: log.InvolvedName,
+			Company:      log.InvolvedCompany,
+			Location:     log.Location,
+			AccidentType: firstNonEmpty(s.Config.AccidentTypes.label(log.Type), unspecified),
+			Severity:     firstNonEmpty(log.Severity, unspecified),
+			Description:  description,
+		})
+	}
+	sort.SliceStable(report.Cases, func(i, j int) bool {
+		a, b := report.Cases[i], report.Cases[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return a.LogID < b.LogID
+	})
+	for i := range report.Cases {
+		report.Cases[i].CaseNumber = i + 1
+	}
+	report.Summary = summarizeCases(report.Cases)
+
+	if format == FormatPDF {
+		writeOSHAPDF(c, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// summarizeCases counts cases per type, per severity and per pair, largest
+// groups first.
+func summarizeCases(cases []OSHACase) OSHASummary {
+	byType := map[string]int{}
+	bySeverity := map[string]int{}
+	byPair := map[[2]string]int{}
+	for _, c := range cases {
+		byType[c.AccidentType]++
+		bySeverity[c.Severity]++
+		byPair[[2]string{c.AccidentType, c.Severity}]++
+	}
+
+	summary := OSHASummary{TotalCases: len(cases)}
+	for name, n := range byType {
+		summary.ByType = append(summary.ByType, OSHAGroup{AccidentType: name, Cases: n})
+	}
+	for name, n := range bySeverity {
+		summary.BySeverity = append(summary.BySeverity, OSHAGroup{Severity: name, Cases: n})
+	}
+	for pair, n := range byPair {
+		summary.ByTypeAndSeverity = append(summary.ByTypeAndSeverity, OSHAGroup{AccidentType: pair[0], Severity: pair[1], Cases: n})
+	}
+	for _, groups := range [][]OSHAGroup{summary.ByType, summary.BySeverity, summary.ByTypeAndSeverity} {
+		sort.Slice(groups, func(i, j int) bool {
+			if groups[i].Cases != groups[j].Cases {
+				return groups[i].Cases > groups[j].Cases
+			}
+			if groups[i].AccidentType != groups[j].AccidentType {
+				return groups[i].AccidentType < groups[j].AccidentType
+			}
+			return groups[i].Severity < groups[j].Severity
+		})
+	}
+	if summary.ByType == nil {
+		summary.ByType, summary.BySeverity, summary.ByTypeAndSeverity = []OSHAGroup{}, []OSHAGroup{}, []OSHAGroup{}
+	}
+	return summary
+}
+
+func writeOSHAPDF(c *gin.Context, report OSHAReport) {
+	project := report.ProjectID
+	if report.ProjectName != "" {
+		project = report.ProjectName + " (" + report.ProjectID + ")"
+	}
+	pdf := newPDFReport("Injury and Illness Summary", [][2]string{
+		{"Project", project},
+		{"Period", report.StartDate + " to " + report.EndDate},
+		{"Total cases", strconv.Itoa(report.Summary.TotalCases)},
+		{"Generated", time.Now().Format("2006-01-02 15:04 MST")},
+	})
+
+	pdf.Heading("Cases by type")
+	pdf.Table([]string{"Accident type", "Cases"}, []float64{4, 1})
+	for _, g := range report.Summary.ByType {
+		pdf.Row([]string{g.AccidentType, strconv.Itoa(g.Cases)})
+	}
+
+	pdf.Heading("Cases by severity")
+	pdf.Table([]string{"Severity", "Cases"}, []float64{4, 1})
+	for _, g := range report.Summary.BySeverity {
+		pdf.Row([]string{g.Severity, strconv.Itoa(g.Cases)})
+	}
+
+	pdf.Heading("Cases by type and severity")
+	pdf.Table([]string{"Accident type", "Severity", "Cases"}, []float64{3, 2, 1})
+	for _, g := range report.Summary.ByTypeAndSeverity {
+		pdf.Row([]string{g.AccidentType, g.Severity, strconv.Itoa(g.Cases)})
+	}
+
+	pdf.Heading("Log of cases")
+	pdf.Table(
+		[]string{"Case", "Date", "Time", "Name", "Company", "Location", "Type", "Severity", "Description"},
+		[]float64{0.5, 1, 0.6, 1.4, 1.4, 1.2, 1.2, 0.8, 3},
+	)
+	for _, cs := range report.Cases {
+		pdf.Row([]string{
+			strconv.Itoa(cs.CaseNumber), cs.Date, cs.Time, cs.InvolvedName, cs.Company,
+			cs.Location, cs.AccidentType, cs.Severity, cs.Description,
+		})
+	}
+
+	startDownload(c, exportReport{Title: "osha summary " + report.StartDate + " " + report.EndDate}, "application/pdf", FormatPDF)
+	if err := pdf.Output(c.Writer); err != nil {
+		c.Error(err)
+	}
+}
+
+// recordLog reads the Log fields of a generic record.
+func recordLog(record map[string]interface{}) procore.Log {
+	var log procore.Log
+	if data, err := json.Marshal(record); err == nil {
+		json.Unmarshal(data, &log)
+	}
+	return log
+}
+
+func clockTime(hour, minute int) string {
+	return fmt.Sprintf("%02d:%02d", hour, minute)
+}
@@ -0,0 +1,103 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const oshaLogs = `[
+	{"id":5,"date":"2023-06-01","time_hour":14,"time_minute":5,"involved_name":"Joe","severity":"high","comments":"[AccidentType: slip_trip_fall] wet floor"},
+	{"id":3,"date":"2023-02-10","time_hour":9,"involved_name":"Ann","severity":"low","comments":"[AccidentType: slip_trip_fall] ice"},
+	{"id":4,"date":"2023-02-10","time_hour":8,"involved_name":"Bob","comments":"no type"},
+	{"id":6,"date":"2023-06-01","time_hour":14,"time_minute":5,"involved_name":"Sue","severity":"high","comments":"[AccidentType: slip_trip_fall]"},
+	{"id":1,"date":"2022-12-31","involved_name":"Old","severity":"high"},
+	{"id":2,"date":"2024-01-01","involved_name":"New","severity":"high"}
+]`
+
+func oshaRequest(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	router := newTestRouter(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/rest/v1.0/projects/2/accident_logs":
+			w.Write([]byte(oshaLogs))
+		case "/rest/v1.0/projects/2":
+			w.Write([]byte(`{"id":2,"name":"Tower"}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}), AccidentLogs)
+	return serve(router, http.MethodGet, "/api/accident-logs/osha?"+query, "")
+}
+
+func TestOSHA(t *testing.T) {
+	w := oshaRequest(t, "year=2023")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var report OSHAReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.StartDate != "2023-01-01" || report.EndDate != "2023-12-31" {
+		t.Errorf("period %s to %s", report.StartDate, report.EndDate)
+	}
+
+	var order []int
+	for i, c := range report.Cases {
+		order = append(order, c.LogID)
+		if c.CaseNumber != i+1 {
+			t.Errorf("case %d has number %d", i, c.CaseNumber)
+		}
+	}
+	if want := []int{4, 3, 5, 6}; !reflect.DeepEqual(order, want) {
+		t.Errorf("cases %v, want %v by date, time and id", order, want)
+	}
+	if c := report.Cases[0]; c.AccidentType != unspecified || c.Severity != unspecified || c.Time != "08:00" {
+		t.Errorf("case without a type = %+v", c)
+	}
+	if c := report.Cases[2]; c.AccidentType != "Slip, trip or fall" || c.Description != "wet floor" {
+		t.Errorf("typed case = %+v", c)
+	}
+
+	slip := "Slip, trip or fall"
+	want := OSHASummary{
+		TotalCases: 4,
+		ByType:     []OSHAGroup{{AccidentType: slip, Cases: 3}, {AccidentType: unspecified, Cases: 1}},
+		BySeverity: []OSHAGroup{{Severity: "high", Cases: 2}, {Severity: unspecified, Cases: 1}, {Severity: "low", Cases: 1}},
+		ByTypeAndSeverity: []OSHAGroup{
+			{AccidentType: slip, Severity: "high", Cases: 2},
+			{AccidentType: slip, Severity: "low", Cases: 1},
+			{AccidentType: unspecified, Severity: unspecified, Cases: 1},
+		},
+	}
+	if !reflect.DeepEqual(report.Summary, want) {
+		t.Errorf("summary = %+v, want %+v", report.Summary, want)
+	}
+}
+
+func TestOSHAEmpty(t *testing.T) {
+	w := oshaRequest(t, "year=2020")
+	var report OSHAReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || report.Cases == nil || len(report.Cases) != 0 || report.Summary.ByType == nil {
+		t.Errorf("status %d, body %s; want an empty report", w.Code, w.Body)
+	}
+}
+
+func TestOSHAFormat(t *testing.T) {
+	for _, format := range []string{"pdf", "PDF"} {
+		w := oshaRequest(t, "year=2023&format="+format)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF")) {
+			t.Errorf("format=%s: status %d, content type %s", format, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+	for _, query := range []string{"format=csv", "format=xlsx", "format=docx", "year=23"} {
+		if w := oshaRequest(t, query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+		}
+	}
+}
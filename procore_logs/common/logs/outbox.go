@@ -0,0 +1,484 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"procore-common/mirror"
+	"procore-common/outbox"
+	"procore-common/procore"
+	"procore-common/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyHeader lets a caller name a write, so sending it twice, or
+// queueing it twice while Procore is unreachable, applies it once.
+const IdempotencyHeader = "Idempotency-Key"
+
+// BaseUpdatedAtHeader carries the updated_at of the log an update or delete
+// was made against, so a queued write is not replayed over changes made in
+// Procore after the caller read the log.
+const BaseUpdatedAtHeader = "X-Base-Updated-At"
+
+const (
+	// DefaultOutboxRetryInterval is how often queued writes are replayed
+	// when OUTBOX_RETRY_INTERVAL is not set.
+	DefaultOutboxRetryInterval = 30 * time.Second
+	// outboxMaxAttempts is how many times a write is tried against an
+	// unreachable Procore before it is marked failed.
+	outboxMaxAttempts = 10
+	// outboxMaxBackoff caps the wait between attempts.
+	outboxMaxBackoff = time.Hour
+	// outboxReplayTimeout bounds one replayed write.
+	outboxReplayTimeout = time.Minute
+)
+
+// idempotencyKey returns the caller's Idempotency-Key, or a new one when
+// the write may have to be queued.
+func (s *Service) idempotencyKey(c *gin.Context) string {
+	key := c.GetHeader(IdempotencyHeader)
+	if key == "" && s.Outbox != nil {
+		key, _ = procore.RandomString(16)
+	}
+	return key
+}
+
+// unreachable reports whether a write failed because Procore could not be
+// reached, so it may be queued and replayed.
+func unreachable(resp *http.Response, err error) bool {
+	if err != nil {
+		return offline(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// queueWrite answers a write that could not reach Procore with a 202 for
+// the outbox item it is queued as. body is the log or patch as the caller
+// sent it. It returns false, leaving the response to the caller, when
+// there is no outbox or Procore was reached.
+func (s *Service) queueWrite(c *gin.Context, r *Resource, client *procore.Client, resp *http.Response, err error, item outbox.Item, body interface{}) bool {
+	if s.Outbox == nil || !unreachable(resp, err) {
+		return false
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return true
+		}
+		item.Body = data
+	}
+	item.CompanyID, item.ProjectID, item.Resource = client.CompanyID, client.ProjectID, r.Name
+	if item.LogID != "" {
+		item.BaseUpdatedAt = s.baseUpdatedAt(c, r, client, item.LogID)
+	}
+
+	stored, _, err := s.Outbox.Add(item, s.credentials(c))
+	if errors.Is(err, outbox.ErrKeyReused) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Procore is unreachable and the write could not be queued: " + err.Error()})
+		return true
+	}
+	c.JSON(http.StatusAccepted, gin.H{"queued": true, "outbox": stored})
+	return true
+}
+
+// baseUpdatedAt is the updated_at a queued update or delete of log id is
+// checked against before it is replayed: the one the caller sent, or else
+// the mirror's. Procore cannot be asked, as it is unreachable. "" means
+// unknown, and the write is held as conflicted rather than replayed blind.
+func (s *Service) baseUpdatedAt(c *gin.Context, r *Resource, client *procore.Client, id string) string {
+	if base := c.GetHeader(BaseUpdatedAtHeader); base != "" {
+		return base
+	}
+	if s.Mirror != nil {
+		if record, _, ok, _ := s.Mirror.Store.Record(mirrorKey(r, client), id); ok {
+			return updatedAt(record)
+		}
+	}
+	return ""
+}
+
+// credentials are what a queued write of the caller is replayed with.
+func (s *Service) credentials(c *gin.Context) outbox.Credentials {
+	if id := sessionID(c); id != "" && s.Sessions != nil {
+		return outbox.Credentials{SessionID: id}
+	}
+	return outbox.Credentials{Token: c.GetHeader("Authorization")}
+}
+
+// replayTokens is tokenSource for a queued write; it returns nil when the
+// write has nothing to be sent with.
+func (s *Service) replayTokens(creds outbox.Credentials) procore.TokenSource {
+	switch {
+	case creds.SessionID != "" && s.Sessions != nil:
+		return s.Sessions.TokenSource(creds.SessionID)
+	case creds.Token != "":
+		return procore.StaticToken(creds.Token)
+	}
+	return nil
+}
+
+func updatedAt(record json.RawMessage) string {
+	var head struct {
+		UpdatedAt string `json:"updated_at"`
+	}
+	json.Unmarshal(record, &head)
+	return head.UpdatedAt
+}
+
+// replayOutbox replays due writes every OutboxRetryInterval, and whenever
+// a retry is requested.
+func (s *Service) replayOutbox() {
+	ticker := time.NewTicker(s.Config.OutboxRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.outboxWake:
+		}
+		s.replayDue()
+	}
+}
+
+// wakeOutbox starts a replay pass without waiting for the next tick.
+func (s *Service) wakeOutbox() {
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// replayDue replays the pending writes that are due. Writes to the same
+// log are sent in the order they were queued: once one of them is waiting
+// out a backoff or finds Procore still unreachable, the later ones wait
+// too. Writes to other logs, and creates, do not wait for it.
+func (s *Service) replayDue() {
+	items, err := s.Outbox.Pending()
+	if err != nil {
+		log.Printf("outbox: failed to read pending writes: %v", err)
+		return
+	}
+	blocked := map[string]bool{}
+	for _, item := range items {
+		stream := replayStream(item)
+		if blocked[stream] {
+			continue
+		}
+		// A write sent earlier in this pass may have rebased the item.
+		item, err := s.Outbox.Get(item.ID)
+		if err != nil || item.Status != outbox.StatusPending {
+			continue
+		}
+		if item.NextAttemptAt.After(time.Now()) {
+			blocked[stream] = true
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), outboxReplayTimeout)
+		reached := s.replay(ctx, item)
+		cancel()
+		if !reached {
+			blocked[stream] = true
+		}
+	}
+}
+
+// replayStream names the writes item must be replayed in order with: those
+// to the same log. A create has no log yet, so it is a stream of its own.
+func replayStream(item outbox.Item) string {
+	if item.Op == outbox.OpCreate {
+		return "create/" + strconv.FormatUint(item.ID, 10)
+	}
+	return strings.Join([]string{item.CompanyID, item.ProjectID, item.Resource, item.LogID}, "/")
+}
+
+// replay sends one queued write and records the outcome. It returns false
+// when Procore could not be reached.
+func (s *Service) replay(ctx context.Context, item outbox.Item) bool {
+	r := s.resource(item.Resource)
+	if r == nil {
+		s.settle(item, outbox.StatusFailed, "unknown log type "+item.Resource, nil)
+		return true
+	}
+	creds, err := s.Outbox.Credentials(item.ID)
+	if err != nil {
+		s.settle(item, outbox.StatusFailed, err.Error()+"; retry the write to send it with your credentials", nil)
+		return true
+	}
+	tokens := s.replayTokens(creds)
+	if tokens == nil {
+		s.settle(item, outbox.StatusFailed, "no credentials to replay the write with; retry it to use yours", nil)
+		return true
+	}
+	client := procore.NewClient(s.Config.Environment.RestURL(), item.CompanyID, item.ProjectID, tokens)
+	ctx = procore.WithIdempotencyToken(ctx, item.IdempotencyKey)
+
+	if item.Op != outbox.OpCreate && !item.Force {
+		var current json.RawMessage
+		resp, err := r.LogResource.Get(ctx, client, item.LogID)
+		if err == nil {
+			err = procore.DecodeResponse(resp, &current)
+		}
+		var apiErr *procore.APIError
+		switch {
+		case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+			if item.Op == outbox.OpDelete {
+				s.settle(item, outbox.StatusSent, "", nil)
+			} else {
+				s.settle(item, outbox.StatusConflicted, "the log was deleted in Procore", nil)
+			}
+			return true
+		case err != nil:
+			return s.failed(item, err)
+		case item.BaseUpdatedAt == "":
+			s.settle(item, outbox.StatusConflicted, "the version of the log the write was made against is unknown", current)
+			return true
+		case updatedAt(current) != item.BaseUpdatedAt:
+			s.settle(item, outbox.StatusConflicted, "the log was changed in Procore after the write was queued", current)
+			return true
+		}
+	}
+
+	resp, err := s.send(ctx, r, client, item)
+	if err != nil {
+		return s.failed(item, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return s.failed(item, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return s.failed(item, &procore.APIError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	if !json.Valid(body) {
+		body = nil
+	}
+	s.settle(item, outbox.StatusSent, "", body)
+	if item.Op == outbox.OpUpdate {
+		s.rebase(item, updatedAt(body))
+	}
+	switch item.Op {
+	case outbox.OpCreate:
+		s.publishRaw(r, client, mirror.Created, SourceGateway, "", body)
+	case outbox.OpUpdate:
+		s.publishRaw(r, client, mirror.Updated, SourceGateway, item.LogID, body)
+	default:
+		s.publishDeleted(r, client, item.LogID)
+	}
+	if s.Mirror != nil {
+		s.Mirror.Invalidate(mirrorKey(r, client))
+	}
+	return true
+}
+
+// rebase moves the writes queued after item to the same log onto
+// version, the updated_at Procore answered item with, so they are not
+// taken for conflicts with it. Only writes made against the version item
+// was made against move; those made against another version, or an
+// unknown one, are still checked as they were queued.
+func (s *Service) rebase(item outbox.Item, version string) {
+	if version == "" || item.BaseUpdatedAt == "" {
+		return
+	}
+	items, err := s.Outbox.Pending()
+	if err != nil {
+		log.Printf("outbox: failed to rebase the writes after %d: %v", item.ID, err)
+		return
+	}
+	stream := replayStream(item)
+	for _, next := range items {
+		if next.ID < item.ID || replayStream(next) != stream || next.BaseUpdatedAt != item.BaseUpdatedAt {
+			continue
+		}
+		next.BaseUpdatedAt = version
+		if err := s.Outbox.Update(next); err != nil {
+			log.Printf("outbox: failed to update %d: %v", next.ID, err)
+		}
+	}
+}
+
+// send is the write of Create, Update or Delete for a queued item.
+func (s *Service) send(ctx context.Context, r *Resource, client *procore.Client, item outbox.Item) (*http.Response, error) {
+	switch item.Op {
+	case outbox.OpCreate:
+		var logData procore.Log
+		if err := json.Unmarshal(item.Body, &logData); err != nil {
+			return nil, err
+		}
+		s.encodeLog(r, &logData)
+		return r.LogResource.Create(ctx, client, logData)
+	case outbox.OpUpdate:
+		var patch procore.LogPatch
+		if err := json.Unmarshal(item.Body, &patch); err != nil {
+			return nil, err
+		}
+		if err := s.encodePatch(ctx, r, client, item.LogID, &patch); err != nil {
+			return nil, err
+		}
+		return r.LogResource.Update(ctx, client, item.LogID, patch)
+	default:
+		return r.LogResource.Delete(ctx, client, item.LogID)
+	}
+}
+
+// failed records a failed attempt. A write that could not reach Procore is
+// tried again after a backoff, until it runs out of attempts; any other
+// failure is final. It returns whether Procore was reached.
+func (s *Service) failed(item outbox.Item, err error) bool {
+	item.Attempts++
+	message := err.Error()
+	var apiErr *procore.APIError
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) || errors.Is(err, session.ErrExpired) {
+		message += "; retry the write to send it with your credentials"
+	}
+
+	if !offline(err) {
+		s.settle(item, outbox.StatusFailed, message, nil)
+		return true
+	}
+	if item.Attempts >= outboxMaxAttempts {
+		s.settle(item, outbox.StatusFailed, message, nil)
+		return false
+	}
+	backoff := s.Config.OutboxRetryInterval << (item.Attempts - 1)
+	if backoff > outboxMaxBackoff || backoff <= 0 {
+		backoff = outboxMaxBackoff
+	}
+	item.NextAttemptAt = time.Now().Add(backoff)
+	item.Error = message
+	if err := s.Outbox.Update(item); err != nil {
+		log.Printf("outbox: failed to update %d: %v", item.ID, err)
+	}
+	return false
+}
+
+// settle records the final outcome of a write.
+func (s *Service) settle(item outbox.Item, status, message string, result json.RawMessage) {
+	item.Status, item.Error, item.Result = status, message, result
+	if err := s.Outbox.Update(item); err != nil {
+		log.Printf("outbox: failed to update %d: %v", item.ID, err)
+	}
+}
+
+// outboxItem reads the :id of an outbox route, writing the error response
+// when it names no item of the caller's project.
+func (s *Service) outboxItem(c *gin.Context, client *procore.Client) (outbox.Item, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outbox item ID"})
+		return outbox.Item{}, false
+	}
+	item, err := s.Outbox.Get(id)
+	if errors.Is(err, outbox.ErrNotFound) || (err == nil && (item.CompanyID != client.CompanyID || item.ProjectID != client.ProjectID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": outbox.ErrNotFound.Error()})
+		return outbox.Item{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return outbox.Item{}, false
+	}
+	return item, true
+}
+
+// outboxClient is newClient for the outbox routes, which need the outbox
+// enabled and the caller's access to the project checked.
+func (s *Service) outboxClient(c *gin.Context) (*procore.Client, bool) {
+	if s.Outbox == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OUTBOX_PATH is not configured"})
+		return nil, false
+	}
+	return s.projectClient(c)
+}
+
+// ListOutbox returns the queued writes of the project, optionally only
+// those with a status in status, e.g. status=failed,conflicted.
+func (s *Service) ListOutbox(c *gin.Context) {
+	client, ok := s.outboxClient(c)
+	if !ok {
+		return
+	}
+	statuses := splitIDs(c.Query("status"))
+	items, err := s.Outbox.List(func(item outbox.Item) bool {
+		return item.CompanyID == client.CompanyID && item.ProjectID == client.ProjectID &&
+			(len(statuses) == 0 || slices.Contains(statuses, item.Status))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// RetryOutbox queues a failed or conflicted write again, to be sent with
+// the caller's credentials. force=true sends a conflicted write over the
+// changes made in Procore.
+func (s *Service) RetryOutbox(c *gin.Context) {
+	client, ok := s.outboxClient(c)
+	if !ok {
+		return
+	}
+	item, ok := s.outboxItem(c, client)
+	if !ok {
+		return
+	}
+	if item.Status == outbox.StatusSent {
+		c.JSON(http.StatusConflict, gin.H{"error": "The write was already sent"})
+		return
+	}
+
+	item.Status = outbox.StatusPending
+	item.Attempts = 0
+	item.NextAttemptAt = time.Now()
+	item.Error = ""
+	item.Result = nil
+	item.Force = c.Query("force") == "true"
+	if err := s.Outbox.SetCredentials(item.ID, s.credentials(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.Outbox.Update(item); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.wakeOutbox()
+	c.JSON(http.StatusOK, item)
+}
+
+// DiscardOutbox drops a queued write.
+func (s *Service) DiscardOutbox(c *gin.Context) {
+	client, ok := s.outboxClient(c)
+	if !ok {
+		return
+	}
+	item, ok := s.outboxItem(c, client)
+	if !ok {
+		return
+	}
+	if err := s.Outbox.Delete(item.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,239 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"procore-common/outbox"
+)
+
+// logAPI serves one call log, with id 7, of project 2. current is its
+// JSON, or "" when it does not exist. With bump, every write moves its
+// updated_at on, as Procore does.
+func logAPI(current string, bump bool) *apiStub {
+	writes := 0
+	return &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/rest/v1.0/projects/2/call_logs/7" || current == "" {
+			http.Error(w, `{"errors":"not found"}`, http.StatusNotFound)
+			return
+		}
+		if req.Method != http.MethodGet && bump {
+			writes++
+			current = fmt.Sprintf(`{"id":7,"updated_at":"2024-05-02T10:%02d:00Z"}`, writes)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(current))
+	}}
+}
+
+// writes returns the methods of the writes stub received.
+func writes(stub *apiStub) []string {
+	methods := []string{}
+	for _, req := range stub.sent(http.MethodPut, http.MethodDelete) {
+		methods = append(methods, req.Method)
+	}
+	return methods
+}
+
+func newReplayService(t *testing.T, api http.Handler) *Service {
+	t.Helper()
+	s, _ := newTestService(t, api, CallLogs, func(cfg *Config) {
+		cfg.OutboxPath = filepath.Join(t.TempDir(), "outbox.db")
+		cfg.OutboxRetryInterval = time.Minute
+	})
+	return s
+}
+
+func TestReplay(t *testing.T) {
+	const current = `{"id":7,"updated_at":"2024-05-02T10:00:00Z","comments":"current"}`
+	tests := []struct {
+		name      string
+		current   string
+		op        string
+		base      string
+		force     bool
+		status    string
+		sentWrite bool
+	}{
+		{"base matches", current, outbox.OpUpdate, "2024-05-02T10:00:00Z", false, outbox.StatusSent, true},
+		{"changed since", current, outbox.OpUpdate, "2024-05-01T09:00:00Z", false, outbox.StatusConflicted, false},
+		{"base unknown", current, outbox.OpUpdate, "", false, outbox.StatusConflicted, false},
+		{"base unknown, delete", current, outbox.OpDelete, "", false, outbox.StatusConflicted, false},
+		{"forced", current, outbox.OpUpdate, "2024-05-01T09:00:00Z", true, outbox.StatusSent, true},
+		{"updated after deletion", "", outbox.OpUpdate, "2024-05-02T10:00:00Z", false, outbox.StatusConflicted, false},
+		{"deleted after deletion", "", outbox.OpDelete, "2024-05-02T10:00:00Z", false, outbox.StatusSent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := logAPI(tt.current, false)
+			s := newReplayService(t, stub)
+
+			item := outbox.Item{
+				IdempotencyKey: "key",
+				CompanyID:      "1",
+				ProjectID:      "2",
+				Resource:       CallLogs.Name,
+				Op:             tt.op,
+				LogID:          "7",
+				BaseUpdatedAt:  tt.base,
+				Force:          tt.force,
+			}
+			if tt.op == outbox.OpUpdate {
+				item.Body = json.RawMessage(`{"comments":"queued"}`)
+			}
+			item, _, err := s.Outbox.Add(item, outbox.Credentials{Token: "token"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !s.replay(context.Background(), item) {
+				t.Fatal("replay reported Procore unreachable")
+			}
+			got, err := s.Outbox.Get(item.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.status {
+				t.Errorf("status = %s (%s), want %s", got.Status, got.Error, tt.status)
+			}
+			if sent := writes(stub); len(sent) > 0 != tt.sentWrite {
+				t.Errorf("writes sent = %v, want %v", sent, tt.sentWrite)
+			}
+			if got.Status == outbox.StatusConflicted && tt.current != "" && !strings.Contains(string(got.Result), `"current"`) {
+				t.Errorf("conflict result = %s, want the current log", got.Result)
+			}
+		})
+	}
+}
+
+func TestReplayWithoutCredentials(t *testing.T) {
+	s := newReplayService(t, logAPI("", false))
+	item, _, err := s.Outbox.Add(outbox.Item{
+		CompanyID: "1",
+		ProjectID: "2",
+		Resource:  CallLogs.Name,
+		Op:        outbox.OpDelete,
+		LogID:     "7",
+	}, outbox.Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.replay(context.Background(), item)
+	if got, _ := s.Outbox.Get(item.ID); got.Status != outbox.StatusFailed {
+		t.Errorf("status = %s, want %s", got.Status, outbox.StatusFailed)
+	}
+}
+
+func TestReplayDue(t *testing.T) {
+	const current = `{"id":7,"updated_at":"2024-05-02T10:00:00Z"}`
+	stub := logAPI(current, false)
+	s := newReplayService(t, stub)
+
+	add := func(projectID string, backoff bool) outbox.Item {
+		t.Helper()
+		item, _, err := s.Outbox.Add(outbox.Item{
+			CompanyID:     "1",
+			ProjectID:     projectID,
+			Resource:      CallLogs.Name,
+			Op:            outbox.OpDelete,
+			LogID:         "7",
+			BaseUpdatedAt: "2024-05-02T10:00:00Z",
+		}, outbox.Credentials{Token: "token"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backoff {
+			item.NextAttemptAt = time.Now().Add(time.Hour)
+			if err := s.Outbox.Update(item); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return item
+	}
+	waiting := add("3", true)
+	behind := add("3", false)
+	other := add("2", false)
+
+	s.replayDue()
+
+	for _, tt := range []struct {
+		item   outbox.Item
+		status string
+	}{
+		{waiting, outbox.StatusPending},
+		{behind, outbox.StatusPending},
+		{other, outbox.StatusSent},
+	} {
+		got, err := s.Outbox.Get(tt.item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != tt.status || got.Status == outbox.StatusPending && got.Attempts != 0 {
+			t.Errorf("item %d of project %s: status %s after %d attempts (%s), want %s untried", got.ID, got.ProjectID, got.Status, got.Attempts, got.Error, tt.status)
+		}
+	}
+	if sent := writes(stub); len(sent) != 1 {
+		t.Errorf("writes sent = %v, want the delete of project 2", sent)
+	}
+}
+
+func TestReplayDueRebasesLaterWrites(t *testing.T) {
+	stub := logAPI(`{"id":7,"updated_at":"2024-05-02T10:00:00Z"}`, true)
+	s := newReplayService(t, stub)
+
+	var queued []outbox.Item
+	for i, op := range []string{outbox.OpUpdate, outbox.OpUpdate, outbox.OpDelete} {
+		item := outbox.Item{
+			IdempotencyKey: fmt.Sprint(i),
+			CompanyID:      "1",
+			ProjectID:      "2",
+			Resource:       CallLogs.Name,
+			Op:             op,
+			LogID:          "7",
+			BaseUpdatedAt:  "2024-05-02T10:00:00Z",
+		}
+		if op == outbox.OpUpdate {
+			item.Body = json.RawMessage(fmt.Sprintf(`{"comments":"queued %d"}`, i))
+		}
+		item, _, err := s.Outbox.Add(item, outbox.Credentials{Token: "token"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued = append(queued, item)
+	}
+	// Made against a version the first update was not: still a conflict.
+	stale, _, err := s.Outbox.Add(outbox.Item{
+		IdempotencyKey: "stale",
+		CompanyID:      "1",
+		ProjectID:      "2",
+		Resource:       CallLogs.Name,
+		Op:             outbox.OpUpdate,
+		LogID:          "7",
+		Body:           json.RawMessage(`{"comments":"stale"}`),
+		BaseUpdatedAt:  "2024-05-01T09:00:00Z",
+	}, outbox.Credentials{Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.replayDue()
+
+	for _, item := range queued {
+		if got, _ := s.Outbox.Get(item.ID); got.Status != outbox.StatusSent {
+			t.Errorf("%s %d: status %s (%s), want sent", item.Op, item.ID, got.Status, got.Error)
+		}
+	}
+	if got, _ := s.Outbox.Get(stale.ID); got.Status != outbox.StatusConflicted {
+		t.Errorf("stale update: status %s, want conflicted", got.Status)
+	}
+	if want := []string{http.MethodPut, http.MethodPut, http.MethodDelete}; !reflect.DeepEqual(writes(stub), want) {
+		t.Errorf("writes sent = %v, want %v", writes(stub), want)
+	}
+}
@@ -0,0 +1,59 @@
+package logs
+
+import (
+	"strconv"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPage bounds the page query parameter, so the offset of a page past
+// any real list cannot overflow.
+const maxPage = 1 << 20
+
+// pageFromQuery reads the page and per_page query parameters, capped at
+// maxPage and procore.MaxPerPage. The zero Page (no page requested) means
+// every record.
+func pageFromQuery(c *gin.Context) procore.Page {
+	var page procore.Page
+	// Out of range values come back as the largest int, and are capped.
+	page.Number, _ = strconv.Atoi(c.Query("page"))
+	page.PerPage, _ = strconv.Atoi(c.Query("per_page"))
+	page.Number = min(page.Number, maxPage)
+	page.PerPage = min(page.PerPage, procore.MaxPerPage)
+	if page.Number <= 0 && page.PerPage > 0 {
+		page.Number = 1
+	}
+	if page.Number > 0 && page.PerPage <= 0 {
+		page.PerPage = procore.DefaultPerPage
+	}
+	return page
+}
+
+// setPageHeaders reports the total record count, and the page size when a
+// window was requested, using the same headers as Procore.
+func setPageHeaders(c *gin.Context, total int, page procore.Page) {
+	c.Header("Total", strconv.Itoa(total))
+	if page.Number > 0 {
+		c.Header("Per-Page", strconv.Itoa(page.PerPage))
+	}
+}
+
+// paginate cuts the requested page out of records and sets the page
+// headers for the full set.
+func paginate[T any](c *gin.Context, records []T) []T {
+	page := pageFromQuery(c)
+	setPageHeaders(c, len(records), page)
+	if page.Number <= 0 {
+		return records
+	}
+
+	// Only pages up to the end of records are multiplied out.
+	start := len(records)
+	if page.Number-1 <= len(records)/page.PerPage {
+		start = min((page.Number-1)*page.PerPage, len(records))
+	}
+	end := min(start+page.PerPage, len(records))
+	return records[start:end]
+}
@@ -0,0 +1,67 @@
+package logs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+func queryContext(query string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/call_logs?"+query, nil)
+	return c, w
+}
+
+func TestPageFromQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  procore.Page
+	}{
+		{"", procore.Page{}},
+		{"page=2", procore.Page{Number: 2, PerPage: procore.DefaultPerPage}},
+		{"per_page=10", procore.Page{Number: 1, PerPage: 10}},
+		{"page=3&per_page=5000", procore.Page{Number: 3, PerPage: procore.MaxPerPage}},
+		{"page=99999999999999999999999&per_page=10", procore.Page{Number: maxPage, PerPage: 10}},
+		{"page=9223372036854775807&per_page=9223372036854775807", procore.Page{Number: maxPage, PerPage: procore.MaxPerPage}},
+		{"page=-9223372036854775808&per_page=10", procore.Page{Number: 1, PerPage: 10}},
+	}
+	for _, tt := range tests {
+		c, _ := queryContext(tt.query)
+		if got := pageFromQuery(c); got != tt.want {
+			t.Errorf("%q: page %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	records := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		query   string
+		want    []int
+		perPage string
+	}{
+		{"", records, ""},
+		{"page=2&per_page=2", []int{3, 4}, "2"},
+		{"page=3&per_page=2", []int{5}, "2"},
+		{"page=4&per_page=2", []int{}, "2"},
+		{"page=99999999999999999999999&per_page=99999999999999999999999", []int{}, "1000"},
+		{"page=4611686018427387904&per_page=4", []int{}, "4"},
+	}
+	for _, tt := range tests {
+		c, w := queryContext(tt.query)
+		got := paginate(c, records)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: records %v, want %v", tt.query, got, tt.want)
+		}
+		if total, perPage := w.Header().Get("Total"), w.Header().Get("Per-Page"); total != "5" || perPage != tt.perPage {
+			t.Errorf("%q: Total %q, Per-Page %q; want 5 and %q", tt.query, total, perPage, tt.perPage)
+		}
+	}
+}
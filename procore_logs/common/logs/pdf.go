@@ -0,0 +1,146 @@
+package logs
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/go-pdf/fpdf"
+)
+
+const (
+	pdfRowHeight  = 6.0
+	pdfFontSize   = 8.0
+	pdfCellMargin = 2.0
+
+	pdfMaxCellRunes = 200
+)
+
+// pdfReport lays out a landscape report: a title, a block of label/value
+// lines and tables that repeat their header row on every page.
+type pdfReport struct {
+	pdf    *fpdf.Fpdf
+	tr     func(string) string
+	header []string
+	widths []float64
+}
+
+// newPDFReport starts a report with a title and meta lines such as
+// {"Project", "Tower A"}.
+func newPDFReport(title string, meta [][2]string) *pdfReport {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.SetAutoPageBreak(false, 10)
+	pdf.AliasNbPages("")
+	report := &pdfReport{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-10)
+		pdf.SetFont("Helvetica", "I", pdfFontSize)
+		pdf.CellFormat(0, pdfRowHeight, "Page "+strconv.Itoa(pdf.PageNo())+"/{nb}", "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, report.tr(title), "", 1, "L", false, 0, "")
+	for _, line := range meta {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(40, pdfRowHeight, report.tr(line[0]+":"), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.MultiCell(0, pdfRowHeight, report.tr(line[1]), "", "L", false)
+	}
+	pdf.Ln(4)
+	return report
+}
+
+// Heading writes a section heading above the next table.
+func (p *pdfReport) Heading(text string) {
+	p.breakPage(3 * pdfRowHeight)
+	p.pdf.Ln(2)
+	p.pdf.SetFont("Helvetica", "B", 11)
+	p.pdf.CellFormat(0, 8, p.tr(text), "", 1, "L", false, 0, "")
+}
+
+// Table starts a table. weights share the page width between the columns.
+func (p *pdfReport) Table(header []string, weights []float64) {
+	width, _ := p.pdf.GetPageSize()
+	left, _, right, _ := p.pdf.GetMargins()
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	p.header = header
+	p.widths = make([]float64, len(weights))
+	for i, w := range weights {
+		p.widths[i] = (width - left - right) * w / total
+	}
+	p.breakPage(2 * pdfRowHeight)
+	p.headerRow()
+}
+
+// Row adds a table row, cutting values that do not fit their column.
+func (p *pdfReport) Row(values []string) {
+	if p.breakPage(pdfRowHeight) {
+		p.headerRow()
+	}
+	p.pdf.SetFont("Helvetica", "", pdfFontSize)
+	for i, width := range p.widths {
+		value := ""
+		if i < len(values) {
+			value = p.fit(values[i], width)
+		}
+		p.pdf.CellFormat(width, pdfRowHeight, value, "1", 0, "L", false, 0, "")
+	}
+	p.pdf.Ln(-1)
+}
+
+// Output writes the finished document.
+func (p *pdfReport) Output(w io.Writer) error {
+	return p.pdf.Output(w)
+}
+
+func (p *pdfReport) headerRow() {
+	p.pdf.SetFont("Helvetica", "B", pdfFontSize)
+	p.pdf.SetFillColor(230, 230, 230)
+	for i, width := range p.widths {
+		p.pdf.CellFormat(width, pdfRowHeight, p.fit(p.header[i], width), "1", 0, "L", true, 0, "")
+	}
+	p.pdf.Ln(-1)
+}
+
+// breakPage starts a new page when fewer than height millimetres are left,
+// reporting whether it did.
+func (p *pdfReport) breakPage(height float64) bool {
+	_, pageHeight := p.pdf.GetPageSize()
+	_, _, _, bottom := p.pdf.GetMargins()
+	if p.pdf.GetY()+height <= pageHeight-bottom-pdfRowHeight {
+		return false
+	}
+	p.pdf.AddPage()
+	return true
+}
+
+// fit translates value to the PDF font's encoding and shortens it to fit
+// width.
+func (p *pdfReport) fit(value string, width float64) string {
+	text := []rune(value)
+	if len(text) > pdfMaxCellRunes {
+		// No column is wide enough for more; skip measuring the rest.
+		text = text[:pdfMaxCellRunes]
+	}
+	for i, r := range text {
+		if r == '\n' || r == '\r' || r == '\t' {
+			text[i] = ' '
+		}
+	}
+	s := p.tr(string(text))
+	if p.pdf.GetStringWidth(s) <= width-pdfCellMargin {
+		return s
+	}
+	for len(text) > 0 {
+		text = text[:len(text)-1]
+		s = p.tr(string(text) + "...")
+		if p.pdf.GetStringWidth(s) <= width-pdfCellMargin {
+			break
+		}
+	}
+	return s
+}
@@ -0,0 +1,41 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Companies lists the companies the caller can access.
+func (s *Service) Companies(c *gin.Context) {
+	client, ok := s.companyClient(c)
+	if !ok {
+		return
+	}
+	resp, err := client.ListCompanies(c.Request.Context())
+	relay(c, resp, err)
+}
+
+// Projects lists every project the caller can access in the route's
+// company, the company_id query parameter or the configured company.
+func (s *Service) Projects(c *gin.Context) {
+	client, ok := s.companyClient(c)
+	if !ok {
+		return
+	}
+	query := url.Values{}
+	query.Set("company_id", client.CompanyID)
+	projects, _, err := procore.ListPages[json.RawMessage](c.Request.Context(), client, "/projects", query, procore.Page{})
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	if projects == nil {
+		projects = []json.RawMessage{}
+	}
+	c.JSON(http.StatusOK, projects)
+}
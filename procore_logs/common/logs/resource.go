@@ -0,0 +1,275 @@
+package logs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"procore-common/mirror"
+	"procore-common/outbox"
+	"procore-common/procore"
+	"procore-common/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resource describes a Procore daily log type and the routes it is served
+// under. Its handlers are methods on Service.
+type Resource struct {
+	procore.LogResource
+	// Path is the route the resource is served under, e.g. "/api/call_logs".
+	Path string
+	// ReadOnly leaves the create, update and delete routes unregistered.
+	ReadOnly bool
+	// Validate, when set, checks logs before they are created or updated.
+	Validate Validator
+	// Typed logs have a type field from AccidentTypes. Procore has no column
+	// for it, so writes keep it in the comments as an [AccidentType: code]
+	// marker and reads decode it, legacy [Type: ...] markers included.
+	Typed bool
+	// Dimensions are type-specific groupings for the stats endpoint.
+	Dimensions []Dimension
+	// Routes are type-specific endpoints registered next to the CRUD ones.
+	Routes []Route
+	// HookName is the log type's resource name in Procore hook triggers
+	// and payloads, e.g. "Call Logs".
+	HookName string
+}
+
+// Route is an extra endpoint of a Resource.
+type Route struct {
+	Method  string
+	Path    string
+	Handler Handler
+}
+
+// NewResource registers a log type by its Procore path segment, form field
+// prefix and route, e.g. NewResource("call_logs", "call_log", "/api/call_logs").
+// Its HookName is the title-cased name, "Call Logs".
+func NewResource(name, formPrefix, path string) *Resource {
+	words := strings.Split(name, "_")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return &Resource{
+		LogResource: procore.LogResource{Name: name, FormPrefix: formPrefix},
+		Path:        path,
+		HookName:    strings.Join(words, " "),
+	}
+}
+
+// logID reads the :id route parameter, writing a 400 when it is empty.
+func logID(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Log ID is required"})
+		return "", false
+	}
+	return id, true
+}
+
+// relay copies a Procore response back to the caller unchanged.
+func relay(c *gin.Context, resp *http.Response, err error) {
+	if err != nil {
+		requestError(c, "", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+}
+
+// relayLog is relay for a successful response holding one log, adding
+// what its comments encode (see decodeLogs). It returns the log as Procore
+// sent it, or nil when the write did not succeed.
+func (s *Service) relayLog(c *gin.Context, r *Resource, resp *http.Response, err error) map[string]interface{} {
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 || resp.StatusCode == http.StatusNoContent {
+		relay(c, resp, err)
+		return nil
+	}
+
+	var record map[string]interface{}
+	if err := procore.DecodeResponse(resp, &record); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return nil
+	}
+	published := make(map[string]interface{}, len(record))
+	for k, v := range record {
+		published[k] = v
+	}
+	s.decodeRecord(r, record)
+	c.JSON(resp.StatusCode, record)
+	return published
+}
+
+// requestError reports a failed Procore call; an expired session is a 401.
+func requestError(c *gin.Context, prefix string, err error) {
+	if errors.Is(err, session.ErrExpired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": prefix + err.Error()})
+}
+
+// List returns the resource's logs. Without page parameters every Procore
+// page is fetched; page and per_page request a single window. The Total
+// header carries Procore's record count either way. With a mirror, the
+// window is cut from the mirrored logs.
+func (s *Service) List(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+
+	if s.Mirror != nil {
+		logs, ok := fetchLogs[map[string]interface{}](c, s, r, client, Filters{Live: c.Query("live") == "true"})
+		if ok {
+			c.JSON(http.StatusOK, paginate(c, logs))
+		}
+		return
+	}
+
+	page := pageFromQuery(c)
+	logs, total, err := procore.ListPages[map[string]interface{}](c.Request.Context(), client, client.ProjectPath(r.Name), nil, page)
+	if err != nil {
+		listError(c, err)
+		return
+	}
+	if logs == nil {
+		logs = []map[string]interface{}{}
+	}
+	decodeLogs(s, r, logs)
+
+	setSource(c, readInfo{Source: SourceLive})
+	setPageHeaders(c, total, page)
+	c.JSON(http.StatusOK, logs)
+}
+
+func (s *Service) Details(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+	id, ok := logID(c)
+	if !ok {
+		return
+	}
+
+	var cached json.RawMessage
+	var info readInfo
+	if s.Mirror != nil && s.authorize(c.Request.Context(), client) == nil {
+		var fresh bool
+		cached, info, fresh = s.Mirror.record(r, client, id)
+		if fresh && c.Query("live") != "true" {
+			s.serveCached(c, r, cached, info)
+			return
+		}
+	}
+
+	resp, err := r.LogResource.Get(c.Request.Context(), client, id)
+	if cached != nil && offline(err) {
+		s.serveCached(c, r, cached, info)
+		return
+	}
+	setSource(c, readInfo{Source: SourceLive})
+	s.relayLog(c, r, resp, err)
+}
+
+// serveCached answers with a log from the mirror.
+func (s *Service) serveCached(c *gin.Context, r *Resource, record json.RawMessage, info readInfo) {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(record, &decoded); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.decodeRecord(r, decoded)
+	setSource(c, info)
+	c.JSON(http.StatusOK, decoded)
+}
+
+func (s *Service) Create(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+
+	logData, ok := s.bindLog(c, r)
+	if !ok {
+		return
+	}
+
+	queued := logData
+	key := s.idempotencyKey(c)
+	s.encodeLog(r, &logData)
+	resp, err := r.LogResource.Create(procore.WithIdempotencyToken(c.Request.Context(), key), client, logData)
+	if s.queueWrite(c, r, client, resp, err, outbox.Item{IdempotencyKey: key, Op: outbox.OpCreate}, queued) {
+		return
+	}
+	created := s.relayLog(c, r, resp, err)
+	s.publish(r, client.CompanyID, client.ProjectID, mirror.Created, SourceGateway, created)
+}
+
+// Update applies a JSON Merge Patch to a log: only the fields present in
+// the body change, and null clears a field.
+func (s *Service) Update(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+	id, ok := logID(c)
+	if !ok {
+		return
+	}
+
+	patch, ok := s.bindPatch(c, r)
+	if !ok {
+		return
+	}
+
+	queued := patch
+	key := s.idempotencyKey(c)
+	item := outbox.Item{IdempotencyKey: key, Op: outbox.OpUpdate, LogID: id}
+	ctx := procore.WithIdempotencyToken(c.Request.Context(), key)
+	if err := s.encodePatch(ctx, r, client, id, &patch); err != nil {
+		if !s.queueWrite(c, r, client, nil, err, item, queued) {
+			listError(c, err)
+		}
+		return
+	}
+	resp, err := r.LogResource.Update(ctx, client, id, patch)
+	if s.queueWrite(c, r, client, resp, err, item, queued) {
+		return
+	}
+	updated := s.relayLog(c, r, resp, err)
+	s.publish(r, client.CompanyID, client.ProjectID, mirror.Updated, SourceGateway, updated)
+}
+
+func (s *Service) Delete(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+	id, ok := logID(c)
+	if !ok {
+		return
+	}
+	key := s.idempotencyKey(c)
+	resp, err := r.LogResource.Delete(procore.WithIdempotencyToken(c.Request.Context(), key), client, id)
+	if s.queueWrite(c, r, client, resp, err, outbox.Item{IdempotencyKey: key, Op: outbox.OpDelete, LogID: id}, nil) {
+		return
+	}
+	relay(c, resp, err)
+	if err == nil && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		s.publishDeleted(r, client, id)
+	}
+}
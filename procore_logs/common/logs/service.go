@@ -0,0 +1,455 @@
+package logs
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"procore-common/mirror"
+	"procore-common/outbox"
+	"procore-common/procore"
+	"procore-common/session"
+	"procore-common/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds the Procore settings shared by every handler.
+type Config struct {
+	Environment  procore.Environment
+	ClientID     string
+	ClientSecret string
+	CompanyID    string
+	ProjectID    string
+	// Sessions keeps tokens server-side behind an opaque session ID
+	// instead of handing them to the browser.
+	Sessions bool
+	// RedirectURI is this backend's /api/auth/callback as registered with
+	// Procore. Setting it enables the browser login flow and sessions.
+	RedirectURI string
+	// SecureCookies marks the session cookie Secure.
+	SecureCookies bool
+	// SessionTTL is how long a session may go unused before it is
+	// forgotten.
+	SessionTTL time.Duration
+	// ServiceAccount lets the background sync and the Procore hook
+	// receiver run as the application itself, using the client-credentials
+	// grant.
+	ServiceAccount bool
+	// ServiceAccountKey, when set with ServiceAccount, lets read requests
+	// without a user token run as the application if they send it in
+	// ServiceAccountKeyHeader.
+	ServiceAccountKey string
+	// MirrorPath is the BoltDB file mirroring Procore's logs; empty
+	// disables the mirror.
+	MirrorPath string
+	// MirrorMaxAge is how old a mirrored copy may be when it is served.
+	MirrorMaxAge time.Duration
+	// OutboxPath is the BoltDB file writes are queued in while Procore is
+	// unreachable; empty disables queueing.
+	OutboxPath string
+	// OutboxKey seals the credentials queued writes are replayed with in
+	// the outbox file; empty holds them in memory only.
+	OutboxKey string
+	// OutboxRetryInterval is how often queued writes are replayed, and the
+	// first backoff of a write that fails.
+	OutboxRetryInterval time.Duration
+	// SyncInterval is how often the mirror is synced in the background;
+	// zero leaves syncing to reads.
+	SyncInterval time.Duration
+	// SyncSweepInterval is how often a sync fetches full lists to find
+	// deletions.
+	SyncSweepInterval time.Duration
+	// SyncProjectIDs are the projects of CompanyID that are synced.
+	SyncProjectIDs []string
+	// WebhooksPath is the BoltDB file of the outbound webhook
+	// subscriptions and deliveries; empty disables webhooks.
+	WebhooksPath string
+	// WebhooksAllowPrivate lets subscribers be on loopback, private and
+	// link-local addresses, for development.
+	WebhooksAllowPrivate bool
+	// ProcoreHookSecret authenticates the events Procore posts to
+	// /api/webhooks/procore; empty disables the endpoint.
+	ProcoreHookSecret string
+	// ProcoreHookURL is where Procore reaches /api/webhooks/procore, which
+	// the hooks registered through the gateway post to.
+	ProcoreHookURL string
+	// AccidentTypes is the taxonomy accident logs are typed against;
+	// empty means DefaultAccidentTypes.
+	AccidentTypes Taxonomy
+	// CommentTags are the bracketed tags read from the comments of logs;
+	// nil means DefaultCommentTags.
+	CommentTags []string
+}
+
+// LoadConfig reads the Procore environment profile (see
+// procore.LoadEnvironment), OAuth credentials and the company and project
+// to work in. AUTH_SESSIONS=true enables server-side sessions, as does
+// PROCORE_REDIRECT_URI, which turns on the browser login flow; SESSION_TTL
+// (default 168h) is how long an unused session is kept.
+// PROCORE_SERVICE_ACCOUNT=true enables the client-credentials service
+// account, which reads carrying PROCORE_SERVICE_ACCOUNT_KEY may run as.
+// MIRROR_PATH enables the local mirror and MIRROR_MAX_AGE (a duration such
+// as 10m, default 5m) sets its staleness window. OUTBOX_PATH enables the
+// write outbox, OUTBOX_KEY seals the credentials it keeps and
+// OUTBOX_RETRY_INTERVAL (default 30s) sets how often it is replayed. SYNC_INTERVAL syncs the mirror of SYNC_PROJECT_IDS (default
+// PROCORE_PROJECT_ID) in the background, as the service account, with a
+// full sweep every SYNC_SWEEP_INTERVAL (default 1h). WEBHOOKS_PATH enables
+// outbound webhooks, and WEBHOOKS_ALLOW_PRIVATE=true lets them reach
+// internal addresses. PROCORE_WEBHOOK_SECRET enables the Procore hook
+// receiver and PROCORE_WEBHOOK_URL the registration of hooks posting to
+// it. ACCIDENT_TYPES_FILE replaces DefaultAccidentTypes and COMMENT_TAGS
+// DefaultCommentTags.
+func LoadConfig() (Config, error) {
+	env, err := procore.LoadEnvironment()
+	if err != nil {
+		return Config{}, err
+	}
+	accidentTypes := DefaultAccidentTypes
+	if path := os.Getenv("ACCIDENT_TYPES_FILE"); path != "" {
+		if accidentTypes, err = LoadAccidentTypes(path); err != nil {
+			return Config{}, err
+		}
+	}
+	commentTags := DefaultCommentTags
+	if tags := os.Getenv("COMMENT_TAGS"); tags != "" {
+		commentTags = splitIDs(tags)
+	}
+	sessionTTL := session.DefaultTTL
+	if value := os.Getenv("SESSION_TTL"); value != "" {
+		if sessionTTL, err = time.ParseDuration(value); err != nil || sessionTTL <= 0 {
+			return Config{}, fmt.Errorf("SESSION_TTL must be a positive duration such as 24h, got %q", value)
+		}
+	}
+	maxAge := DefaultMirrorMaxAge
+	if value := os.Getenv("MIRROR_MAX_AGE"); value != "" {
+		if maxAge, err = time.ParseDuration(value); err != nil || maxAge <= 0 {
+			return Config{}, fmt.Errorf("MIRROR_MAX_AGE must be a positive duration such as 10m, got %q", value)
+		}
+	}
+	retryInterval := DefaultOutboxRetryInterval
+	if value := os.Getenv("OUTBOX_RETRY_INTERVAL"); value != "" {
+		if retryInterval, err = time.ParseDuration(value); err != nil || retryInterval <= 0 {
+			return Config{}, fmt.Errorf("OUTBOX_RETRY_INTERVAL must be a positive duration such as 1m, got %q", value)
+		}
+	}
+	var syncInterval time.Duration
+	if value := os.Getenv("SYNC_INTERVAL"); value != "" {
+		if syncInterval, err = time.ParseDuration(value); err != nil || syncInterval <= 0 {
+			return Config{}, fmt.Errorf("SYNC_INTERVAL must be a positive duration such as 1m, got %q", value)
+		}
+		if os.Getenv("MIRROR_PATH") == "" || os.Getenv("PROCORE_SERVICE_ACCOUNT") != "true" {
+			return Config{}, fmt.Errorf("SYNC_INTERVAL needs MIRROR_PATH and PROCORE_SERVICE_ACCOUNT=true")
+		}
+	}
+	sweepInterval := DefaultSyncSweepInterval
+	if value := os.Getenv("SYNC_SWEEP_INTERVAL"); value != "" {
+		if sweepInterval, err = time.ParseDuration(value); err != nil || sweepInterval <= 0 {
+			return Config{}, fmt.Errorf("SYNC_SWEEP_INTERVAL must be a positive duration such as 1h, got %q", value)
+		}
+	}
+	if os.Getenv("PROCORE_WEBHOOK_URL") != "" && os.Getenv("PROCORE_WEBHOOK_SECRET") == "" {
+		return Config{}, fmt.Errorf("PROCORE_WEBHOOK_URL needs PROCORE_WEBHOOK_SECRET")
+	}
+	syncProjects := splitIDs(os.Getenv("SYNC_PROJECT_IDS"))
+	if len(syncProjects) == 0 && os.Getenv("PROCORE_PROJECT_ID") != "" {
+		syncProjects = []string{os.Getenv("PROCORE_PROJECT_ID")}
+	}
+	return Config{
+		Environment:       env,
+		ClientID:          os.Getenv("PROCORE_CLIENT_ID"),
+		ClientSecret:      os.Getenv("PROCORE_CLIENT_SECRET"),
+		CompanyID:         os.Getenv("PROCORE_COMPANY_ID"),
+		ProjectID:         os.Getenv("PROCORE_PROJECT_ID"),
+		Sessions:          os.Getenv("AUTH_SESSIONS") == "true",
+		RedirectURI:       os.Getenv("PROCORE_REDIRECT_URI"),
+		SecureCookies:     os.Getenv("SESSION_COOKIE_SECURE") != "false",
+		SessionTTL:        sessionTTL,
+		ServiceAccount:    os.Getenv("PROCORE_SERVICE_ACCOUNT") == "true",
+		ServiceAccountKey: os.Getenv("PROCORE_SERVICE_ACCOUNT_KEY"),
+		MirrorPath:        os.Getenv("MIRROR_PATH"),
+		MirrorMaxAge:      maxAge,
+
+		OutboxPath:          os.Getenv("OUTBOX_PATH"),
+		OutboxKey:           os.Getenv("OUTBOX_KEY"),
+		OutboxRetryInterval: retryInterval,
+
+		SyncInterval:      syncInterval,
+		SyncSweepInterval: sweepInterval,
+		SyncProjectIDs:    syncProjects,
+
+		WebhooksPath:         os.Getenv("WEBHOOKS_PATH"),
+		WebhooksAllowPrivate: os.Getenv("WEBHOOKS_ALLOW_PRIVATE") == "true",
+		ProcoreHookSecret:    os.Getenv("PROCORE_WEBHOOK_SECRET"),
+		ProcoreHookURL:       os.Getenv("PROCORE_WEBHOOK_URL"),
+
+		AccidentTypes: accidentTypes,
+		CommentTags:   commentTags,
+	}, nil
+}
+
+// Service serves log resources against one Procore configuration.
+type Service struct {
+	Config Config
+	// Sessions is nil unless Config.Sessions or Config.RedirectURI is set.
+	Sessions *session.Manager
+	// ReturnURLs are the frontends Login may send the browser back to.
+	ReturnURLs []string
+	// ServiceAccount is nil unless Config.ServiceAccount is set.
+	ServiceAccount *procore.ServiceAccount
+	// Mirror is nil unless Config.MirrorPath is set.
+	Mirror *Mirror
+	// Outbox is nil unless Config.OutboxPath is set.
+	Outbox *outbox.Store
+	// Webhooks is nil unless Config.WebhooksPath is set.
+	Webhooks *webhook.Store
+
+	access     accessCache
+	outboxWake chan struct{}
+
+	webhooksWake  chan struct{}
+	webhookClient *http.Client
+	delivering    busySet
+	published     publishedSet
+
+	resourcesMu sync.Mutex
+	resources   map[string]*Resource
+}
+
+// NewService starts a service for cfg, with the background work its
+// stores need. It fails when the outbox or the webhook store cannot be
+// opened.
+func NewService(cfg Config) (*Service, error) {
+	if len(cfg.AccidentTypes) == 0 {
+		cfg.AccidentTypes = DefaultAccidentTypes
+	}
+	if cfg.CommentTags == nil {
+		cfg.CommentTags = DefaultCommentTags
+	}
+	s := &Service{Config: cfg}
+	// Unlike the mirror, a missing outbox would lose writes the caller was
+	// told are queued, and a missing webhook store events subscribers were
+	// promised, so both are opened first and required once configured.
+	if cfg.OutboxPath != "" {
+		store, err := outbox.Open(cfg.OutboxPath, cfg.OutboxKey)
+		if err != nil {
+			return nil, err
+		}
+		s.Outbox = store
+	}
+	if cfg.WebhooksPath != "" {
+		store, err := webhook.Open(cfg.WebhooksPath)
+		if err != nil {
+			if s.Outbox != nil {
+				s.Outbox.Close()
+			}
+			return nil, err
+		}
+		s.Webhooks = store
+	}
+
+	if cfg.Sessions || cfg.RedirectURI != "" {
+		s.Sessions = session.NewManager(session.NewMemoryStore(cfg.SessionTTL), s.OAuth())
+	}
+	if cfg.ServiceAccount {
+		s.ServiceAccount = procore.NewServiceAccount(s.OAuth())
+	}
+	if cfg.MirrorPath != "" {
+		// The mirror only speeds reads up, so the service runs without it
+		// rather than not at all.
+		if store, err := mirror.Open(cfg.MirrorPath); err != nil {
+			log.Printf("mirror disabled: %v", err)
+		} else {
+			s.Mirror = NewMirror(store, cfg.MirrorMaxAge)
+		}
+	}
+	if s.Webhooks != nil {
+		s.webhooksWake = make(chan struct{}, 1)
+		s.webhookClient = webhook.NewHTTPClient(webhookTimeout, cfg.WebhooksAllowPrivate)
+		if s.Mirror != nil {
+			s.Mirror.OnChange = s.publishChanges
+		}
+		go s.deliverWebhooks()
+	}
+	if s.Mirror != nil && s.ServiceAccount != nil && cfg.SyncInterval > 0 {
+		go s.syncLoop()
+	}
+	if s.Outbox != nil {
+		s.outboxWake = make(chan struct{}, 1)
+		go s.replayOutbox()
+	}
+	return s, nil
+}
+
+// Handler is an endpoint of a Resource.
+type Handler func(s *Service, r *Resource, c *gin.Context)
+
+// ScopePrefix scopes a route to a company and project other than the
+// configured defaults.
+const ScopePrefix = "/api/companies/:company_id/projects/:project_id"
+
+// Register mounts the resource's routes on router, both at their own path
+// (using the configured company and project) and under ScopePrefix.
+func (s *Service) Register(router gin.IRouter, r *Resource) {
+	s.resourcesMu.Lock()
+	if s.resources == nil {
+		s.resources = map[string]*Resource{}
+	}
+	s.resources[r.Name] = r
+	s.resourcesMu.Unlock()
+
+	handle := func(method, path string, handler Handler) {
+		h := func(c *gin.Context) { handler(s, r, c) }
+		if method != http.MethodGet {
+			h = s.invalidating(r, handler)
+		}
+		router.Handle(method, path, h)
+		router.Handle(method, ScopePrefix+strings.TrimPrefix(path, "/api"), h)
+	}
+
+	// Company-wide routes span projects, so they are only scoped by company.
+	h := func(c *gin.Context) { s.Aggregate(r, c) }
+	router.GET(r.Path+"/aggregate", h)
+	router.GET("/api/companies/:company_id"+strings.TrimPrefix(r.Path, "/api")+"/aggregate", h)
+
+	handle(http.MethodGet, r.Path, (*Service).List)
+	handle(http.MethodGet, r.Path+"/filter", (*Service).Filter)
+	handle(http.MethodGet, r.Path+"/stats", (*Service).Stats)
+	handle(http.MethodGet, r.Path+"/changes", (*Service).Changes)
+	for _, route := range r.Routes {
+		handle(route.Method, route.Path, route.Handler)
+	}
+	if !r.ReadOnly {
+		handle(http.MethodPost, r.Path, (*Service).Create)
+		handle(http.MethodPost, r.Path+"/bulk", (*Service).Bulk)
+		handle(http.MethodPost, r.Path+"/import", (*Service).Import)
+		handle(http.MethodPut, r.Path+"/:id", (*Service).Update)
+		handle(http.MethodPatch, r.Path+"/:id", (*Service).Update)
+		handle(http.MethodDelete, r.Path+"/:id", (*Service).Delete)
+	}
+	handle(http.MethodGet, r.Path+"/:id", (*Service).Details)
+}
+
+// resource returns the registered log type with the given Procore name.
+func (s *Service) resource(name string) *Resource {
+	s.resourcesMu.Lock()
+	defer s.resourcesMu.Unlock()
+	return s.resources[name]
+}
+
+// invalidating runs a write handler and then marks the mirrored copy of
+// the log type stale, unless the request was rejected.
+func (s *Service) invalidating(r *Resource, handler Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		handler(s, r, c)
+		if s.Mirror != nil && c.Writer.Status() < http.StatusBadRequest {
+			companyID, projectID := s.scope(c)
+			s.Mirror.Invalidate(mirror.Key{CompanyID: companyID, ProjectID: projectID, Resource: r.Name})
+		}
+	}
+}
+
+// OAuth returns the application credentials for Procore's login host.
+func (s *Service) OAuth() procore.OAuth {
+	return procore.OAuth{
+		Environment:  s.Config.Environment,
+		ClientID:     s.Config.ClientID,
+		ClientSecret: s.Config.ClientSecret,
+	}
+}
+
+// newClient builds a Procore client for the caller's session or
+// Authorization header, scoped to the route's company and project or the
+// configured defaults. It writes the error response and returns false when
+// the caller is not authenticated or no project is known.
+func (s *Service) newClient(c *gin.Context) (*procore.Client, bool) {
+	client, ok := s.companyClient(c)
+	if !ok {
+		return nil, false
+	}
+
+	if client.ProjectID == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Missing required environment variables"})
+		return nil, false
+	}
+	return client, true
+}
+
+// companyClient is newClient for company-level endpoints that need no
+// project. The company comes from the route, the company_id query parameter
+// or the configured default.
+func (s *Service) companyClient(c *gin.Context) (*procore.Client, bool) {
+	tokens, ok := s.tokenSource(c)
+	if !ok {
+		return nil, false
+	}
+
+	companyID, projectID := s.scope(c)
+	if companyID == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Missing required environment variables"})
+		return nil, false
+	}
+
+	return procore.NewClient(s.Config.Environment.RestURL(), companyID, projectID, tokens), true
+}
+
+// scope returns the company and project a request addresses.
+func (s *Service) scope(c *gin.Context) (companyID, projectID string) {
+	companyID = firstNonEmpty(c.Param("company_id"), c.Query("company_id"), s.Config.CompanyID)
+	projectID = firstNonEmpty(c.Param("project_id"), s.Config.ProjectID)
+	return companyID, projectID
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// tokenSource prefers a server-side session, whose token is refreshed
+// transparently, then a raw Authorization header, then the service account.
+// The service account only serves reads, and only to callers sending
+// ServiceAccountKey, since anyone reaching the port could act as it
+// otherwise.
+func (s *Service) tokenSource(c *gin.Context) (procore.TokenSource, bool) {
+	if id := sessionID(c); id != "" && s.Sessions != nil {
+		if !s.Sessions.Exists(id) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": session.ErrExpired.Error()})
+			return nil, false
+		}
+		return s.Sessions.TokenSource(id), true
+	}
+
+	accessToken := c.GetHeader("Authorization")
+	if accessToken != "" {
+		return procore.StaticToken(accessToken), true
+	}
+	if key := c.GetHeader(ServiceAccountKeyHeader); key != "" && s.ServiceAccount != nil && s.Config.ServiceAccountKey != "" {
+		if !s.validServiceAccountKey(key) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid " + ServiceAccountKeyHeader})
+			return nil, false
+		}
+		if c.Request.Method != http.MethodGet {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The service account can only read"})
+			return nil, false
+		}
+		return s.ServiceAccount, true
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+	return nil, false
+}
+
+// validServiceAccountKey reports whether key is the configured
+// ServiceAccountKey.
+func (s *Service) validServiceAccountKey(key string) bool {
+	return subtle.ConstantTimeCompare([]byte(key), []byte(s.Config.ServiceAccountKey)) == 1
+}
@@ -0,0 +1,101 @@
+package logs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewServiceStoreError(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing", "store.db")
+	for _, cfg := range []Config{{OutboxPath: missing}, {WebhooksPath: missing}} {
+		if s, err := NewService(cfg); err == nil || s != nil {
+			t.Errorf("NewService(%+v) = %v, %v; want an error", cfg, s, err)
+		}
+	}
+}
+
+func TestServicesKeepTheirOwnVocabulary(t *testing.T) {
+	defaults, err := NewService(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom, err := NewService(Config{
+		AccidentTypes: Taxonomy{{Code: "pinch", Label: "Pinch point"}},
+		CommentTags:   []string{"Crew"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comments := "[AccidentType: pinch] [Crew: B] [Injury: cut]"
+	got := map[string]interface{}{"comments": comments}
+	custom.decodeRecord(AccidentLogs, got)
+	if got["type"] != "pinch" || !reflect.DeepEqual(got["tags"], map[string]interface{}{"Crew": "B"}) {
+		t.Errorf("custom service decoded %v", got)
+	}
+
+	got = map[string]interface{}{"comments": comments}
+	defaults.decodeRecord(AccidentLogs, got)
+	if !reflect.DeepEqual(got["tags"], map[string]interface{}{"Injury": "cut"}) {
+		t.Errorf("default service decoded tags %v", got["tags"])
+	}
+	if label := defaults.Config.AccidentTypes.label("slip_trip_fall"); label != "Slip, trip or fall" {
+		t.Errorf("default taxonomy label = %q", label)
+	}
+	if label := custom.Config.AccidentTypes.label("slip_trip_fall"); label != "slip_trip_fall" {
+		t.Errorf("custom taxonomy knows a default type: %q", label)
+	}
+}
+
+func TestServiceAccountFallback(t *testing.T) {
+	var sent []string
+	api := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/oauth/token" {
+			w.Write([]byte(`{"access_token":"app","token_type":"Bearer","expires_in":7200}`))
+			return
+		}
+		sent = append(sent, req.Method+" "+req.Header.Get("Authorization"))
+		w.Write([]byte(`[]`))
+	})
+	router := newTestRouter(t, api, CallLogs, func(cfg *Config) {
+		cfg.ServiceAccount = true
+		cfg.ServiceAccountKey = "key"
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		key    string
+		status int
+	}{
+		{"read with the key", http.MethodGet, "key", http.StatusOK},
+		{"read without a key", http.MethodGet, "", http.StatusUnauthorized},
+		{"read with a wrong key", http.MethodGet, "guess", http.StatusUnauthorized},
+		{"write with the key", http.MethodDelete, "key", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		sent = nil
+		path := "/api/call_logs"
+		if tt.method == http.MethodDelete {
+			path += "/7"
+		}
+		req := httptest.NewRequest(tt.method, path, nil)
+		if tt.key != "" {
+			req.Header.Set(ServiceAccountKeyHeader, tt.key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+		}
+		if tt.status == http.StatusOK && (len(sent) != 1 || sent[0] != "GET Bearer app") {
+			t.Errorf("%s: Procore got %v, want one read as the service account", tt.name, sent)
+		}
+		if tt.status != http.StatusOK && len(sent) > 0 {
+			t.Errorf("%s: Procore got %v, want nothing", tt.name, sent)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package logs
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stats intervals.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// none labels logs without a value for a grouping.
+const none = "(none)"
+
+// maxStatsPeriods bounds the periods of one response, e.g. about three
+// years of days.
+const maxStatsPeriods = 1100
+
+// Dimension is a grouping offered by the stats endpoint, e.g. severity.
+type Dimension struct {
+	Name  string
+	Value func(s *Service, record map[string]interface{}) string
+}
+
+// statsDimensions are the groupings every log type has; Resource.Dimensions
+// adds type-specific ones.
+var statsDimensions = []Dimension{
+	fieldDimension("severity"),
+	fieldDimension("involved_company"),
+	fieldDimension("location"),
+}
+
+// fieldDimension groups by a string field of the log.
+func fieldDimension(field string) Dimension {
+	return Dimension{Name: field, Value: func(_ *Service, record map[string]interface{}) string {
+		value, _ := record[field].(string)
+		return strings.TrimSpace(value)
+	}}
+}
+
+// Change compares a count with the one of the period before.
+type Change struct {
+	Change int `json:"change"`
+	// Percent is nil when the previous period had no logs.
+	Percent *float64 `json:"change_percent"`
+}
+
+// PeriodCount is the number of logs in one period.
+type PeriodCount struct {
+	Period string `json:"period"`
+	Start  string `json:"start"`
+	Count  int    `json:"count"`
+	Change
+}
+
+// GroupCount is the number of logs sharing a value. Series holds its count
+// per period, aligned with StatsResponse.Periods, and Change compares the
+// last two periods.
+type GroupCount struct {
+	Value  string `json:"value"`
+	Count  int    `json:"count"`
+	Series []int  `json:"series"`
+	Change
+}
+
+type StatsResponse struct {
+	Interval string `json:"interval"`
+	Total    int    `json:"total"`
+	// Undated counts logs without a usable date, which are left out of the
+	// periods and series.
+	Undated int                     `json:"undated"`
+	Periods []PeriodCount           `json:"periods"`
+	Groups  map[string][]GroupCount `json:"groups"`
+}
+
+// Stats counts the logs matching the Filter parameters per day, week or
+// month (interval, default month) and per severity, involved company,
+// location and the resource's own dimensions, with the change from one
+// period to the next. Periods run from start_date, or the first log, to
+// end_date, or the last log, so empty periods count as zero.
+func (s *Service) Stats(r *Resource, c *gin.Context) {
+	client, ok := s.newClient(c)
+	if !ok {
+		return
+	}
+
+	interval := strings.ToLower(c.DefaultQuery("interval", IntervalMonth))
+	if interval != IntervalDay && interval != IntervalWeek && interval != IntervalMonth {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be one of day, week, month"})
+		return
+	}
+
+	filters, ok := parseFilters(c)
+	if !ok {
+		return
+	}
+
+	logs, ok := fetchLogs[map[string]interface{}](c, s, r, client, filters)
+	if !ok {
+		return
+	}
+	logs = filters.filter(logs)
+
+	dimensions := append(append([]Dimension{}, statsDimensions...), r.Dimensions...)
+	response, err := s.buildStats(logs, interval, filters, dimensions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Service) buildStats(logs []map[string]interface{}, interval string, filters Filters, dimensions []Dimension) (StatsResponse, error) {
+	response := StatsResponse{
+		Interval: interval,
+		Total:    len(logs),
+		Periods:  make([]PeriodCount, 0),
+		Groups:   map[string][]GroupCount{},
+	}
+
+	starts := make([]time.Time, len(logs))
+	var first, last time.Time
+	for i, log := range logs {
+		date, _ := log["date"].(string)
+		t, err := time.Parse(DateLayout, date)
+		if err != nil {
+			response.Undated++
+			continue
+		}
+		starts[i] = periodStart(t, interval)
+		if first.IsZero() || starts[i].Before(first) {
+			first = starts[i]
+		}
+		if starts[i].After(last) {
+			last = starts[i]
+		}
+	}
+	if t, err := time.Parse(DateLayout, filters.StartDate); err == nil {
+		first = periodStart(t, interval)
+	}
+	if t, err := time.Parse(DateLayout, filters.EndDate); err == nil {
+		last = periodStart(t, interval)
+	}
+
+	index := map[time.Time]int{}
+	if !first.IsZero() && !last.IsZero() {
+		for t := first; !t.After(last); t = nextPeriod(t, interval) {
+			if len(response.Periods) == maxStatsPeriods {
+				return response, fmt.Errorf("more than %d periods; use a longer interval or a shorter date range", maxStatsPeriods)
+			}
+			index[t] = len(response.Periods)
+			response.Periods = append(response.Periods, PeriodCount{Period: periodLabel(t, interval), Start: t.Format(DateLayout)})
+		}
+	}
+	for _, start := range starts {
+		if i, ok := index[start]; ok {
+			response.Periods[i].Count++
+		}
+	}
+	for i := 1; i < len(response.Periods); i++ {
+		response.Periods[i].Change = change(response.Periods[i-1].Count, response.Periods[i].Count)
+	}
+
+	for _, dimension := range dimensions {
+		groups := map[string]*GroupCount{}
+		var order []string
+		for i, log := range logs {
+			value := firstNonEmpty(dimension.Value(s, log), none)
+			group, ok := groups[value]
+			if !ok {
+				group = &GroupCount{Value: value, Series: make([]int, len(response.Periods))}
+				groups[value] = group
+				order = append(order, value)
+			}
+			group.Count++
+			if p, ok := index[starts[i]]; ok {
+				group.Series[p]++
+			}
+		}
+
+		counts := make([]GroupCount, 0, len(order))
+		for _, value := range order {
+			group := groups[value]
+			if n := len(group.Series); n > 1 {
+				group.Change = change(group.Series[n-2], group.Series[n-1])
+			}
+			counts = append(counts, *group)
+		}
+		sort.SliceStable(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+		response.Groups[dimension.Name] = counts
+	}
+	return response, nil
+}
+
+func change(previous, current int) Change {
+	result := Change{Change: current - previous}
+	if previous > 0 {
+		percent := float64(current-previous) * 100 / float64(previous)
+		result.Percent = &percent
+	}
+	return result
+}
+
+// periodStart truncates t to the start of its day, ISO week (Monday) or
+// month.
+func periodStart(t time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -offset)
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t
+	}
+}
+
+func nextPeriod(t time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// periodLabel names a period: 2024-01-15, 2024-W03 or 2024-01.
+func periodLabel(t time.Time, interval string) string {
+	switch interval {
+	case IntervalWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case IntervalMonth:
+		return t.Format("2006-01")
+	default:
+		return t.Format(DateLayout)
+	}
+}
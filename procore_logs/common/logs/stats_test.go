@@ -0,0 +1,139 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeriods(t *testing.T) {
+	tests := []struct {
+		date, interval, start, label, next string
+	}{
+		{"2024-03-14", IntervalDay, "2024-03-14", "2024-03-14", "2024-03-15"},
+		{"2024-03-14", IntervalWeek, "2024-03-11", "2024-W11", "2024-03-18"},
+		{"2024-03-17", IntervalWeek, "2024-03-11", "2024-W11", "2024-03-18"},
+		{"2024-12-31", IntervalWeek, "2024-12-30", "2025-W01", "2025-01-06"},
+		{"2024-01-31", IntervalMonth, "2024-01-01", "2024-01", "2024-02-01"},
+		{"2024-12-05", IntervalMonth, "2024-12-01", "2024-12", "2025-01-01"},
+	}
+	for _, tt := range tests {
+		date, _ := time.Parse(DateLayout, tt.date)
+		start := periodStart(date, tt.interval)
+		if got := start.Format(DateLayout); got != tt.start {
+			t.Errorf("%s %s starts %s, want %s", tt.interval, tt.date, got, tt.start)
+		}
+		if got := periodLabel(start, tt.interval); got != tt.label {
+			t.Errorf("%s %s is labeled %s, want %s", tt.interval, tt.date, got, tt.label)
+		}
+		if got := nextPeriod(start, tt.interval).Format(DateLayout); got != tt.next {
+			t.Errorf("%s after %s is %s, want %s", tt.interval, tt.start, got, tt.next)
+		}
+	}
+}
+
+func TestBuildStats(t *testing.T) {
+	logs := []map[string]interface{}{
+		{"date": "2024-01-03", "severity": "high", "location": " gate "},
+		{"date": "2024-01-20", "severity": "low"},
+		{"date": "2024-03-02", "severity": "high", "location": "gate"},
+		{"date": "2024-03-09", "severity": "high"},
+		{"date": "2024-03-10", "severity": "high"},
+		{"date": "", "severity": "low"},
+	}
+	s := &Service{}
+	response, err := s.buildStats(logs, IntervalMonth, Filters{}, statsDimensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Total != 6 || response.Undated != 1 {
+		t.Errorf("total %d, undated %d", response.Total, response.Undated)
+	}
+	var periods []string
+	var counts []int
+	for _, p := range response.Periods {
+		periods = append(periods, p.Period)
+		counts = append(counts, p.Count)
+	}
+	if !reflect.DeepEqual(periods, []string{"2024-01", "2024-02", "2024-03"}) || !reflect.DeepEqual(counts, []int{2, 0, 3}) {
+		t.Errorf("periods %v with counts %v", periods, counts)
+	}
+	if march := response.Periods[2]; march.Change.Change != 3 || march.Percent != nil {
+		t.Errorf("change after an empty month = %+v", march.Change)
+	}
+	if feb := response.Periods[1]; feb.Change.Change != -2 || feb.Percent == nil || *feb.Percent != -100 {
+		t.Errorf("change to an empty month = %+v", feb.Change)
+	}
+
+	severity := response.Groups["severity"]
+	if len(severity) != 2 || severity[0].Value != "high" || severity[0].Count != 4 || !reflect.DeepEqual(severity[0].Series, []int{1, 0, 3}) {
+		t.Fatalf("severity groups = %+v", severity)
+	}
+	if low := severity[1]; low.Count != 2 || !reflect.DeepEqual(low.Series, []int{1, 0, 0}) || low.Change.Change != 0 {
+		t.Errorf("low group = %+v, want the undated log counted but not in the series", low)
+	}
+	location := response.Groups["location"]
+	if len(location) != 2 || location[0].Value != none || location[0].Count != 4 || location[1].Value != "gate" || location[1].Count != 2 {
+		t.Errorf("location groups = %+v", location)
+	}
+}
+
+func TestBuildStatsRange(t *testing.T) {
+	logs := []map[string]interface{}{{"date": "2024-03-13"}}
+	s := &Service{}
+
+	response, err := s.buildStats(logs, IntervalWeek, Filters{StartDate: "2024-02-28", EndDate: "2024-03-20"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var starts []string
+	for _, p := range response.Periods {
+		starts = append(starts, p.Start)
+	}
+	if want := []string{"2024-02-26", "2024-03-04", "2024-03-11", "2024-03-18"}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("weeks %v, want %v", starts, want)
+	}
+
+	if _, err := s.buildStats(logs, IntervalDay, Filters{StartDate: "2020-01-01", EndDate: "2024-01-01"}, nil); err == nil {
+		t.Error("four years of days were accepted")
+	}
+
+	empty, err := s.buildStats(nil, IntervalMonth, Filters{}, statsDimensions)
+	if err != nil || empty.Total != 0 || len(empty.Periods) != 0 || len(empty.Groups["severity"]) != 0 {
+		t.Errorf("stats of no logs = %+v, %v", empty, err)
+	}
+}
+
+func TestStatsAccidentTypes(t *testing.T) {
+	router := newTestRouter(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`[
+			{"id":1,"date":"2024-03-01","comments":"[AccidentType: slip_trip_fall]"},
+			{"id":2,"date":"2024-03-02","comments":"[AccidentType: slip_trip_fall] again"},
+			{"id":3,"date":"2024-03-03","comments":"no type"}
+		]`))
+	}), AccidentLogs)
+	get := func(query string) *httptest.ResponseRecorder {
+		return serve(router, http.MethodGet, "/api/accident-logs/stats?"+query, "")
+	}
+
+	w := get("interval=DAY")
+	var response StatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	types := response.Groups["accident_type"]
+	if len(types) != 2 || types[0].Value != "Slip, trip or fall" || types[0].Count != 2 || types[1].Value != none {
+		t.Errorf("accident type groups = %+v", types)
+	}
+	if len(response.Periods) != 3 {
+		t.Errorf("%d daily periods, want 3", len(response.Periods))
+	}
+
+	if w := get("interval=year"); w.Code != http.StatusBadRequest {
+		t.Errorf("interval=year: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package logs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiStub is Procore's API and login hosts. It records every request and
+// has respond answer it, one request at a time, so respond may keep state
+// without locking.
+type apiStub struct {
+	mu       sync.Mutex
+	requests []stubRequest
+	respond  http.HandlerFunc
+}
+
+// stubRequest is a request apiStub received, with its form parsed.
+type stubRequest struct {
+	Method string
+	Path   string
+	Form   url.Values
+}
+
+func (p *apiStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, stubRequest{Method: req.Method, Path: req.URL.Path, Form: req.PostForm})
+	p.respond(w, req)
+}
+
+// sent returns the requests received with one of methods, or all of them
+// when there are none.
+func (p *apiStub) sent(methods ...string) []stubRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sent := []stubRequest{}
+	for _, req := range p.requests {
+		if len(methods) == 0 || slices.Contains(methods, req.Method) {
+			sent = append(sent, req)
+		}
+	}
+	return sent
+}
+
+// newTestService is a Service for project 2 of company 1 against api,
+// with r registered on the router it returns. options adjust the Config
+// before the service starts.
+func newTestService(t *testing.T, api http.Handler, r *Resource, options ...func(*Config)) (*Service, http.Handler) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	cfg := Config{
+		Environment: procore.Environment{APIBaseURL: server.URL, LoginBaseURL: server.URL, APIVersion: "v1.0"},
+		CompanyID:   "1",
+		ProjectID:   "2",
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	s, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	s.Register(router, r)
+	return s, router
+}
+
+// newTestRouter is newTestService for tests that only send requests.
+func newTestRouter(t *testing.T, api http.Handler, r *Resource, options ...func(*Config)) http.Handler {
+	t.Helper()
+	_, router := newTestService(t, api, r, options...)
+	return router
+}
+
+// serve sends router a request with a bearer token and body, if any, as
+// JSON.
+func serve(router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,140 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"procore-common/mirror"
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultSyncSweepInterval is how often a sync fetches the full list of a
+// log type to find deletions when SYNC_SWEEP_INTERVAL is not set.
+const DefaultSyncSweepInterval = time.Hour
+
+// syncLoop keeps the mirror of every synced project current, every
+// SyncInterval.
+func (s *Service) syncLoop() {
+	ticker := time.NewTicker(s.Config.SyncInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.syncAll()
+	}
+}
+
+// syncAll syncs every registered log type of every synced project, as the
+// service account.
+func (s *Service) syncAll() {
+	for _, projectID := range s.Config.SyncProjectIDs {
+		client := procore.NewClient(s.Config.Environment.RestURL(), s.Config.CompanyID, projectID, s.ServiceAccount)
+		for _, r := range s.registered() {
+			ctx, cancel := context.WithTimeout(context.Background(), mirrorRefreshTimeout)
+			if err := s.sync(ctx, r, client); err != nil {
+				log.Printf("sync: %s failed: %v", mirrorKey(r, client), err)
+			}
+			cancel()
+		}
+	}
+}
+
+// sync brings the mirror of one log type up to date. Procore is asked only
+// for the logs updated since the watermark, except every SyncSweepInterval,
+// when the full list is fetched so deletions are seen.
+func (s *Service) sync(ctx context.Context, r *Resource, client *procore.Client) error {
+	key := mirrorKey(r, client)
+	meta, ok, err := s.Mirror.Store.Meta(key)
+	if err != nil {
+		return err
+	}
+	if !ok || meta.Watermark == "" || time.Since(meta.SweptAt) >= s.Config.SyncSweepInterval {
+		_, _, err := s.Mirror.refresh(ctx, key, r, client)
+		return err
+	}
+
+	started := time.Now()
+	query := url.Values{}
+	query.Set("filters[updated_at]", meta.Watermark+"..."+started.UTC().Format(time.RFC3339))
+	records, _, err := procore.ListPages[json.RawMessage](ctx, client, client.ProjectPath(r.Name), query, procore.Page{})
+	if err != nil {
+		return err
+	}
+	changes, err := s.Mirror.Store.Apply(key, records, started)
+	if err != nil {
+		return err
+	}
+	s.Mirror.changed(key, changes)
+	return nil
+}
+
+// registered returns the registered log types in name order.
+func (s *Service) registered() []*Resource {
+	s.resourcesMu.Lock()
+	defer s.resourcesMu.Unlock()
+	resources := make([]*Resource, 0, len(s.resources))
+	for _, r := range s.resources {
+		resources = append(resources, r)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Name < resources[j].Name })
+	return resources
+}
+
+// LogChange is a mirror.Change with its log decoded like a read's.
+type LogChange struct {
+	mirror.Change
+	Record map[string]interface{} `json:"record"`
+}
+
+type ChangesResponse struct {
+	Changes []LogChange `json:"changes"`
+	// Cursor is the since of the next request.
+	Cursor uint64 `json:"cursor"`
+}
+
+// Changes returns the journal of the log type: the logs the mirror found
+// created, updated or deleted, oldest first. since is the cursor of a
+// previous response or an RFC 3339 time; without it every change still
+// kept is returned.
+func (s *Service) Changes(r *Resource, c *gin.Context) {
+	if s.Mirror == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "MIRROR_PATH is not configured"})
+		return
+	}
+	client, ok := s.projectClient(c)
+	if !ok {
+		return
+	}
+
+	var after uint64
+	var since time.Time
+	if value := c.Query("since"); value != "" {
+		var err error
+		if after, err = strconv.ParseUint(value, 10, 64); err != nil {
+			if since, err = time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a cursor or an RFC 3339 time"})
+				return
+			}
+		}
+	}
+
+	changes, cursor, err := s.Mirror.Store.Changes(mirrorKey(r, client), after, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := ChangesResponse{Changes: make([]LogChange, len(changes)), Cursor: cursor}
+	for i, change := range changes {
+		response.Changes[i].Change = change
+		if err := json.Unmarshal(change.Record, &response.Changes[i].Record); err == nil {
+			s.decodeRecord(r, response.Changes[i].Record)
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,135 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"procore-common/mirror"
+	"procore-common/procore"
+)
+
+// syncAPI is Procore with the call logs of project 2 in upstream, by ID.
+func syncAPI(upstream map[int]string) *apiStub {
+	return &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/rest/v1.0/projects":
+			w.Write([]byte(`[{"id":2,"name":"Two"}]`))
+		case "/rest/v1.0/projects/2/call_logs":
+			logs := []map[string]interface{}{}
+			for id, comments := range upstream {
+				logs = append(logs, map[string]interface{}{"id": id, "comments": comments, "updated_at": "2026-01-01T00:00:00Z"})
+			}
+			json.NewEncoder(w).Encode(logs)
+		default:
+			http.NotFound(w, req)
+		}
+	}}
+}
+
+// syncNow runs one sync of project 2's call logs. The test config has no
+// SyncSweepInterval, so every sync fetches the full list.
+func syncNow(t *testing.T, s *Service) {
+	t.Helper()
+	client := procore.NewClient(s.Config.Environment.RestURL(), "1", "2", procore.StaticToken("token"))
+	if err := s.sync(context.Background(), CallLogs, client); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func changes(t *testing.T, router http.Handler, since string) ChangesResponse {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/api/call_logs/changes?since="+since, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("since %q: status = %d: %s", since, w.Code, w.Body)
+	}
+	var response ChangesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func changeKinds(response ChangesResponse) []string {
+	kinds := []string{}
+	for _, change := range response.Changes {
+		kinds = append(kinds, change.Kind+" "+change.ID)
+	}
+	return kinds
+}
+
+func TestChangesReportsDeletion(t *testing.T) {
+	upstream := map[int]string{1: "kept", 2: "deleted upstream"}
+	s, router := newTestService(t, syncAPI(upstream), CallLogs, mirrored(t, time.Hour))
+	// The first copy is not journaled.
+	syncNow(t, s)
+	start := changes(t, router, "")
+	if len(start.Changes) != 0 {
+		t.Fatalf("first sync: changes %v, want none", changeKinds(start))
+	}
+
+	upstream[3] = "added upstream"
+	syncNow(t, s)
+	added := changes(t, router, fmt.Sprint(start.Cursor))
+	if got := changeKinds(added); len(got) != 1 || got[0] != mirror.Created+" 3" {
+		t.Fatalf("after adding log 3 upstream: changes %v, want only its creation", got)
+	}
+
+	delete(upstream, 2)
+	syncNow(t, s)
+	deleted := changes(t, router, fmt.Sprint(added.Cursor))
+	if got := changeKinds(deleted); len(got) != 1 || got[0] != mirror.Deleted+" 2" {
+		t.Fatalf("after deleting log 2 upstream: changes %v, want only its deletion", got)
+	}
+	if comments := deleted.Changes[0].Record["comments"]; comments != "deleted upstream" {
+		t.Errorf("deletion record comments = %v, want the log as last seen", comments)
+	}
+	if deleted.Cursor <= added.Cursor {
+		t.Errorf("cursor = %d, want past %d", deleted.Cursor, added.Cursor)
+	}
+
+	if caughtUp := changes(t, router, fmt.Sprint(deleted.Cursor)); len(caughtUp.Changes) != 0 || caughtUp.Cursor != deleted.Cursor {
+		t.Errorf("since the returned cursor: changes %v, cursor %d; want none and %d", changeKinds(caughtUp), caughtUp.Cursor, deleted.Cursor)
+	}
+}
+
+func TestChangesSince(t *testing.T) {
+	upstream := map[int]string{1: "log"}
+	s, router := newTestService(t, syncAPI(upstream), CallLogs, mirrored(t, time.Hour))
+	syncNow(t, s)
+	upstream[2] = "added"
+	syncNow(t, s)
+
+	tests := []struct {
+		since string
+		want  int
+	}{
+		{"", 1},
+		{"0", 1},
+		{"1", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(time.RFC3339), 1},
+		{time.Now().Add(time.Hour).UTC().Format(time.RFC3339), 0},
+	}
+	for _, tt := range tests {
+		response := changes(t, router, tt.since)
+		if len(response.Changes) != tt.want || response.Cursor != 1 {
+			t.Errorf("since %q: changes %v, cursor %d; want %d and cursor 1", tt.since, changeKinds(response), response.Cursor, tt.want)
+		}
+	}
+
+	for _, since := range []string{"yesterday", "-1", "2026-01-01"} {
+		if w := serve(router, http.MethodGet, "/api/call_logs/changes?since="+since, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("since %q: status = %d, want 400", since, w.Code)
+		}
+	}
+}
+
+func TestChangesWithoutMirror(t *testing.T) {
+	router := newTestRouter(t, syncAPI(nil), CallLogs)
+	if w := serve(router, http.MethodGet, "/api/call_logs/changes", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,125 @@
+package logs
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"procore-common/procore"
+	"procore-common/query"
+)
+
+// DefaultCommentTags are the bracketed tags read from the comments of
+// every log type, e.g. [BodyPart: hand], unless COMMENT_TAGS replaces
+// them. Accident type markers are decoded into type instead.
+var DefaultCommentTags = []string{"Injury", "BodyPart", "Equipment", "Witness"}
+
+// tagPattern finds "[Name: value]" tags; which names count is up to
+// Config.CommentTags.
+var tagPattern = regexp.MustCompile(`\[([A-Za-z][A-Za-z0-9_ -]*):\s*([^\]]*)\]`)
+
+var tagKeyPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// tagKey normalizes a tag name, so [Body Part: ...] and [bodypart: ...]
+// are both BodyPart.
+func tagKey(name string) string {
+	return tagKeyPattern.ReplaceAllString(strings.ToLower(name), "")
+}
+
+// extractTags returns the tags of names found in comments, keyed by their
+// configured spelling. A tag given more than once holds the list of its
+// values, which tag.<Name>=value matches element by element.
+func extractTags(names []string, comments string) map[string]interface{} {
+	tags := map[string]interface{}{}
+	for _, m := range tagPattern.FindAllStringSubmatch(comments, -1) {
+		value := strings.TrimSpace(m[2])
+		if value == "" {
+			continue
+		}
+		for _, name := range names {
+			if tagKey(name) != tagKey(m[1]) {
+				continue
+			}
+			switch previous := tags[name].(type) {
+			case nil:
+				tags[name] = value
+			case string:
+				tags[name] = []interface{}{previous, value}
+			case []interface{}:
+				tags[name] = append(previous, value)
+			}
+			break
+		}
+	}
+	return tags
+}
+
+// decodeLogs adds what the comments of logs read from Procore encode: the
+// tags of every log, and the type of Typed ones.
+func decodeLogs[T any](s *Service, r *Resource, logs []T) {
+	switch logs := any(logs).(type) {
+	case []map[string]interface{}:
+		for _, record := range logs {
+			s.decodeRecord(r, record)
+		}
+	case []procore.Log:
+		if r.Typed {
+			for i := range logs {
+				logs[i].Type = s.Config.AccidentTypes.extract(logs[i].Comments)
+			}
+		}
+	}
+}
+
+func (s *Service) decodeRecord(r *Resource, record map[string]interface{}) {
+	comments, _ := record["comments"].(string)
+	record["tags"] = extractTags(s.Config.CommentTags, comments)
+	if r.Typed {
+		record["type"] = s.Config.AccidentTypes.extract(comments)
+	}
+}
+
+// tagFilters adds a condition for each tag.<Name>=value parameter and
+// points tag.<Name> in the query language at the tags map, so
+// tag.BodyPart=hand, where=tag.BodyPart~hand, sort=tag.BodyPart and
+// fields=tag.BodyPart all work. Projected tags keep the tag.<Name> key.
+func tagFilters(q *query.Query, values url.Values) {
+	for i, expr := range q.Where {
+		if condition, ok := expr.(query.Condition); ok {
+			condition.Field = tagField(condition.Field)
+			q.Where[i] = condition
+		}
+	}
+	for i := range q.Sort {
+		q.Sort[i].Field = tagField(q.Sort[i].Field)
+	}
+	for _, field := range q.Fields {
+		if path := tagField(field); path != field {
+			if q.Paths == nil {
+				q.Paths = map[string]string{}
+			}
+			q.Paths[field] = path
+		}
+	}
+
+	var keys []string
+	for key := range values {
+		if strings.HasPrefix(key, "tag.") && !strings.ContainsAny(key, "<>!~") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range values[key] {
+			q.Where = append(q.Where, query.Condition{Field: tagField(key), Op: query.Eq, Value: query.ParseLiteral(value)})
+		}
+	}
+}
+
+func tagField(field string) string {
+	if name, ok := strings.CutPrefix(field, "tag."); ok {
+		return "tags." + name
+	}
+	return field
+}
@@ -0,0 +1,96 @@
+package logs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestExtractTags(t *testing.T) {
+	names := []string{"BodyPart", "Witness"}
+	tests := []struct {
+		comments string
+		want     map[string]interface{}
+	}{
+		{"no tags", map[string]interface{}{}},
+		{"[BodyPart: hand] cut", map[string]interface{}{"BodyPart": "hand"}},
+		{"[body part: hand] [WITNESS: Ann]", map[string]interface{}{"BodyPart": "hand", "Witness": "Ann"}},
+		{"[Witness: Ann] [Witness: Bo] [Witness: Cy]", map[string]interface{}{"Witness": []interface{}{"Ann", "Bo", "Cy"}}},
+		{"[Witness: ] [Crew: B] [AccidentType: burn]", map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		if got := extractTags(names, tt.comments); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("extractTags(%q) = %v, want %v", tt.comments, got, tt.want)
+		}
+	}
+}
+
+func tagRouter(t *testing.T) http.Handler {
+	t.Helper()
+	return newTestRouter(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`[
+			{"id":1,"comments":"[Witness: Ann Lee] [Witness: Bo Chen] [BodyPart: hand]"},
+			{"id":2,"comments":"[Witness: Bo Chen, Jr] [BodyPart: Foot]"},
+			{"id":3,"comments":"no tags"}
+		]`))
+	}), CallLogs)
+}
+
+func filterTags(t *testing.T, router http.Handler, query string) []map[string]interface{} {
+	t.Helper()
+	w := serve(router, http.MethodGet, "/api/call_logs/filter?"+query, "")
+	var logs []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &logs); err != nil {
+		t.Fatalf("%s: status %d: %s", query, w.Code, w.Body)
+	}
+	return logs
+}
+
+func TestTagFilters(t *testing.T) {
+	router := tagRouter(t)
+	tests := []struct {
+		query string
+		ids   []float64
+	}{
+		{"tag.Witness=bo+chen", []float64{1}},
+		{"tag.witness=Bo+Chen,+Jr", []float64{2}},
+		{"tag.Witness=Bo", nil},
+		{"where=tag.Witness~chen", []float64{1, 2}},
+		{"where=tag.Witness!=Ann+Lee", []float64{2, 3}},
+		{"tag.BodyPart=HAND", []float64{1}},
+		{"tag.BodyPart=hand&tag.Witness=Bo+Chen,+Jr", nil},
+		{"sort=tag.BodyPart", []float64{2, 1, 3}},
+	}
+	for _, tt := range tests {
+		var ids []float64
+		for _, log := range filterTags(t, router, tt.query) {
+			ids = append(ids, log["id"].(float64))
+		}
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("%s: ids %v, want %v", tt.query, ids, tt.ids)
+		}
+	}
+}
+
+func TestTagProjection(t *testing.T) {
+	router := tagRouter(t)
+	got := filterTags(t, router, "fields=id,tag.BodyPart,tag.Witness&tag.BodyPart=hand")
+	want := []map[string]interface{}{{"id": float64(1), "tag.BodyPart": "hand", "tag.Witness": []interface{}{"Ann Lee", "Bo Chen"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("projected %v, want %v", got, want)
+	}
+
+	// Streamed and sorted exports alike.
+	for _, query := range []string{"format=csv&fields=id,tag.BodyPart", "format=csv&fields=id,tag.BodyPart&sort=id"} {
+		w := serve(router, http.MethodGet, "/api/call_logs/filter?"+query, "")
+		rows, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := [][]string{{"id", "tag.BodyPart"}, {"1", "hand"}, {"2", "Foot"}, {"3", ""}}; !reflect.DeepEqual(rows, want) {
+			t.Errorf("%s: rows %q, want %q", query, rows, want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package logs
+
+import "net/http"
+
+// Procore daily log types served by this repository. Adding another type
+// (weather, delivery, visitor, manpower, ...) is one more NewResource line
+// plus an entry in All.
+var (
+	AccidentLogs  = accidentLogs()
+	CallLogs      = NewResource("call_logs", "call_log", "/api/call_logs")
+	EquipmentLogs = NewResource("equipment_logs", "equipment_log", "/api/equipment_logs")
+)
+
+// All lists every log type, in the order the gateway mounts them.
+var All = []*Resource{AccidentLogs, CallLogs, EquipmentLogs}
+
+func accidentLogs() *Resource {
+	r := NewResource("accident_logs", "accident_log", "/api/accident-logs")
+	r.Validate = validateAccident
+	r.Typed = true
+	r.Dimensions = []Dimension{{Name: "accident_type", Value: func(s *Service, record map[string]interface{}) string {
+		code, _ := record["type"].(string)
+		return s.Config.AccidentTypes.label(code)
+	}}}
+	r.Routes = []Route{
+		{Method: http.MethodGet, Path: "/api/accident-type-logs/filter", Handler: (*Service).AccidentTypes},
+		{Method: http.MethodGet, Path: "/api/accident-logs/types", Handler: (*Service).ListAccidentTypes},
+		{Method: http.MethodPost, Path: "/api/accident-logs/types/migrate", Handler: (*Service).MigrateAccidentTypes},
+		{Method: http.MethodGet, Path: "/api/accident-logs/osha", Handler: (*Service).OSHA},
+	}
+	return r
+}
@@ -0,0 +1,147 @@
+package logs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"procore-common/procore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DateLayout is the format of a log's date field.
+const DateLayout = "2006-01-02"
+
+// Severities are the severity values a validated log may carry.
+var Severities = []string{"low", "medium", "high"}
+
+// FieldError explains why one request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is the body of a 400 for a rejected log.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validator checks a write before it is sent to Procore. Creates are
+// passed as a patch setting every field; for updates, fields the patch does
+// not set are left alone.
+type Validator func(s *Service, patch procore.LogPatch, create bool) ValidationErrors
+
+// validateAccident requires a date and an involved name, which an update
+// may not clear, and checks the format and range of every field that is
+// set.
+func validateAccident(s *Service, patch procore.LogPatch, create bool) ValidationErrors {
+	var errs ValidationErrors
+
+	if create || patch.Date.Set {
+		if patch.Date.Value == "" {
+			errs.add("date", "is required")
+		} else if _, err := time.Parse(DateLayout, patch.Date.Value); err != nil {
+			errs.add("date", "must be a date in YYYY-MM-DD format")
+		}
+	}
+
+	if hour := patch.TimeHour.Value; hour < 0 || hour > 23 {
+		errs.add("time_hour", "must be between 0 and 23")
+	}
+	if minute := patch.TimeMinute.Value; minute < 0 || minute > 59 {
+		errs.add("time_minute", "must be between 0 and 59")
+	}
+
+	if (create || patch.InvolvedName.Set) && strings.TrimSpace(patch.InvolvedName.Value) == "" {
+		errs.add("involved_name", "is required")
+	}
+
+	if severity := patch.Severity.Value; severity != "" && !slices.Contains(Severities, severity) {
+		errs.add("severity", "must be one of %s", strings.Join(Severities, ", "))
+	}
+
+	if value := patch.Type.Value; value != "" {
+		if _, ok := s.Config.AccidentTypes.lookup(value); !ok {
+			errs.add("type", "must be one of %s", strings.Join(s.Config.AccidentTypes.codes(), ", "))
+		}
+	}
+	return errs
+}
+
+// normalizeSeverity lowercases a severity before it is validated and sent,
+// as the filters match it case-insensitively and stats group it as stored.
+func normalizeSeverity(severity *string) {
+	*severity = strings.ToLower(strings.TrimSpace(*severity))
+}
+
+// bindLog decodes a new log from the request body and runs the resource's
+// validator. It writes a 400 listing the offending fields and returns false
+// on failure.
+func (s *Service) bindLog(c *gin.Context, r *Resource) (procore.Log, bool) {
+	var log procore.Log
+	if err := c.ShouldBindJSON(&log); err != nil {
+		validationError(c, bindingErrors(err))
+		return log, false
+	}
+	normalizeSeverity(&log.Severity)
+	return log, s.validate(c, r, log.Patch(), true)
+}
+
+// bindPatch is bindLog for a partial update.
+func (s *Service) bindPatch(c *gin.Context, r *Resource) (procore.LogPatch, bool) {
+	var patch procore.LogPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		validationError(c, bindingErrors(err))
+		return patch, false
+	}
+	normalizeSeverity(&patch.Severity.Value)
+	return patch, s.validate(c, r, patch, false)
+}
+
+func (s *Service) validate(c *gin.Context, r *Resource, patch procore.LogPatch, create bool) bool {
+	if r.Validate == nil {
+		return true
+	}
+	if errs := r.Validate(s, patch, create); len(errs) > 0 {
+		validationError(c, errs)
+		return false
+	}
+	return true
+}
+
+// bindingErrors turns a JSON decoding error into field errors.
+func bindingErrors(err error) ValidationErrors {
+	var errs ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		kind := "string"
+		if typeErr.Type.Kind() != reflect.String {
+			kind = "number"
+		}
+		errs.add(typeErr.Field, "must be a %s", kind)
+	default:
+		errs.add("body", "must be a JSON object: %s", err.Error())
+	}
+	return errs
+}
+
+func validationError(c *gin.Context, errs ValidationErrors) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log", "fields": errs})
+}
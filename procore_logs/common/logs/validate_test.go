@@ -0,0 +1,124 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"procore-common/procore"
+)
+
+func fieldNames(errs ValidationErrors) []string {
+	names := []string{}
+	for _, fe := range errs {
+		names = append(names, fe.Field)
+	}
+	return names
+}
+
+func TestValidateAccident(t *testing.T) {
+	s := &Service{Config: Config{AccidentTypes: DefaultAccidentTypes}}
+	valid := procore.Log{Date: "2024-03-01", InvolvedName: "Jane", TimeHour: 9, TimeMinute: 30, Severity: "high", Type: "slip_trip_fall"}
+
+	tests := []struct {
+		name   string
+		patch  procore.LogPatch
+		create bool
+		fields []string
+	}{
+		{"valid create", valid.Patch(), true, []string{}},
+		{"empty create", procore.Log{}.Patch(), true, []string{"date", "involved_name"}},
+		{"bad date", procore.Log{Date: "03/01/2024", InvolvedName: "Jane"}.Patch(), true, []string{"date"}},
+		{"time out of range", procore.Log{Date: "2024-03-01", InvolvedName: "Jane", TimeHour: 24, TimeMinute: -1}.Patch(), true, []string{"time_hour", "time_minute"}},
+		{"unknown severity", procore.Log{Date: "2024-03-01", InvolvedName: "Jane", Severity: "urgent"}.Patch(), true, []string{"severity"}},
+		{"unknown type", procore.Log{Date: "2024-03-01", InvolvedName: "Jane", Type: "meteor"}.Patch(), true, []string{"type"}},
+		{"type by label", procore.Log{Date: "2024-03-01", InvolvedName: "Jane", Type: "Slip, trip or fall"}.Patch(), true, []string{}},
+		{"empty update", procore.LogPatch{}, false, []string{}},
+		{"update of one field", procore.LogPatch{Location: procore.Value("north gate")}, false, []string{}},
+		{"update clearing the name", procore.LogPatch{InvolvedName: procore.Value(" ")}, false, []string{"involved_name"}},
+		{"update clearing the date", procore.LogPatch{Date: procore.Field[string]{Set: true, Null: true}}, false, []string{"date"}},
+		{"update with a bad hour", procore.LogPatch{TimeHour: procore.Value(99)}, false, []string{"time_hour"}},
+	}
+	for _, tt := range tests {
+		if got := fieldNames(validateAccident(s, tt.patch, tt.create)); !reflect.DeepEqual(got, tt.fields) {
+			t.Errorf("%s: rejected %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+func TestBindingErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		want FieldError
+	}{
+		{`{"time_hour":"nine"}`, FieldError{"time_hour", "must be a number"}},
+		{`{"involved_name":7}`, FieldError{"involved_name", "must be a string"}},
+		{`[1]`, FieldError{"body", ""}},
+		{`{"date":`, FieldError{"body", ""}},
+	}
+	for _, tt := range tests {
+		var patch procore.LogPatch
+		err := json.Unmarshal([]byte(tt.body), &patch)
+		if err == nil {
+			t.Errorf("%s decoded", tt.body)
+			continue
+		}
+		errs := bindingErrors(err)
+		if len(errs) != 1 || errs[0].Field != tt.want.Field ||
+			tt.want.Message != "" && errs[0].Message != tt.want.Message ||
+			tt.want.Field == "body" && !strings.HasPrefix(errs[0].Message, "must be a JSON object") {
+			t.Errorf("%s: bindingErrors = %+v, want %+v", tt.body, errs, tt.want)
+		}
+	}
+}
+
+func TestWriteValidation(t *testing.T) {
+	stub := &apiStub{respond: func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":5}`))
+	}}
+	router := newTestRouter(t, stub, AccidentLogs)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		sent   string
+		fields []string
+	}{
+		{"create", http.MethodPost, "/api/accident-logs", `{"date":"2024-03-01","involved_name":"Jane","severity":"High"}`, http.StatusCreated, "POST high", nil},
+		{"update", http.MethodPatch, "/api/accident-logs/5", `{"severity":" LOW "}`, http.StatusCreated, "PUT low", nil},
+		{"invalid create", http.MethodPost, "/api/accident-logs", `{"date":"tomorrow","severity":"urgent"}`, http.StatusBadRequest, "", []string{"date", "involved_name", "severity"}},
+		{"mistyped update", http.MethodPatch, "/api/accident-logs/5", `{"time_minute":"thirty"}`, http.StatusBadRequest, "", []string{"time_minute"}},
+	}
+	for _, tt := range tests {
+		before := len(stub.sent())
+		w := serve(router, tt.method, tt.path, tt.body)
+		var forms []string
+		for _, req := range stub.sent()[before:] {
+			forms = append(forms, req.Method+" "+req.Form.Get("accident_log[severity]"))
+		}
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d: %s", tt.name, w.Code, w.Body)
+			continue
+		}
+		if tt.sent != "" && (len(forms) != 1 || forms[0] != tt.sent) {
+			t.Errorf("%s: Procore got %v, want %s", tt.name, forms, tt.sent)
+		}
+		if tt.fields == nil {
+			continue
+		}
+		var body struct {
+			Fields ValidationErrors `json:"fields"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if got := fieldNames(body.Fields); !reflect.DeepEqual(got, tt.fields) || len(forms) > 0 {
+			t.Errorf("%s: rejected %v and sent %v, want %v rejected and nothing sent", tt.name, got, forms, tt.fields)
+		}
+	}
+}
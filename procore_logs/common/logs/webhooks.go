@@ -0,0 +1,599 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"procore-common/mirror"
+	"procore-common/procore"
+	"procore-common/query"
+	"procore-common/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sources of an event.
+const (
+	SourceGateway = "gateway"
+	SourceSync    = "sync"
+	SourceProcore = "procore"
+)
+
+const (
+	// webhookTick is how often due deliveries are looked for.
+	webhookTick = 5 * time.Second
+	// webhookBackoff is the wait after the first failed attempt; it
+	// doubles with every attempt after.
+	webhookBackoff = 30 * time.Second
+	// webhookMaxBackoff caps the wait between attempts.
+	webhookMaxBackoff = time.Hour
+	// webhookMaxAttempts is how many times a delivery is tried before it
+	// is marked failed.
+	webhookMaxAttempts = 8
+	// webhookTimeout bounds one attempt.
+	webhookTimeout = 10 * time.Second
+	// webhookRetention is how long finished deliveries stay in the log.
+	webhookRetention = 30 * 24 * time.Hour
+	// publishedMemory is how long a published change is remembered, so
+	// the sync does not announce a write the gateway already announced.
+	publishedMemory = time.Hour
+)
+
+// eventTypes are the events a subscription may ask for.
+var eventTypes = []string{mirror.Created, mirror.Updated, mirror.Deleted}
+
+// publishedSet remembers recently published changes. order holds them
+// oldest first, so the expired ones are dropped from its front.
+type publishedSet struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	order []publishedKey
+}
+
+type publishedKey struct {
+	key string
+	at  time.Time
+}
+
+// first records key and reports whether it was not seen before.
+func (p *publishedSet) first(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.seen == nil {
+		p.seen = map[string]time.Time{}
+	}
+	now := time.Now()
+	expired := 0
+	for expired < len(p.order) && now.Sub(p.order[expired].at) > publishedMemory {
+		delete(p.seen, p.order[expired].key)
+		expired++
+	}
+	p.order = p.order[expired:]
+
+	if _, ok := p.seen[key]; ok {
+		return false
+	}
+	p.seen[key] = now
+	p.order = append(p.order, publishedKey{key, now})
+	return true
+}
+
+// publish queues a delivery of a change of one log to every subscription
+// matching it. record is the log as Procore returns it.
+func (s *Service) publish(r *Resource, companyID, projectID, kind, source string, record map[string]interface{}) {
+	if s.Webhooks == nil || r == nil || record == nil {
+		return
+	}
+	id := recordID(record)
+	version, _ := record["updated_at"].(string)
+	if kind == mirror.Deleted {
+		version = mirror.Deleted
+	}
+	if version != "" && !s.published.first(strings.Join([]string{companyID, projectID, r.Name, id, version}, "/")) {
+		return
+	}
+
+	s.decodeRecord(r, record)
+	eventID, err := procore.RandomString(12)
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+		return
+	}
+	event := webhook.Event{
+		ID:         eventID,
+		Type:       kind,
+		LogType:    r.Name,
+		CompanyID:  companyID,
+		ProjectID:  projectID,
+		LogID:      id,
+		Source:     source,
+		OccurredAt: time.Now().UTC(),
+		Record:     record,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+		return
+	}
+
+	subs, err := s.Webhooks.Subscriptions()
+	if err != nil {
+		log.Printf("webhooks: failed to read subscriptions: %v", err)
+		return
+	}
+	queued := false
+	for _, sub := range subs {
+		if !subscribed(sub, event) {
+			continue
+		}
+		d := webhook.Delivery{SubscriptionID: sub.ID, URL: sub.URL, EventID: event.ID, EventType: event.Type, Body: body}
+		if _, err := s.Webhooks.AddDelivery(d); err != nil {
+			log.Printf("webhooks: failed to queue delivery to %s: %v", sub.ID, err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		s.wakeWebhooks()
+	}
+}
+
+// publishRaw is publish for a log as JSON; one that cannot be read is
+// published with only its id.
+func (s *Service) publishRaw(r *Resource, client *procore.Client, kind, source, id string, raw json.RawMessage) {
+	var record map[string]interface{}
+	if json.Unmarshal(raw, &record) != nil || record == nil {
+		record = map[string]interface{}{}
+	}
+	if _, ok := record["id"]; !ok && id != "" {
+		record["id"] = id
+	}
+	s.publish(r, client.CompanyID, client.ProjectID, kind, source, record)
+}
+
+// publishDeleted publishes the deletion of a log, as the mirror last saw
+// it when it did.
+func (s *Service) publishDeleted(r *Resource, client *procore.Client, id string) {
+	var record json.RawMessage
+	if s.Mirror != nil {
+		record, _, _, _ = s.Mirror.Store.Record(mirrorKey(r, client), id)
+	}
+	s.publishRaw(r, client, mirror.Deleted, SourceGateway, id, record)
+}
+
+// publishResults publishes the writes of a batch that succeeded and were
+// not rolled back.
+func (s *Service) publishResults(r *Resource, client *procore.Client, results []BulkResult) {
+	if s.Webhooks == nil {
+		return
+	}
+	for _, result := range results {
+		if !result.succeeded() || result.RolledBack {
+			continue
+		}
+		switch result.Op {
+		case OpCreate:
+			s.publishRaw(r, client, mirror.Created, SourceGateway, result.ID, result.Log)
+		case OpUpdate:
+			s.publishRaw(r, client, mirror.Updated, SourceGateway, result.ID, result.Log)
+		case OpDelete:
+			s.publishDeleted(r, client, result.ID)
+		}
+	}
+}
+
+// publishChanges publishes what a mirror refresh or sync found.
+func (s *Service) publishChanges(key mirror.Key, changes []mirror.Change) {
+	r := s.resource(key.Resource)
+	for _, change := range changes {
+		var record map[string]interface{}
+		if err := json.Unmarshal(change.Record, &record); err != nil {
+			continue
+		}
+		s.publish(r, key.CompanyID, key.ProjectID, change.Kind, SourceSync, record)
+	}
+}
+
+// recordID returns the id of a decoded log as a string.
+func recordID(record map[string]interface{}) string {
+	switch id := record["id"].(type) {
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	case string:
+		return id
+	}
+	return ""
+}
+
+// subscribed reports whether sub asked for event.
+func subscribed(sub webhook.Subscription, event webhook.Event) bool {
+	if sub.CompanyID != event.CompanyID || sub.ProjectID != event.ProjectID {
+		return false
+	}
+	if len(sub.Events) > 0 && !slices.Contains(sub.Events, event.Type) {
+		return false
+	}
+	if len(sub.LogTypes) > 0 && !slices.Contains(sub.LogTypes, event.LogType) {
+		return false
+	}
+	if sub.Where == "" {
+		return true
+	}
+	q, err := subscriptionQuery(sub.Where)
+	return err == nil && q.Where.Match(event.Record)
+}
+
+// subscriptionQuery parses the where of a subscription like the where
+// parameter of the filter endpoints, tags included.
+func subscriptionQuery(where string) (*query.Query, error) {
+	values := url.Values{"where": {where}}
+	q, err := query.Parse(values)
+	if err != nil {
+		return nil, err
+	}
+	tagFilters(q, values)
+	return q, nil
+}
+
+// deliverWebhooks sends due deliveries every webhookTick, and whenever an
+// event is published.
+func (s *Service) deliverWebhooks() {
+	ticker := time.NewTicker(webhookTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.webhooksWake:
+		}
+		s.deliverDue()
+	}
+}
+
+func (s *Service) wakeWebhooks() {
+	select {
+	case s.webhooksWake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue sends the due deliveries and drops finished ones past
+// webhookRetention. Each subscriber gets its deliveries oldest first, from
+// its own goroutine, so a slow one holds up nobody else; a subscriber
+// still busy with an earlier batch is skipped until it is done.
+func (s *Service) deliverDue() {
+	now := time.Now()
+	due, err := s.Webhooks.Due(now)
+	if err != nil {
+		log.Printf("webhooks: failed to read due deliveries: %v", err)
+		return
+	}
+	batches := map[string][]webhook.Delivery{}
+	for _, d := range due {
+		batches[d.SubscriptionID] = append(batches[d.SubscriptionID], d)
+	}
+	for subID, batch := range batches {
+		if !s.delivering.start(subID) {
+			continue
+		}
+		go func(subID string, batch []webhook.Delivery) {
+			defer s.delivering.done(subID)
+			for _, d := range batch {
+				s.deliver(d)
+			}
+		}(subID, batch)
+	}
+	if err := s.Webhooks.Prune(now.Add(-webhookRetention)); err != nil {
+		log.Printf("webhooks: failed to prune deliveries: %v", err)
+	}
+}
+
+// busySet tracks the subscribers a delivery goroutine is working for.
+type busySet struct {
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// start marks id busy and reports whether it was idle.
+func (b *busySet) start(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.busy[id] {
+		return false
+	}
+	if b.busy == nil {
+		b.busy = map[string]bool{}
+	}
+	b.busy[id] = true
+	return true
+}
+
+func (b *busySet) done(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.busy, id)
+}
+
+// deliver makes one attempt at a delivery and records the outcome. A
+// failed attempt is retried with an exponential backoff until it runs out
+// of attempts.
+func (s *Service) deliver(d webhook.Delivery) {
+	sub, err := s.Webhooks.Subscription(d.SubscriptionID)
+	if errors.Is(err, webhook.ErrNotFound) {
+		d.Status, d.Error = webhook.StatusFailed, "the subscription was deleted"
+		s.updateDelivery(d)
+		return
+	}
+	if err != nil {
+		log.Printf("webhooks: failed to read subscription %s: %v", d.SubscriptionID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	d.ResponseStatus, err = webhook.Send(ctx, s.webhookClient, d, sub.Secret)
+	d.Attempts++
+	switch {
+	case err == nil:
+		now := time.Now()
+		d.Status, d.Error, d.DeliveredAt = webhook.StatusDelivered, "", &now
+	case d.Attempts >= webhookMaxAttempts:
+		d.Status, d.Error = webhook.StatusFailed, err.Error()
+	default:
+		backoff := webhookBackoff << (d.Attempts - 1)
+		if backoff > webhookMaxBackoff || backoff <= 0 {
+			backoff = webhookMaxBackoff
+		}
+		d.Error, d.NextAttemptAt = err.Error(), time.Now().Add(backoff)
+	}
+	s.updateDelivery(d)
+}
+
+func (s *Service) updateDelivery(d webhook.Delivery) {
+	if err := s.Webhooks.UpdateDelivery(d); err != nil {
+		log.Printf("webhooks: failed to update delivery %d: %v", d.ID, err)
+	}
+}
+
+// webhooksClient is newClient for the webhook routes, which need webhooks
+// enabled and the caller's access to the project checked.
+func (s *Service) webhooksClient(c *gin.Context) (*procore.Client, bool) {
+	if s.Webhooks == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "WEBHOOKS_PATH is not configured"})
+		return nil, false
+	}
+	return s.projectClient(c)
+}
+
+type WebhookRequest struct {
+	URL string `json:"url"`
+	// Events default to every event type.
+	Events []string `json:"events"`
+	// LogTypes are Procore names or route names, e.g. "accident_logs" or
+	// "accident-logs"; they default to every log type.
+	LogTypes []string `json:"log_types"`
+	Where    string   `json:"where"`
+	// Secret is generated when it is not given.
+	Secret string `json:"secret"`
+}
+
+// ListWebhooks returns the subscriptions of the project, without their
+// secrets.
+func (s *Service) ListWebhooks(c *gin.Context) {
+	client, ok := s.webhooksClient(c)
+	if !ok {
+		return
+	}
+	subs, err := s.Webhooks.Subscriptions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	results := make([]webhook.Subscription, 0, len(subs))
+	for _, sub := range subs {
+		if sub.CompanyID == client.CompanyID && sub.ProjectID == client.ProjectID {
+			sub.Secret = ""
+			results = append(results, sub)
+		}
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// CreateWebhook subscribes a URL to the project's log events. The response
+// is the only one to include the secret.
+func (s *Service) CreateWebhook(c *gin.Context) {
+	client, ok := s.webhooksClient(c)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook", "fields": bindingErrors(err)})
+		return
+	}
+
+	var errs ValidationErrors
+	if err := webhook.CheckURL(c.Request.Context(), req.URL, s.Config.WebhooksAllowPrivate); err != nil {
+		errs.add("url", "%s", err.Error())
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(eventTypes, event) {
+			errs.add("events", "must be some of %s", strings.Join(eventTypes, ", "))
+			break
+		}
+	}
+	logTypes := make([]string, 0, len(req.LogTypes))
+	for _, name := range req.LogTypes {
+		r := s.resourceByName(name)
+		if r == nil {
+			errs.add("log_types", "unknown log type %q", name)
+			continue
+		}
+		logTypes = append(logTypes, r.Name)
+	}
+	if req.Where != "" {
+		if _, err := subscriptionQuery(req.Where); err != nil {
+			errs.add("where", "%s", err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook", "fields": errs})
+		return
+	}
+	if req.Events == nil {
+		req.Events = []string{}
+	}
+
+	id, err := procore.RandomString(12)
+	if err == nil && req.Secret == "" {
+		req.Secret, err = procore.RandomString(32)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sub := webhook.Subscription{
+		ID:        id,
+		CompanyID: client.CompanyID,
+		ProjectID: client.ProjectID,
+		URL:       req.URL,
+		Secret:    req.Secret,
+		Events:    req.Events,
+		LogTypes:  logTypes,
+		Where:     req.Where,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.Webhooks.AddSubscription(sub); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, sub)
+}
+
+// resourceByName finds a registered log type by its Procore name or the
+// last segment of its route.
+func (s *Service) resourceByName(name string) *Resource {
+	for _, r := range s.registered() {
+		if r.Name == name || strings.TrimPrefix(r.Path, "/api/") == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// DeleteWebhook unsubscribes. Deliveries already queued fail.
+func (s *Service) DeleteWebhook(c *gin.Context) {
+	client, ok := s.webhooksClient(c)
+	if !ok {
+		return
+	}
+	sub, err := s.Webhooks.Subscription(c.Param("id"))
+	if errors.Is(err, webhook.ErrNotFound) || (err == nil && (sub.CompanyID != client.CompanyID || sub.ProjectID != client.ProjectID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	if err == nil {
+		err = s.Webhooks.DeleteSubscription(sub.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries returns the delivery log of the project's subscriptions,
+// newest first. subscription_id and status (e.g. failed,pending) narrow
+// it; limit caps it at 100 by default.
+func (s *Service) ListDeliveries(c *gin.Context) {
+	client, ok := s.webhooksClient(c)
+	if !ok {
+		return
+	}
+	limit := 100
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		limit = n
+	}
+	owned, err := s.projectSubscriptions(client)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscriptionID := c.Query("subscription_id")
+	statuses := splitIDs(c.Query("status"))
+	deliveries, err := s.Webhooks.Deliveries(func(d webhook.Delivery) bool {
+		return owned[d.SubscriptionID] &&
+			(subscriptionID == "" || d.SubscriptionID == subscriptionID) &&
+			(len(statuses) == 0 || slices.Contains(statuses, d.Status))
+	}, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// projectSubscriptions returns the IDs of the client project's
+// subscriptions.
+func (s *Service) projectSubscriptions(client *procore.Client) (map[string]bool, error) {
+	subs, err := s.Webhooks.Subscriptions()
+	if err != nil {
+		return nil, err
+	}
+	owned := map[string]bool{}
+	for _, sub := range subs {
+		if sub.CompanyID == client.CompanyID && sub.ProjectID == client.ProjectID {
+			owned[sub.ID] = true
+		}
+	}
+	return owned, nil
+}
+
+// RetryDelivery sends a delivery again now, whatever its status.
+func (s *Service) RetryDelivery(c *gin.Context) {
+	client, ok := s.webhooksClient(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+	owned, err := s.projectSubscriptions(client)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	d, err := s.Webhooks.Delivery(id)
+	if errors.Is(err, webhook.ErrNotFound) || (err == nil && !owned[d.SubscriptionID]) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	d.Status, d.Attempts, d.NextAttemptAt, d.Error = webhook.StatusPending, 0, time.Now(), ""
+	if err := s.Webhooks.UpdateDelivery(d); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.wakeWebhooks()
+	c.JSON(http.StatusOK, d)
+}
@@ -0,0 +1,175 @@
+package logs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"procore-common/mirror"
+	"procore-common/webhook"
+)
+
+func TestPublishedSet(t *testing.T) {
+	var p publishedSet
+	if !p.first("a") || p.first("a") {
+		t.Fatal("a change was not recorded once")
+	}
+	p.first("b")
+
+	// a is forgotten once it is older than publishedMemory; b is not.
+	p.order[0].at = time.Now().Add(-publishedMemory - time.Minute)
+	if !p.first("c") {
+		t.Fatal("c was seen before")
+	}
+	if !p.first("a") || p.first("b") {
+		t.Error("a was remembered past publishedMemory, or b was forgotten")
+	}
+	if len(p.order) != 3 || len(p.seen) != 3 {
+		t.Errorf("%d ordered and %d seen, want b, c and a", len(p.order), len(p.seen))
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	event := webhook.Event{
+		Type:      mirror.Created,
+		LogType:   CallLogs.Name,
+		CompanyID: "1",
+		ProjectID: "2",
+		Record:    map[string]interface{}{"severity": "high", "tags": map[string]interface{}{"BodyPart": "hand"}},
+	}
+	tests := []struct {
+		name string
+		sub  webhook.Subscription
+		want bool
+	}{
+		{"everything", webhook.Subscription{CompanyID: "1", ProjectID: "2"}, true},
+		{"another project", webhook.Subscription{CompanyID: "1", ProjectID: "3"}, false},
+		{"the event", webhook.Subscription{CompanyID: "1", ProjectID: "2", Events: []string{mirror.Created}}, true},
+		{"other events", webhook.Subscription{CompanyID: "1", ProjectID: "2", Events: []string{mirror.Deleted}}, false},
+		{"the log type", webhook.Subscription{CompanyID: "1", ProjectID: "2", LogTypes: []string{CallLogs.Name}}, true},
+		{"other log types", webhook.Subscription{CompanyID: "1", ProjectID: "2", LogTypes: []string{AccidentLogs.Name}}, false},
+		{"matching where", webhook.Subscription{CompanyID: "1", ProjectID: "2", Where: "severity=high and tag.BodyPart=hand"}, true},
+		{"other where", webhook.Subscription{CompanyID: "1", ProjectID: "2", Where: "severity=low"}, false},
+	}
+	for _, tt := range tests {
+		if got := subscribed(tt.sub, event); got != tt.want {
+			t.Errorf("%s: subscribed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// subscriber records the events posted to it. Posts to /fail are
+// answered with a 500.
+type subscriber struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (sub *subscriber) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/fail" {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var event webhook.Event
+	json.NewDecoder(req.Body).Decode(&event)
+	sub.mu.Lock()
+	sub.events = append(sub.events, event.LogID+" "+event.Type)
+	sub.mu.Unlock()
+}
+
+func newWebhookService(t *testing.T) *Service {
+	t.Helper()
+	store, err := webhook.Open(filepath.Join(t.TempDir(), "webhooks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return &Service{
+		Webhooks:      store,
+		webhooksWake:  make(chan struct{}, 1),
+		webhookClient: webhook.NewHTTPClient(time.Second, true),
+	}
+}
+
+// deliverAll runs deliverDue and waits for its goroutines.
+func deliverAll(t *testing.T, s *Service) {
+	t.Helper()
+	s.deliverDue()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.delivering.mu.Lock()
+		busy := len(s.delivering.busy)
+		s.delivering.mu.Unlock()
+		if busy == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("deliveries did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeliverDue(t *testing.T) {
+	received := &subscriber{}
+	server := httptest.NewServer(received)
+	defer server.Close()
+	s := newWebhookService(t)
+	for _, sub := range []webhook.Subscription{
+		{ID: "ok", CompanyID: "1", ProjectID: "2", URL: server.URL, Secret: "shh"},
+		{ID: "failing", CompanyID: "1", ProjectID: "2", URL: server.URL + "/fail", Secret: "shh"},
+	} {
+		if err := s.Webhooks.AddSubscription(sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	publish := func(id float64, kind, version string) {
+		s.publish(CallLogs, "1", "2", kind, SourceGateway, map[string]interface{}{"id": id, "updated_at": version})
+	}
+	publish(1, mirror.Created, "v1")
+	publish(1, mirror.Created, "v1")
+	publish(1, mirror.Updated, "v2")
+	publish(2, mirror.Deleted, "")
+
+	deliverAll(t, s)
+	if want := []string{"1 created", "1 updated", "2 deleted"}; !reflect.DeepEqual(received.events, want) {
+		t.Errorf("delivered %v, want %v", received.events, want)
+	}
+
+	failed, err := s.Webhooks.Deliveries(func(d webhook.Delivery) bool { return d.SubscriptionID == "failing" }, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range failed {
+		if d.Status != webhook.StatusPending || d.Attempts != 1 || d.ResponseStatus != http.StatusInternalServerError || !d.NextAttemptAt.After(time.Now()) {
+			t.Errorf("failed delivery = %+v, want pending with a backoff", d)
+		}
+	}
+	if due, _ := s.Webhooks.Due(time.Now()); len(due) != 0 {
+		t.Errorf("%d deliveries still due, want none during the backoff", len(due))
+	}
+
+	// Nothing is due, so nothing is sent again.
+	deliverAll(t, s)
+	if len(received.events) != 3 {
+		t.Errorf("delivered %v again", received.events)
+	}
+}
+
+func TestDeliverDeletedSubscription(t *testing.T) {
+	s := newWebhookService(t)
+	d, err := s.Webhooks.AddDelivery(webhook.Delivery{SubscriptionID: "gone", URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliverAll(t, s)
+	if got, _ := s.Webhooks.Delivery(d.ID); got.Status != webhook.StatusFailed || got.Attempts != 0 {
+		t.Errorf("delivery = %+v, want failed without an attempt", got)
+	}
+}
@@ -0,0 +1,417 @@
+// Package mirror keeps a local copy of each project's logs in an embedded
+// BoltDB file, so reads survive a slow or lost connection to Procore, and
+// a journal of the changes each sync found.
+package mirror
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	recordsBucket = []byte("records")
+	journalBucket = []byte("journal")
+	metaKey       = []byte("meta")
+)
+
+// JournalRetention is how long changes stay in the journal.
+const JournalRetention = 30 * 24 * time.Hour
+
+// Kinds of Change.
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+)
+
+// Change is one entry of the journal of a Key.
+type Change struct {
+	// Seq orders the changes of a Key; it is the cursor to resume after.
+	Seq  uint64    `json:"seq"`
+	Kind string    `json:"kind"`
+	ID   string    `json:"id"`
+	At   time.Time `json:"at"`
+	// Record is the log after the change, or as it was last seen for a
+	// deletion.
+	Record json.RawMessage `json:"record"`
+}
+
+// Key identifies the mirrored logs of one type in one project.
+type Key struct {
+	CompanyID string
+	ProjectID string
+	// Resource is the Procore log type, e.g. "call_logs".
+	Resource string
+}
+
+func (k Key) String() string {
+	return k.CompanyID + "/" + k.ProjectID + "/" + k.Resource
+}
+
+func (k Key) bucket() []byte {
+	return []byte(k.String())
+}
+
+// Meta describes the state of a mirrored log type.
+type Meta struct {
+	SyncedAt time.Time `json:"synced_at"`
+	// SweptAt is when the full list was last fetched, which is the only
+	// way deletions are seen.
+	SweptAt time.Time `json:"swept_at"`
+	// Watermark is the newest updated_at in the copy; an incremental sync
+	// asks Procore for the logs updated since.
+	Watermark string `json:"watermark,omitempty"`
+	// Stale marks a copy a write has made out of date; it is only served
+	// when Procore cannot be reached.
+	Stale bool `json:"stale,omitempty"`
+}
+
+// Store is a BoltDB file holding one bucket per Key, with the raw Procore
+// records keyed by ID and the Meta of the last sync.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the store at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mirror %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Records returns every record of key in ID order, with its Meta. ok is
+// false when key was never synced.
+func (s *Store) Records(key Key) (records []json.RawMessage, meta Meta, ok bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		if b == nil {
+			return nil
+		}
+		if err := json.Unmarshal(b.Get(metaKey), &meta); err != nil {
+			return err
+		}
+		ok = true
+		return b.Bucket(recordsBucket).ForEach(func(_, v []byte) error {
+			records = append(records, append(json.RawMessage(nil), v...))
+			return nil
+		})
+	})
+	return records, meta, ok, err
+}
+
+// Record returns one record of key by ID, with the Meta of key.
+func (s *Store) Record(key Key, id string) (record json.RawMessage, meta Meta, ok bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		if b == nil {
+			return nil
+		}
+		if err := json.Unmarshal(b.Get(metaKey), &meta); err != nil {
+			return err
+		}
+		if v := b.Bucket(recordsBucket).Get(recordKey(id)); v != nil {
+			record, ok = append(json.RawMessage(nil), v...), true
+		}
+		return nil
+	})
+	return record, meta, ok, err
+}
+
+// Meta returns the Meta of key; ok is false when key was never synced.
+func (s *Store) Meta(key Key) (meta Meta, ok bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		if b == nil {
+			return nil
+		}
+		ok = true
+		return json.Unmarshal(b.Get(metaKey), &meta)
+	})
+	return meta, ok, err
+}
+
+// Replace swaps the records of key for a full copy taken at syncedAt and
+// journals how it differs from the previous one, deletions included. The
+// first copy of a key is not journaled.
+func (s *Store) Replace(key Key, records []json.RawMessage, syncedAt time.Time) (changes []Change, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		journal := b != nil
+		if b == nil {
+			if b, err = tx.CreateBucket(key.bucket()); err != nil {
+				return err
+			}
+		}
+		old := b.Bucket(recordsBucket)
+
+		var meta Meta
+		seen := map[string]bool{}
+		for _, record := range records {
+			id, ok := recordID(record)
+			if !ok {
+				continue
+			}
+			seen[id] = true
+			meta.Watermark = maxUpdatedAt(meta.Watermark, record)
+			if journal && old != nil {
+				changes = appendChange(changes, id, old.Get(recordKey(id)), record)
+			}
+		}
+		if old != nil {
+			if journal {
+				err := old.ForEach(func(_, v []byte) error {
+					if id, _ := recordID(v); !seen[id] {
+						changes = append(changes, Change{Kind: Deleted, ID: id, Record: append(json.RawMessage(nil), v...)})
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if err := b.DeleteBucket(recordsBucket); err != nil {
+				return err
+			}
+		}
+		rb, err := b.CreateBucket(recordsBucket)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if id, ok := recordID(record); ok {
+				if err := rb.Put(recordKey(id), record); err != nil {
+					return err
+				}
+			}
+		}
+
+		meta.SyncedAt, meta.SweptAt = syncedAt, syncedAt
+		if err := putMeta(b, meta); err != nil {
+			return err
+		}
+		return putChanges(b, changes, syncedAt)
+	})
+	return changes, err
+}
+
+// Apply stores the logs an incremental sync at syncedAt found updated and
+// journals those that changed. key must have been Replaced before. A
+// Stale copy stays Stale, since only a full copy sees deletions.
+func (s *Store) Apply(key Key, records []json.RawMessage, syncedAt time.Time) (changes []Change, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		if b == nil {
+			return fmt.Errorf("mirror %s was never synced", key)
+		}
+		var meta Meta
+		if err := json.Unmarshal(b.Get(metaKey), &meta); err != nil {
+			return err
+		}
+		rb := b.Bucket(recordsBucket)
+		for _, record := range records {
+			id, ok := recordID(record)
+			if !ok {
+				continue
+			}
+			changes = appendChange(changes, id, rb.Get(recordKey(id)), record)
+			if err := rb.Put(recordKey(id), record); err != nil {
+				return err
+			}
+			meta.Watermark = maxUpdatedAt(meta.Watermark, record)
+		}
+		meta.SyncedAt = syncedAt
+		if err := putMeta(b, meta); err != nil {
+			return err
+		}
+		return putChanges(b, changes, syncedAt)
+	})
+	return changes, err
+}
+
+// Put stores one log Procore reported changed at at and journals it if it
+// changed. Unlike Apply it leaves SyncedAt and the Watermark alone, since
+// other logs may have changed since the last sync. ok is false, and
+// nothing is stored, when key was never synced.
+func (s *Store) Put(key Key, record json.RawMessage, at time.Time) (changes []Change, ok bool, err error) {
+	id, hasID := recordID(record)
+	if !hasID {
+		return nil, false, fmt.Errorf("mirror %s: record has no id", key)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		if b == nil {
+			return nil
+		}
+		ok = true
+		rb := b.Bucket(recordsBucket)
+		changes = appendChange(changes, id, rb.Get(recordKey(id)), record)
+		if err := rb.Put(recordKey(id), record); err != nil {
+			return err
+		}
+		return putChanges(b, changes, at)
+	})
+	return changes, ok, err
+}
+
+// Remove drops one log Procore reported deleted at at and journals the
+// deletion with the log as it was last seen. ok is false when key was
+// never synced.
+func (s *Store) Remove(key Key, id string, at time.Time) (changes []Change, ok bool, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		if b == nil {
+			return nil
+		}
+		ok = true
+		rb := b.Bucket(recordsBucket)
+		old := rb.Get(recordKey(id))
+		if old == nil {
+			return nil
+		}
+		changes = append(changes, Change{Kind: Deleted, ID: id, Record: append(json.RawMessage(nil), old...)})
+		if err := rb.Delete(recordKey(id)); err != nil {
+			return err
+		}
+		return putChanges(b, changes, at)
+	})
+	return changes, ok, err
+}
+
+// Changes returns the journal of key after the change with sequence
+// number after and at or after since, oldest first, with the sequence
+// number of the latest change to resume from.
+func (s *Store) Changes(key Key, after uint64, since time.Time) (changes []Change, cursor uint64, err error) {
+	changes = make([]Change, 0)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		if b == nil || b.Bucket(journalBucket) == nil {
+			return nil
+		}
+		jb := b.Bucket(journalBucket)
+		cursor = jb.Sequence()
+		c := jb.Cursor()
+		for k, v := c.Seek(binary.BigEndian.AppendUint64(nil, after+1)); k != nil; k, v = c.Next() {
+			var change Change
+			if err := json.Unmarshal(v, &change); err != nil {
+				return err
+			}
+			if !change.At.Before(since) {
+				changes = append(changes, change)
+			}
+		}
+		return nil
+	})
+	return changes, cursor, err
+}
+
+// Invalidate marks the copy of key Stale.
+func (s *Store) Invalidate(key Key) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(key.bucket())
+		if b == nil {
+			return nil
+		}
+		var meta Meta
+		if err := json.Unmarshal(b.Get(metaKey), &meta); err != nil {
+			return err
+		}
+		meta.Stale = true
+		return putMeta(b, meta)
+	})
+}
+
+// appendChange journals record unless it is the same as old.
+func appendChange(changes []Change, id string, old, record []byte) []Change {
+	kind := Updated
+	switch {
+	case old == nil:
+		kind = Created
+	case bytes.Equal(old, record):
+		return changes
+	}
+	return append(changes, Change{Kind: kind, ID: id, Record: append(json.RawMessage(nil), record...)})
+}
+
+// putChanges numbers changes and adds them to the journal of b, dropping
+// entries older than JournalRetention.
+func putChanges(b *bolt.Bucket, changes []Change, at time.Time) error {
+	jb, err := b.CreateBucketIfNotExists(journalBucket)
+	if err != nil {
+		return err
+	}
+	for i := range changes {
+		seq, err := jb.NextSequence()
+		if err != nil {
+			return err
+		}
+		changes[i].Seq, changes[i].At = seq, at
+		data, err := json.Marshal(changes[i])
+		if err != nil {
+			return err
+		}
+		if err := jb.Put(binary.BigEndian.AppendUint64(nil, seq), data); err != nil {
+			return err
+		}
+	}
+
+	c := jb.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.First() {
+		var change Change
+		if err := json.Unmarshal(v, &change); err != nil || time.Since(change.At) <= JournalRetention {
+			return err
+		}
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recordID(record []byte) (string, bool) {
+	var head struct {
+		ID json.Number `json:"id"`
+	}
+	if err := json.Unmarshal(record, &head); err != nil || head.ID == "" {
+		return "", false
+	}
+	return head.ID.String(), true
+}
+
+func maxUpdatedAt(watermark string, record []byte) string {
+	var head struct {
+		UpdatedAt string `json:"updated_at"`
+	}
+	json.Unmarshal(record, &head)
+	if head.UpdatedAt > watermark {
+		return head.UpdatedAt
+	}
+	return watermark
+}
+
+func putMeta(b *bolt.Bucket, meta Meta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return b.Put(metaKey, data)
+}
+
+// recordKey orders numeric IDs numerically by storing them big-endian.
+func recordKey(id string) []byte {
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return binary.BigEndian.AppendUint64(nil, n)
+	}
+	return []byte(id)
+}
@@ -0,0 +1,180 @@
+package mirror
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testKey = Key{CompanyID: "1", ProjectID: "2", Resource: "call_logs"}
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "mirror.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func raw(records ...string) []json.RawMessage {
+	out := make([]json.RawMessage, len(records))
+	for i, record := range records {
+		out[i] = json.RawMessage(record)
+	}
+	return out
+}
+
+// kinds summarizes changes as "kind id" strings.
+func kinds(changes []Change) []string {
+	out := make([]string, len(changes))
+	for i, change := range changes {
+		out[i] = change.Kind + " " + change.ID
+	}
+	return out
+}
+
+func TestReplace(t *testing.T) {
+	s := openStore(t)
+	first := time.Now()
+
+	changes, err := s.Replace(testKey, raw(
+		`{"id":1,"updated_at":"2024-01-01"}`,
+		`{"id":2,"updated_at":"2024-01-02"}`,
+		`{"id":3,"updated_at":"2024-01-01"}`,
+	), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("first copy journaled %v", kinds(changes))
+	}
+
+	second := first.Add(time.Minute)
+	changes, err = s.Replace(testKey, raw(
+		`{"id":1,"updated_at":"2024-01-01"}`,
+		`{"id":2,"updated_at":"2024-01-05"}`,
+		`{"id":4,"updated_at":"2024-01-03"}`,
+	), second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := kinds(changes), []string{"updated 2", "created 4", "deleted 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+	if got := string(changes[2].Record); got != `{"id":3,"updated_at":"2024-01-01"}` {
+		t.Errorf("deletion carries %s, want the record as last seen", got)
+	}
+
+	records, meta, ok, err := s.Records(testKey)
+	if err != nil || !ok {
+		t.Fatalf("Records: ok=%v err=%v", ok, err)
+	}
+	if len(records) != 3 {
+		t.Errorf("%d records, want 3", len(records))
+	}
+	if meta.Watermark != "2024-01-05" || !meta.SyncedAt.Equal(second) || !meta.SweptAt.Equal(second) {
+		t.Errorf("meta = %+v", meta)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	s := openStore(t)
+	start := time.Now()
+	s.Replace(testKey, raw(`{"id":1}`), start)
+	s.Replace(testKey, raw(`{"id":1,"x":1}`, `{"id":2}`), start.Add(time.Minute))
+	s.Replace(testKey, raw(`{"id":2}`), start.Add(2*time.Minute))
+
+	changes, cursor, err := s.Changes(testKey, 0, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := kinds(changes), []string{"updated 1", "created 2", "deleted 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+	if cursor != 3 {
+		t.Errorf("cursor = %d, want 3", cursor)
+	}
+
+	changes, _, _ = s.Changes(testKey, 2, time.Time{})
+	if got, want := kinds(changes), []string{"deleted 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after 2: %v, want %v", got, want)
+	}
+	changes, _, _ = s.Changes(testKey, 0, start.Add(2*time.Minute))
+	if got, want := kinds(changes), []string{"deleted 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("since the last sync: %v, want %v", got, want)
+	}
+
+	changes, cursor, err = s.Changes(Key{Resource: "unknown"}, 0, time.Time{})
+	if err != nil || len(changes) != 0 || cursor != 0 {
+		t.Errorf("unknown key: %v %d %v", changes, cursor, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	s := openStore(t)
+	start := time.Now()
+	if _, err := s.Apply(testKey, raw(`{"id":1}`), start); err == nil {
+		t.Error("Apply to a key never synced succeeded")
+	}
+
+	s.Replace(testKey, raw(`{"id":1,"updated_at":"2024-01-01"}`, `{"id":2,"updated_at":"2024-01-01"}`), start)
+	s.Invalidate(testKey)
+	changes, err := s.Apply(testKey, raw(
+		`{"id":1,"updated_at":"2024-01-01"}`,
+		`{"id":3,"updated_at":"2024-02-01"}`,
+	), start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := kinds(changes), []string{"created 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+
+	meta, _, _ := s.Meta(testKey)
+	if meta.Watermark != "2024-02-01" || !meta.SweptAt.Equal(start) || !meta.Stale {
+		t.Errorf("meta = %+v", meta)
+	}
+	if _, _, ok, _ := s.Record(testKey, "2"); !ok {
+		t.Error("Apply dropped a log it was not given")
+	}
+}
+
+func TestPutRemove(t *testing.T) {
+	s := openStore(t)
+	start := time.Now()
+	if _, ok, err := s.Put(testKey, json.RawMessage(`{"id":1}`), start); ok || err != nil {
+		t.Errorf("Put to a key never synced: ok=%v err=%v", ok, err)
+	}
+
+	s.Replace(testKey, raw(`{"id":1,"updated_at":"2024-01-01"}`), start)
+	at := start.Add(time.Minute)
+	changes, ok, err := s.Put(testKey, json.RawMessage(`{"id":1,"updated_at":"2024-03-01"}`), at)
+	if err != nil || !ok {
+		t.Fatalf("Put: ok=%v err=%v", ok, err)
+	}
+	if got, want := kinds(changes), []string{"updated 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Put changes = %v, want %v", got, want)
+	}
+	meta, _, _ := s.Meta(testKey)
+	if meta.Watermark != "2024-01-01" || !meta.SyncedAt.Equal(start) {
+		t.Errorf("Put moved the sync state: %+v", meta)
+	}
+
+	changes, ok, err = s.Remove(testKey, "1", at)
+	if err != nil || !ok {
+		t.Fatalf("Remove: ok=%v err=%v", ok, err)
+	}
+	if got, want := kinds(changes), []string{"deleted 1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Remove changes = %v, want %v", got, want)
+	}
+	if changes, _, _ = s.Remove(testKey, "1", at); len(changes) != 0 {
+		t.Errorf("removing a missing log journaled %v", kinds(changes))
+	}
+	if _, _, found, _ := s.Record(testKey, "1"); found {
+		t.Error("removed log is still stored")
+	}
+}
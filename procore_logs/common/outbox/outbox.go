@@ -0,0 +1,387 @@
+// Package outbox keeps log writes that could not reach Procore in an
+// embedded BoltDB file until they can be replayed.
+package outbox
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	itemsBucket       = []byte("items")
+	keysBucket        = []byte("keys")
+	credentialsBucket = []byte("credentials")
+)
+
+// Statuses of an Item.
+const (
+	// StatusPending items are waiting to be replayed.
+	StatusPending = "pending"
+	// StatusSent items were applied in Procore.
+	StatusSent = "sent"
+	// StatusFailed items were rejected by Procore or ran out of attempts.
+	StatusFailed = "failed"
+	// StatusConflicted items target a log that changed in Procore after the
+	// write was queued; they wait for a forced retry or a discard.
+	StatusConflicted = "conflicted"
+)
+
+// Operations of an Item.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// ErrNotFound is returned for an unknown item ID.
+var ErrNotFound = errors.New("outbox item not found")
+
+// ErrKeyReused is returned by Add when the caller already queued a
+// different write under the same IdempotencyKey.
+var ErrKeyReused = errors.New("idempotency key already used for a different write")
+
+// Item is one queued write.
+type Item struct {
+	ID uint64 `json:"id"`
+	// IdempotencyKey is sent to Procore with every attempt, so a write
+	// that reached it before the connection dropped is not applied twice.
+	IdempotencyKey string `json:"idempotency_key"`
+	CompanyID      string `json:"company_id"`
+	ProjectID      string `json:"project_id"`
+	// Resource is the Procore log type, e.g. "call_logs".
+	Resource string `json:"resource"`
+	Op       string `json:"op"`
+	LogID    string `json:"log_id,omitempty"`
+	// Body is the log of a create or the patch of an update, as JSON.
+	Body json.RawMessage `json:"body,omitempty"`
+	// BaseUpdatedAt is the updated_at of the log the update or delete was
+	// made against. A log updated since is a conflict, and so is an
+	// unknown base, until the write is forced.
+	BaseUpdatedAt string `json:"base_updated_at,omitempty"`
+	// Force replays a conflicted write over the changes made in Procore.
+	Force bool `json:"force,omitempty"`
+
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	Error         string    `json:"error,omitempty"`
+	// Result is Procore's response to the write once it is sent, or the
+	// current log when it conflicted.
+	Result    json.RawMessage `json:"result,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Credentials replay an item as the caller who queued it. They are kept
+// apart from the items so listing the outbox cannot leak them, only until
+// the item is settled, and never in the clear: with a key they are sealed
+// with it, and without one they are only held in memory.
+type Credentials struct {
+	SessionID string `json:"session_id,omitempty"`
+	// Token is a forwarded Authorization header.
+	Token string `json:"token,omitempty"`
+}
+
+// record is an Item as stored, with the key it was added under so Delete
+// can drop it without a scan.
+type record struct {
+	Item
+	DedupeKey string `json:"dedupe_key,omitempty"`
+}
+
+// Store is a BoltDB file holding the items in ID order.
+type Store struct {
+	db *bolt.DB
+	// aead seals the credentials written to db; nil keeps them in
+	// credentials instead.
+	aead cipher.AEAD
+
+	mu          sync.Mutex
+	credentials map[uint64]Credentials
+}
+
+// Open opens or creates the store at path. key, when set, seals the
+// credentials of the items in the file; without it they are held in
+// memory, and a restart loses them, so those items fail until they are
+// retried.
+func Open(path, key string) (*Store, error) {
+	var aead cipher.AEAD
+	if key != "" {
+		sum := sha256.Sum256([]byte(key))
+		block, err := aes.NewCipher(sum[:])
+		if err != nil {
+			return nil, err
+		}
+		if aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{itemsBucket, keysBucket, credentialsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open outbox %s: %w", path, err)
+	}
+	return &Store{db: db, aead: aead, credentials: map[uint64]Credentials{}}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add queues item as pending, with a new ID. When the same write was
+// already queued under the same IdempotencyKey, in the same project, log
+// type and by the same caller (see dedupeKey), that item is returned
+// instead, with added false. A different write under that key is
+// ErrKeyReused.
+func (s *Store) Add(item Item, creds Credentials) (stored Item, added bool, err error) {
+	key := dedupeKey(item, creds)
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(keysBucket)
+		if id := keys.Get(key); id != nil {
+			err := getItem(tx, binary.BigEndian.Uint64(id), &stored)
+			switch {
+			case err == nil && (stored.LogID != item.LogID || !bytes.Equal(stored.Body, item.Body)):
+				return ErrKeyReused
+			case err == nil:
+				return nil
+			case !errors.Is(err, ErrNotFound):
+				return err
+			}
+			// The item was deleted by a store that did not record its key.
+		}
+
+		items := tx.Bucket(itemsBucket)
+		id, err := items.NextSequence()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		item.ID = id
+		item.Status = StatusPending
+		item.NextAttemptAt = now
+		item.CreatedAt = now
+		item.UpdatedAt = now
+		if err := putRecord(tx, record{Item: item, DedupeKey: string(key)}); err != nil {
+			return err
+		}
+		if err := keys.Put(key, itemKey(id)); err != nil {
+			return err
+		}
+		stored, added = item, true
+		return s.putCredentials(tx, id, creds)
+	})
+	return stored, added, err
+}
+
+// Get returns one item.
+func (s *Store) Get(id uint64) (item Item, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return getItem(tx, id, &item)
+	})
+	return item, err
+}
+
+// List returns the items match accepts, in ID order.
+func (s *Store) List(match func(Item) bool) ([]Item, error) {
+	items := make([]Item, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).ForEach(func(_, v []byte) error {
+			var item Item
+			if err := json.Unmarshal(v, &item); err != nil {
+				return err
+			}
+			if match == nil || match(item) {
+				items = append(items, item)
+			}
+			return nil
+		})
+	})
+	return items, err
+}
+
+// Pending returns the items waiting to be replayed, in the order they were
+// queued.
+func (s *Store) Pending() ([]Item, error) {
+	return s.List(func(item Item) bool {
+		return item.Status == StatusPending
+	})
+}
+
+// Update stores a changed item. The credentials of an item that is no
+// longer pending are dropped.
+func (s *Store) Update(item Item) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var current record
+		if err := getRecord(tx, item.ID, &current); err != nil {
+			return err
+		}
+		item.UpdatedAt = time.Now()
+		if err := putRecord(tx, record{Item: item, DedupeKey: current.DedupeKey}); err != nil {
+			return err
+		}
+		if item.Status == StatusPending {
+			return nil
+		}
+		return s.deleteCredentials(tx, item.ID)
+	})
+}
+
+// Credentials returns what item id is replayed with: none once it is
+// settled, or when a restart lost them.
+func (s *Store) Credentials(id uint64) (creds Credentials, err error) {
+	if s.aead == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.credentials[id], nil
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		sealed := tx.Bucket(credentialsBucket).Get(itemKey(id))
+		if sealed == nil {
+			return nil
+		}
+		size := s.aead.NonceSize()
+		if len(sealed) < size {
+			return fmt.Errorf("credentials of outbox item %d are corrupt", id)
+		}
+		data, err := s.aead.Open(nil, sealed[:size], sealed[size:], itemKey(id))
+		if err != nil {
+			return fmt.Errorf("failed to unseal the credentials of outbox item %d: %w", id, err)
+		}
+		return json.Unmarshal(data, &creds)
+	})
+	return creds, err
+}
+
+// SetCredentials replaces what item id is replayed with.
+func (s *Store) SetCredentials(id uint64, creds Credentials) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.putCredentials(tx, id, creds)
+	})
+}
+
+// Delete discards an item. Its IdempotencyKey may be queued again.
+func (s *Store) Delete(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var current record
+		if err := getRecord(tx, id, &current); err != nil {
+			return err
+		}
+		if current.DedupeKey != "" {
+			if err := tx.Bucket(keysBucket).Delete([]byte(current.DedupeKey)); err != nil {
+				return err
+			}
+		}
+		if err := s.deleteCredentials(tx, id); err != nil {
+			return err
+		}
+		return tx.Bucket(itemsBucket).Delete(itemKey(id))
+	})
+}
+
+func getItem(tx *bolt.Tx, id uint64, item *Item) error {
+	var stored record
+	if err := getRecord(tx, id, &stored); err != nil {
+		return err
+	}
+	*item = stored.Item
+	return nil
+}
+
+func getRecord(tx *bolt.Tx, id uint64, r *record) error {
+	data := tx.Bucket(itemsBucket).Get(itemKey(id))
+	if data == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, r)
+}
+
+func putRecord(tx *bolt.Tx, r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(itemsBucket).Put(itemKey(r.ID), data)
+}
+
+// putCredentials seals creds into tx, bound to item id, or holds them in
+// memory when the store has no key.
+func (s *Store) putCredentials(tx *bolt.Tx, id uint64, creds Credentials) error {
+	if s.aead == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.credentials[id] = creds
+		return nil
+	}
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	return tx.Bucket(credentialsBucket).Put(itemKey(id), s.aead.Seal(nonce, nonce, data, itemKey(id)))
+}
+
+func (s *Store) deleteCredentials(tx *bolt.Tx, id uint64) error {
+	s.mu.Lock()
+	delete(s.credentials, id)
+	s.mu.Unlock()
+	return tx.Bucket(credentialsBucket).Delete(itemKey(id))
+}
+
+// dedupeKey scopes an IdempotencyKey to the project, log type and
+// operation of item, and to the caller: its session when it has one, or
+// else the token it forwarded, so keys chosen by different callers cannot
+// collide. A caller that refreshes a forwarded token is a new caller to
+// the outbox; one that needs retries to survive a refresh should sign in
+// for a session.
+func dedupeKey(item Item, creds Credentials) []byte {
+	caller := ""
+	switch {
+	case creds.SessionID != "":
+		caller = callerHash("session", creds.SessionID)
+	case creds.Token != "":
+		caller = callerHash("token", creds.Token)
+	}
+	return []byte(strings.Join([]string{
+		item.CompanyID, item.ProjectID, item.Resource, item.Op,
+		caller, item.IdempotencyKey,
+	}, "/"))
+}
+
+// callerHash keeps a caller's credential out of the keys it is part of.
+func callerHash(kind, credential string) string {
+	sum := sha256.Sum256([]byte(kind + "\x00" + credential))
+	return hex.EncodeToString(sum[:])
+}
+
+// itemKey orders items by ID by storing it big-endian.
+func itemKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
@@ -0,0 +1,176 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddIdempotencyKey(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "outbox.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	item := Item{
+		IdempotencyKey: "key",
+		CompanyID:      "1",
+		ProjectID:      "2",
+		Resource:       "call_logs",
+		Op:             OpUpdate,
+		LogID:          "7",
+		Body:           json.RawMessage(`{"comments":"a"}`),
+	}
+	alice := Credentials{Token: "alice"}
+	first, added, err := s.Add(item, alice)
+	if err != nil || !added {
+		t.Fatalf("Add: added=%v err=%v", added, err)
+	}
+
+	again, added, err := s.Add(item, alice)
+	if err != nil || added || again.ID != first.ID {
+		t.Errorf("same write again: id=%d added=%v err=%v, want id %d", again.ID, added, err, first.ID)
+	}
+
+	changed := item
+	changed.Body = json.RawMessage(`{"comments":"b"}`)
+	if _, _, err := s.Add(changed, alice); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("different write under the key: err=%v, want ErrKeyReused", err)
+	}
+
+	bob, added, err := s.Add(changed, Credentials{Token: "bob"})
+	if err != nil || !added || bob.ID == first.ID {
+		t.Errorf("another token under the key: id=%d added=%v err=%v, want a new item", bob.ID, added, err)
+	}
+	if again, added, err := s.Add(changed, Credentials{Token: "bob"}); err != nil || added || again.ID != bob.ID {
+		t.Errorf("same token again: id=%d added=%v err=%v, want id %d", again.ID, added, err, bob.ID)
+	}
+
+	session, added, err := s.Add(item, Credentials{SessionID: "s1"})
+	if err != nil || !added || session.ID == first.ID {
+		t.Errorf("a session: id=%d added=%v err=%v, want a new item", session.ID, added, err)
+	}
+	if token, added, err := s.Add(item, Credentials{Token: "s1"}); err != nil || !added || token.ID == session.ID {
+		t.Errorf("a token equal to the session ID: id=%d added=%v err=%v, want a new item", token.ID, added, err)
+	}
+	if again, added, err := s.Add(item, Credentials{SessionID: "s1"}); err != nil || added || again.ID != session.ID {
+		t.Errorf("same session again: id=%d added=%v err=%v, want id %d", again.ID, added, err, session.ID)
+	}
+	if other, added, err := s.Add(item, Credentials{SessionID: "s2"}); err != nil || !added || other.ID == session.ID {
+		t.Errorf("another session: id=%d added=%v err=%v, want a new item", other.ID, added, err)
+	}
+
+	elsewhere := item
+	elsewhere.ProjectID = "3"
+	if _, added, err := s.Add(elsewhere, alice); err != nil || !added {
+		t.Errorf("another project: added=%v err=%v, want a new item", added, err)
+	}
+
+	if err := s.Delete(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, added, err := s.Add(item, alice); err != nil || !added {
+		t.Errorf("after Delete: added=%v err=%v, want a new item", added, err)
+	}
+	if err := s.Delete(session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, added, err := s.Add(item, Credentials{SessionID: "s1"}); err != nil || !added {
+		t.Errorf("after Delete in a session: added=%v err=%v, want a new item", added, err)
+	}
+}
+
+func TestUpdateKeepsKey(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "outbox.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	item, _, err := s.Add(Item{IdempotencyKey: "key", CompanyID: "1", ProjectID: "2", Resource: "call_logs", Op: OpDelete, LogID: "7"}, Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.Status = StatusFailed
+	if err := s.Update(item); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(item.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, added, err := s.Add(item, Credentials{}); err != nil || !added {
+		t.Errorf("after Update and Delete: added=%v err=%v, want a new item", added, err)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	const token = "Bearer live-access-token"
+	item := Item{IdempotencyKey: "key", CompanyID: "1", ProjectID: "2", Resource: "call_logs", Op: OpDelete, LogID: "7"}
+
+	for _, key := range []string{"", "secret"} {
+		path := filepath.Join(t.TempDir(), "outbox.db")
+		s, err := Open(path, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued, _, err := s.Add(item, Credentials{Token: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds, err := s.Credentials(queued.ID); err != nil || creds.Token != token {
+			t.Errorf("key %q: credentials = %+v, %v; want the token", key, creds, err)
+		}
+		s.Close()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("live-access-token")) {
+			t.Errorf("key %q: the token is in the file in the clear", key)
+		}
+
+		s, err = Open(path, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds, err := s.Credentials(queued.ID)
+		if kept := creds.Token == token; err != nil || kept != (key != "") {
+			t.Errorf("key %q: credentials after a restart = %+v, %v", key, creds, err)
+		}
+		queued.Status = StatusSent
+		if err := s.Update(queued); err != nil {
+			t.Fatal(err)
+		}
+		if creds, err := s.Credentials(queued.ID); err != nil || creds != (Credentials{}) {
+			t.Errorf("key %q: credentials once sent = %+v, %v; want none", key, creds, err)
+		}
+		s.Close()
+	}
+}
+
+func TestCredentialsWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	s, err := Open(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, _, err := s.Add(Item{CompanyID: "1", ProjectID: "2", Resource: "call_logs", Op: OpDelete, LogID: "7"}, Credentials{SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = Open(path, "rotated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Credentials(queued.ID); err == nil {
+		t.Error("credentials unsealed with another key")
+	}
+}
@@ -0,0 +1,131 @@
+package procore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TokenSource supplies the Authorization header value sent to Procore.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same value,
+// typically the Authorization header forwarded from the frontend.
+type StaticToken string
+
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyToken makes the writes sent with the returned context carry
+// token in Procore's Idempotency-Token header, so a write that is retried
+// with the same token is only applied once.
+func WithIdempotencyToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, token)
+}
+
+// Client talks to the Procore REST API on behalf of one company and project.
+type Client struct {
+	// BaseURL is the versioned REST root, see Environment.RestURL.
+	BaseURL    string
+	CompanyID  string
+	ProjectID  string
+	Tokens     TokenSource
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL, companyID, projectID string, tokens TokenSource) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		CompanyID:  companyID,
+		ProjectID:  projectID,
+		Tokens:     tokens,
+		HTTPClient: &http.Client{},
+	}
+}
+
+// ProjectPath returns the API path of a resource inside the client's project.
+func (c *Client) ProjectPath(parts ...string) string {
+	return "/projects/" + c.ProjectID + "/" + strings.Join(parts, "/")
+}
+
+// Do sends a request to path (relative to BaseURL). When form is non-nil it
+// is sent url-encoded as the request body. The caller must close the
+// response body.
+func (c *Client) Do(ctx context.Context, method, path string, query, form url.Values) (*http.Response, error) {
+	if form == nil {
+		return c.send(ctx, method, path, query, nil, "")
+	}
+	return c.send(ctx, method, path, query, bytes.NewBufferString(form.Encode()), "application/x-www-form-urlencoded")
+}
+
+// DoJSON is Do for the endpoints that take a JSON body, which v is encoded
+// as.
+func (c *Client) DoJSON(ctx context.Context, method, path string, query url.Values, v interface{}) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, method, path, query, bytes.NewReader(data), "application/json")
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		req.URL.RawQuery = query.Encode()
+	}
+
+	token, err := c.Tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Procore-Company-Id", c.CompanyID)
+	if token, _ := ctx.Value(idempotencyKey{}).(string); token != "" && method != http.MethodGet {
+		req.Header.Set("Idempotency-Token", token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// DecodeResponse decodes a JSON response into v as it is read and closes
+// its body; a nil v discards it. Non-2xx statuses are returned as
+// *APIError.
+func DecodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
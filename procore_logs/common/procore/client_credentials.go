@@ -0,0 +1,43 @@
+package procore
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// ClientCredentials obtains a token for the application itself
+// (grant_type=client_credentials), used by unattended callers.
+func (o OAuth) ClientCredentials(ctx context.Context) (*TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+
+	return o.requestToken(ctx, data)
+}
+
+// ServiceAccount is a TokenSource that caches the application's own
+// client-credentials token and fetches a new one shortly before it expires.
+type ServiceAccount struct {
+	OAuth OAuth
+
+	mu    sync.Mutex
+	token *Token
+}
+
+func NewServiceAccount(oauth OAuth) *ServiceAccount {
+	return &ServiceAccount{OAuth: oauth}
+}
+
+func (a *ServiceAccount) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == nil || a.token.Expired() {
+		resp, err := a.OAuth.ClientCredentials(ctx)
+		if err != nil {
+			return "", err
+		}
+		a.token = resp.Token()
+	}
+	return a.token.Header(), nil
+}
@@ -0,0 +1,50 @@
+package procore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestServiceAccount(t *testing.T) {
+	var mu sync.Mutex
+	issued := 0
+	expiresIn := 7200
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.PostFormValue("grant_type") != "client_credentials" || req.PostFormValue("client_id") != "app" || req.PostFormValue("client_secret") != "secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		issued++
+		fmt.Fprintf(w, `{"access_token":"app-%d","token_type":"Bearer","expires_in":%d}`, issued, expiresIn)
+	}))
+	defer server.Close()
+
+	account := NewServiceAccount(OAuth{Environment: Environment{LoginBaseURL: server.URL}, ClientID: "app", ClientSecret: "secret"})
+	for i := 0; i < 3; i++ {
+		header, err := account.Token(context.Background())
+		if err != nil || header != "Bearer app-1" {
+			t.Fatalf("Token = %q, %v; want the cached Bearer app-1", header, err)
+		}
+	}
+
+	// A token about to expire is replaced before Procore rejects it.
+	expiresIn = 30
+	account.token = nil
+	account.Token(context.Background())
+	header, err := account.Token(context.Background())
+	if err != nil || header != "Bearer app-3" {
+		t.Errorf("Token = %q, %v; want a new token once the cached one expires", header, err)
+	}
+
+	account.OAuth.ClientSecret = "wrong"
+	account.token = nil
+	if _, err := account.Token(context.Background()); err == nil {
+		t.Error("Token succeeded with bad client credentials")
+	}
+}
@@ -0,0 +1,86 @@
+package procore
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment identifies the Procore hosts and API version to talk to.
+type Environment struct {
+	Name string
+	// APIBaseURL is the REST host, e.g. https://sandbox.procore.com.
+	APIBaseURL string
+	// LoginBaseURL is the OAuth host, e.g. https://login-sandbox.procore.com.
+	LoginBaseURL string
+	// APIVersion is the REST version segment, e.g. "v1.0" or "v1.1".
+	APIVersion string
+}
+
+// Named environment profiles. Custom has no hosts of its own; they must come
+// from PROCORE_API_URL and PROCORE_LOGIN_URL, e.g. an httptest server.
+var (
+	Sandbox = Environment{
+		Name:         "sandbox",
+		APIBaseURL:   "https://sandbox.procore.com",
+		LoginBaseURL: "https://login-sandbox.procore.com",
+		APIVersion:   "v1.0",
+	}
+	Production = Environment{
+		Name:         "production",
+		APIBaseURL:   "https://api.procore.com",
+		LoginBaseURL: "https://login.procore.com",
+		APIVersion:   "v1.0",
+	}
+	Custom = Environment{
+		Name:       "custom",
+		APIVersion: "v1.0",
+	}
+)
+
+var profiles = map[string]Environment{
+	Sandbox.Name:    Sandbox,
+	Production.Name: Production,
+	Custom.Name:     Custom,
+}
+
+// LoadEnvironment picks the profile named by PROCORE_ENV (sandbox when
+// unset) and applies the PROCORE_API_URL, PROCORE_LOGIN_URL and
+// PROCORE_API_VERSION overrides.
+func LoadEnvironment() (Environment, error) {
+	name := strings.ToLower(os.Getenv("PROCORE_ENV"))
+	if name == "" {
+		name = Sandbox.Name
+	}
+	env, ok := profiles[name]
+	if !ok {
+		return Environment{}, fmt.Errorf("unknown PROCORE_ENV %q (want sandbox, production or custom)", name)
+	}
+
+	if apiURL := os.Getenv("PROCORE_API_URL"); apiURL != "" {
+		env.APIBaseURL = apiURL
+	}
+	if loginURL := os.Getenv("PROCORE_LOGIN_URL"); loginURL != "" {
+		env.LoginBaseURL = loginURL
+	}
+	if version := os.Getenv("PROCORE_API_VERSION"); version != "" {
+		env.APIVersion = version
+	}
+
+	if env.APIBaseURL == "" || env.LoginBaseURL == "" {
+		return Environment{}, fmt.Errorf("PROCORE_ENV=%s requires PROCORE_API_URL and PROCORE_LOGIN_URL", env.Name)
+	}
+	env.APIBaseURL = strings.TrimRight(env.APIBaseURL, "/")
+	env.LoginBaseURL = strings.TrimRight(env.LoginBaseURL, "/")
+	return env, nil
+}
+
+// RestURL is the root of the versioned REST API.
+func (e Environment) RestURL() string {
+	return e.APIBaseURL + "/rest/" + e.APIVersion
+}
+
+// TokenURL is the OAuth token endpoint.
+func (e Environment) TokenURL() string {
+	return e.LoginBaseURL + "/oauth/token"
+}
@@ -0,0 +1,82 @@
+package procore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Hook is a Procore webhook of the client's project: Procore posts the
+// events of its triggers to DestinationURL.
+type Hook struct {
+	ID             int    `json:"id,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+	APIVersion     string `json:"api_version,omitempty"`
+	DestinationURL string `json:"destination_url"`
+	// DestinationHeaders are sent with every event, which is how the
+	// receiver tells Procore's posts from anyone else's.
+	DestinationHeaders map[string]string `json:"destination_headers,omitempty"`
+}
+
+// HookTrigger subscribes a Hook to one event type of one resource, e.g.
+// "update" of "Call Logs".
+type HookTrigger struct {
+	ID           int    `json:"id,omitempty"`
+	ResourceName string `json:"resource_name"`
+	EventType    string `json:"event_type"`
+}
+
+func (c *Client) hooksQuery() url.Values {
+	query := url.Values{}
+	query.Set("project_id", c.ProjectID)
+	return query
+}
+
+// Hooks lists the hooks of the client's project.
+func (c *Client) Hooks(ctx context.Context) ([]Hook, error) {
+	resp, err := c.Do(ctx, http.MethodGet, "/webhooks/hooks", c.hooksQuery(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var hooks []Hook
+	if err := DecodeResponse(resp, &hooks); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// CreateHook creates a hook in the client's project and returns it with
+// its ID.
+func (c *Client) CreateHook(ctx context.Context, hook Hook) (Hook, error) {
+	body := map[string]interface{}{"project_id": json.Number(c.ProjectID), "hook": hook}
+	resp, err := c.DoJSON(ctx, http.MethodPost, "/webhooks/hooks", nil, body)
+	if err != nil {
+		return Hook{}, err
+	}
+	var created Hook
+	err = DecodeResponse(resp, &created)
+	return created, err
+}
+
+// CreateHookTrigger adds a trigger to a hook of the client's project.
+func (c *Client) CreateHookTrigger(ctx context.Context, hookID int, trigger HookTrigger) (HookTrigger, error) {
+	body := map[string]interface{}{"project_id": json.Number(c.ProjectID), "trigger": trigger}
+	resp, err := c.DoJSON(ctx, http.MethodPost, "/webhooks/hooks/"+strconv.Itoa(hookID)+"/triggers", nil, body)
+	if err != nil {
+		return HookTrigger{}, err
+	}
+	var created HookTrigger
+	err = DecodeResponse(resp, &created)
+	return created, err
+}
+
+// DeleteHook deletes a hook of the client's project with its triggers.
+func (c *Client) DeleteHook(ctx context.Context, hookID int) error {
+	resp, err := c.Do(ctx, http.MethodDelete, "/webhooks/hooks/"+strconv.Itoa(hookID), c.hooksQuery(), nil)
+	if err != nil {
+		return err
+	}
+	return DecodeResponse(resp, nil)
+}
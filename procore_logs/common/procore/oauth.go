@@ -0,0 +1,88 @@
+package procore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// OutOfBandRedirectURI is the redirect URI used when the user pastes the
+// authorization code into the frontend by hand.
+const OutOfBandRedirectURI = "urn:ietf:wg:oauth:2.0:oob"
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// APIError is returned when Procore answers with a non-success status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("procore returned %d: %s", e.StatusCode, e.Body)
+}
+
+// OAuth holds the application credentials used against Procore's login host.
+type OAuth struct {
+	Environment  Environment
+	ClientID     string
+	ClientSecret string
+}
+
+// ExchangeCode trades an authorization code for an access token.
+// redirectURI must match the one the code was issued for; codeVerifier is
+// empty unless the login used PKCE.
+func (o OAuth) ExchangeCode(ctx context.Context, code, redirectURI, codeVerifier string) (*TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	if codeVerifier != "" {
+		data.Set("code_verifier", codeVerifier)
+	}
+
+	return o.requestToken(ctx, data)
+}
+
+func (o OAuth) requestToken(ctx context.Context, data url.Values) (*TokenResponse, error) {
+	data.Set("client_id", o.ClientID)
+	data.Set("client_secret", o.ClientSecret)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, o.Environment.TokenURL(), bytes.NewBufferString(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token from Procore: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: response.StatusCode, Body: string(body)}
+	}
+
+	var tokenResp TokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	return &tokenResp, nil
+}
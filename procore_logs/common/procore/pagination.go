@@ -0,0 +1,98 @@
+package procore
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPerPage is the page size requested when walking a list endpoint.
+const DefaultPerPage = 100
+
+// MaxPerPage is the largest page size Procore serves.
+const MaxPerPage = 1000
+
+// maxPages stops a runaway walk if an endpoint keeps reporting more pages.
+const maxPages = 1000
+
+// Page selects a window of a list endpoint. The zero value means every
+// page.
+type Page struct {
+	Number  int
+	PerPage int
+}
+
+// ListPages fetches path and decodes it into records. It follows Procore's
+// page/per_page parameters, continuing while the Link header has a
+// rel="next" entry, the Total header says more records exist, or a full
+// page came back. It returns the records and Procore's total count, which
+// is the number of records fetched when Procore sends no Total header.
+func ListPages[T any](ctx context.Context, c *Client, path string, query url.Values, page Page) ([]T, int, error) {
+	var records []T
+	total, err := EachPage(ctx, c, path, query, page, func(batch []T) error {
+		records = append(records, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// EachPage is ListPages without collecting the records: fn is called with
+// each page as it arrives, and an error from fn stops the walk.
+func EachPage[T any](ctx context.Context, c *Client, path string, query url.Values, page Page, fn func(batch []T) error) (int, error) {
+	perPage := page.PerPage
+	if perPage <= 0 {
+		perPage = DefaultPerPage
+	}
+	number := page.Number
+	if number <= 0 {
+		number = 1
+	}
+
+	fetched := 0
+	total := -1
+	for i := 0; i < maxPages; i++ {
+		pageQuery := url.Values{}
+		for key, values := range query {
+			pageQuery[key] = values
+		}
+		pageQuery.Set("page", strconv.Itoa(number))
+		pageQuery.Set("per_page", strconv.Itoa(perPage))
+
+		resp, err := c.Do(ctx, http.MethodGet, path, pageQuery, nil)
+		if err != nil {
+			return 0, err
+		}
+		hasNext := strings.Contains(resp.Header.Get("Link"), `rel="next"`)
+		if t, err := strconv.Atoi(resp.Header.Get("Total")); err == nil {
+			total = t
+		}
+
+		var batch []T
+		if err := DecodeResponse(resp, &batch); err != nil {
+			return 0, err
+		}
+		fetched += len(batch)
+		if err := fn(batch); err != nil {
+			return 0, err
+		}
+
+		if page.Number > 0 || len(batch) == 0 {
+			break
+		}
+		more := hasNext || (total >= 0 && fetched < total) || (total < 0 && len(batch) == perPage)
+		if !more {
+			break
+		}
+		number++
+	}
+
+	if total < 0 {
+		total = fetched
+	}
+	return total, nil
+}
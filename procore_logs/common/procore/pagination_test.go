@@ -0,0 +1,132 @@
+package procore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// pagedStub serves records 1..count of /items in pages. It sends a Link
+// header with rel="next" when link is set and a Total header when total
+// is.
+type pagedStub struct {
+	count int
+	link  bool
+	total bool
+	pages []string
+}
+
+func (p *pagedStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(req.URL.Query().Get("per_page"))
+	p.pages = append(p.pages, req.URL.Query().Get("page"))
+	if req.URL.Query().Get("filter") != "kept" {
+		http.Error(w, "query not forwarded", http.StatusBadRequest)
+		return
+	}
+
+	first := (page-1)*perPage + 1
+	last := min(first+perPage-1, p.count)
+	if p.link && last < p.count {
+		w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, req.URL.Path, page+1))
+	}
+	if p.total {
+		w.Header().Set("Total", strconv.Itoa(p.count))
+	}
+	items := []item{}
+	for id := first; id <= last; id++ {
+		items = append(items, item{ID: id})
+	}
+	json.NewEncoder(w).Encode(items)
+}
+
+type item struct {
+	ID int `json:"id"`
+}
+
+func listItems(t *testing.T, stub *pagedStub, page Page) ([]item, int, error) {
+	t.Helper()
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	client := NewClient(server.URL, "1", "2", StaticToken("Bearer token"))
+	return ListPages[item](context.Background(), client, "/items", url.Values{"filter": {"kept"}}, page)
+}
+
+func TestListPages(t *testing.T) {
+	tests := []struct {
+		name  string
+		stub  pagedStub
+		page  Page
+		count int
+		total int
+		pages int
+	}{
+		{"link header", pagedStub{count: 25, link: true}, Page{PerPage: 10}, 25, 25, 3},
+		{"total header", pagedStub{count: 25, total: true}, Page{PerPage: 10}, 25, 25, 3},
+		{"total ends on a full page", pagedStub{count: 20, total: true}, Page{PerPage: 10}, 20, 20, 2},
+		{"full pages without headers", pagedStub{count: 20}, Page{PerPage: 10}, 20, 20, 3},
+		{"short page without headers", pagedStub{count: 5}, Page{PerPage: 10}, 5, 5, 1},
+		{"empty list", pagedStub{count: 0, total: true}, Page{}, 0, 0, 1},
+		{"default page size", pagedStub{count: 150, link: true}, Page{}, 150, 150, 2},
+		{"one window", pagedStub{count: 25, link: true, total: true}, Page{Number: 2, PerPage: 10}, 10, 25, 1},
+		{"last window", pagedStub{count: 25, total: true}, Page{Number: 3, PerPage: 10}, 5, 25, 1},
+	}
+	for _, tt := range tests {
+		stub := tt.stub
+		records, total, err := listItems(t, &stub, tt.page)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(records) != tt.count || total != tt.total || len(stub.pages) != tt.pages {
+			t.Errorf("%s: %d records, total %d, pages %v; want %d, %d, %d pages",
+				tt.name, len(records), total, stub.pages, tt.count, tt.total, tt.pages)
+		}
+		for i, record := range records {
+			want := i + 1
+			if tt.page.Number > 0 {
+				want += (tt.page.Number - 1) * tt.page.PerPage
+			}
+			if record.ID != want {
+				t.Errorf("%s: record %d has id %d, want %d", tt.name, i, record.ID, want)
+				break
+			}
+		}
+	}
+}
+
+func TestEachPageStops(t *testing.T) {
+	stub := &pagedStub{count: 30, total: true}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client := NewClient(server.URL, "1", "2", StaticToken("Bearer token"))
+
+	stop := errors.New("stop")
+	batches := 0
+	_, err := EachPage(context.Background(), client, "/items", url.Values{"filter": {"kept"}}, Page{PerPage: 10}, func(batch []item) error {
+		batches++
+		return stop
+	})
+	if !errors.Is(err, stop) || batches != 1 || len(stub.pages) != 1 {
+		t.Errorf("EachPage = %v after %d batches and %d pages; want fn's error after one", err, batches, len(stub.pages))
+	}
+}
+
+func TestListPagesError(t *testing.T) {
+	stub := &pagedStub{count: 5}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	client := NewClient(server.URL, "1", "2", StaticToken("Bearer token"))
+
+	_, _, err := ListPages[item](context.Background(), client, "/items", nil, Page{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("ListPages = %v, want Procore's 400", err)
+	}
+}
@@ -0,0 +1,97 @@
+package procore
+
+import "encoding/json"
+
+// LogPatch is a partial update of a Log, following JSON Merge Patch (RFC
+// 7396): fields absent from the JSON are left unchanged, null clears them,
+// and any other value, including "" and 0, is written as given.
+type LogPatch struct {
+	Comments        Field[string] `json:"comments"`
+	Date            Field[string] `json:"date"`
+	Datetime        Field[string] `json:"datetime"`
+	InvolvedCompany Field[string] `json:"involved_company"`
+	InvolvedName    Field[string] `json:"involved_name"`
+	TimeHour        Field[int]    `json:"time_hour"`
+	TimeMinute      Field[int]    `json:"time_minute"`
+	Severity        Field[string] `json:"severity"`
+	Location        Field[string] `json:"location"`
+	Type            Field[string] `json:"type"`
+}
+
+func (p *LogPatch) UnmarshalJSON(data []byte) error {
+	// Decoding into a Log first reports type errors with the field's name,
+	// which errors from Field.UnmarshalJSON lack.
+	if err := json.Unmarshal(data, &Log{}); err != nil {
+		return err
+	}
+	type plain LogPatch
+	return json.Unmarshal(data, (*plain)(p))
+}
+
+// MarshalJSON writes the fields the patch sets, so a decoded patch
+// round-trips.
+func (p LogPatch) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{}
+	set := func(name string, value interface{}, f interface{ isSet() (bool, bool) }) {
+		if ok, null := f.isSet(); ok && null {
+			fields[name] = nil
+		} else if ok {
+			fields[name] = value
+		}
+	}
+	set("comments", p.Comments.Value, p.Comments)
+	set("date", p.Date.Value, p.Date)
+	set("datetime", p.Datetime.Value, p.Datetime)
+	set("involved_company", p.InvolvedCompany.Value, p.InvolvedCompany)
+	set("involved_name", p.InvolvedName.Value, p.InvolvedName)
+	set("time_hour", p.TimeHour.Value, p.TimeHour)
+	set("time_minute", p.TimeMinute.Value, p.TimeMinute)
+	set("severity", p.Severity.Value, p.Severity)
+	set("location", p.Location.Value, p.Location)
+	set("type", p.Type.Value, p.Type)
+	return json.Marshal(fields)
+}
+
+// Field is one member of a LogPatch. A null field is Set with the zero
+// Value.
+type Field[T any] struct {
+	Value T
+	// Set reports whether the field was present in the patch.
+	Set bool
+	// Null reports whether it was present as null.
+	Null bool
+}
+
+// Value returns a field that is Set to v.
+func Value[T any](v T) Field[T] {
+	return Field[T]{Value: v, Set: true}
+}
+
+func (f Field[T]) isSet() (set, null bool) {
+	return f.Set, f.Null
+}
+
+func (f *Field[T]) UnmarshalJSON(data []byte) error {
+	var zero T
+	f.Value, f.Set, f.Null = zero, true, string(data) == "null"
+	if f.Null {
+		return nil
+	}
+	return json.Unmarshal(data, &f.Value)
+}
+
+// Patch returns a LogPatch that sets every field of log.
+func (log Log) Patch() LogPatch {
+	return LogPatch{
+		Comments:        Value(log.Comments),
+		Date:            Value(log.Date),
+		Datetime:        Value(log.Datetime),
+		InvolvedCompany: Value(log.InvolvedCompany),
+		InvolvedName:    Value(log.InvolvedName),
+		TimeHour:        Value(log.TimeHour),
+		TimeMinute:      Value(log.TimeMinute),
+		Severity:        Value(log.Severity),
+		Location:        Value(log.Location),
+		Type:            Value(log.Type),
+	}
+}
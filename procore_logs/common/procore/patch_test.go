@@ -0,0 +1,74 @@
+package procore
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestLogPatchUnmarshal(t *testing.T) {
+	var patch LogPatch
+	if err := json.Unmarshal([]byte(`{"comments":"","time_hour":null,"severity":"high","time_minute":0}`), &patch); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"set to empty", patch.Comments, Field[string]{Set: true}},
+		{"null", patch.TimeHour, Field[int]{Set: true, Null: true}},
+		{"set", patch.Severity, Value("high")},
+		{"set to zero", patch.TimeMinute, Value(0)},
+		{"absent", patch.Location, Field[string]{}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLogPatchUnmarshalTypeError(t *testing.T) {
+	var patch LogPatch
+	if err := json.Unmarshal([]byte(`{"time_hour":"noon"}`), &patch); err == nil {
+		t.Error("a string time_hour was accepted")
+	}
+}
+
+func TestLogPatchRoundTrip(t *testing.T) {
+	in := `{"comments":"","location":"Gate 2","time_hour":null}`
+	var patch LogPatch
+	if err := json.Unmarshal([]byte(in), &patch); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want map[string]interface{}
+	json.Unmarshal(out, &got)
+	json.Unmarshal([]byte(in), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip gave %s, want %s", out, in)
+	}
+}
+
+func TestUpdateForm(t *testing.T) {
+	r := LogResource{Name: "call_logs", FormPrefix: "call_log"}
+	patch := LogPatch{
+		Comments: Value(""),
+		TimeHour: Field[int]{Set: true, Null: true},
+		Severity: Value("low"),
+	}
+	want := url.Values{
+		"call_log[comments]":  {""},
+		"call_log[time_hour]": {""},
+		"call_log[severity]":  {"low"},
+	}
+	if got := r.UpdateForm(patch); !reflect.DeepEqual(got, want) {
+		t.Errorf("UpdateForm = %v, want %v", got, want)
+	}
+}
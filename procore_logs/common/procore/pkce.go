@@ -0,0 +1,41 @@
+package procore
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+)
+
+// NewPKCE returns a random PKCE code verifier and its S256 challenge
+// (RFC 7636).
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString returns n random bytes encoded as unpadded base64url.
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// AuthorizeURL is where the user is sent to grant access. state and
+// challenge come from the login attempt, see NewPKCE.
+func (o OAuth) AuthorizeURL(redirectURI, state, challenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", o.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("state", state)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	return o.Environment.LoginBaseURL + "/oauth/authorize?" + query.Encode()
+}
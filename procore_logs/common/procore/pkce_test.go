@@ -0,0 +1,53 @@
+package procore
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"testing"
+)
+
+func TestNewPKCE(t *testing.T) {
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636: 43 to 128 unreserved characters.
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Errorf("verifier has %d characters", len(verifier))
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); challenge != want {
+		t.Errorf("challenge = %s, want %s", challenge, want)
+	}
+
+	other, _, _ := NewPKCE()
+	if other == verifier {
+		t.Error("two verifiers are the same")
+	}
+}
+
+func TestAuthorizeURL(t *testing.T) {
+	oauth := OAuth{Environment: Environment{LoginBaseURL: "https://login.example"}, ClientID: "app"}
+	raw := oauth.AuthorizeURL("https://gateway/api/auth/callback", "state", "challenge")
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "login.example" || u.Path != "/oauth/authorize" {
+		t.Errorf("URL = %s", raw)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "app",
+		"redirect_uri":          "https://gateway/api/auth/callback",
+		"state":                 "state",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package procore
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListCompanies lists the companies the token can access.
+func (c *Client) ListCompanies(ctx context.Context) (*http.Response, error) {
+	return c.Do(ctx, http.MethodGet, "/companies", nil, nil)
+}
+
+// Project is the subset of a Procore project the services use.
+type Project struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Projects returns every project of the client's company that the token
+// can access, following pagination.
+func (c *Client) Projects(ctx context.Context) ([]Project, error) {
+	query := url.Values{}
+	query.Set("company_id", c.CompanyID)
+	projects, _, err := ListPages[Project](ctx, c, "/projects", query, Page{})
+	return projects, err
+}
+
+// ForProject returns a copy of the client working in another project of the
+// same company.
+func (c *Client) ForProject(projectID string) *Client {
+	clone := *c
+	clone.ProjectID = projectID
+	return &clone
+}
@@ -0,0 +1,106 @@
+package procore
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Log is the common shape of Procore daily log records (accident, call,
+// equipment, ...).
+type Log struct {
+	ID              int    `json:"id"`
+	Comments        string `json:"comments"`
+	Date            string `json:"date"`
+	Datetime        string `json:"datetime"`
+	InvolvedCompany string `json:"involved_company"`
+	InvolvedName    string `json:"involved_name"`
+	TimeHour        int    `json:"time_hour"`
+	TimeMinute      int    `json:"time_minute"`
+	Severity        string `json:"severity"`
+	Location        string `json:"location"`
+	// Type is not a Procore field. Log types that have one keep it in
+	// Comments; see logs.Resource.Typed.
+	Type string `json:"type,omitempty"`
+}
+
+// LogResource describes one Procore daily log type.
+type LogResource struct {
+	// Name is the API path segment, e.g. "call_logs".
+	Name string
+	// FormPrefix wraps form field names, e.g. "call_log" for call_log[comments].
+	FormPrefix string
+}
+
+func (r LogResource) field(name string) string {
+	return r.FormPrefix + "[" + name + "]"
+}
+
+// CreateForm encodes every field of log for a create request.
+func (r LogResource) CreateForm(log Log) url.Values {
+	form := url.Values{}
+	form.Set(r.field("comments"), log.Comments)
+	form.Set(r.field("date"), log.Date)
+	form.Set(r.field("datetime"), log.Datetime)
+	form.Set(r.field("involved_company"), log.InvolvedCompany)
+	form.Set(r.field("involved_name"), log.InvolvedName)
+	form.Set(r.field("time_hour"), strconv.Itoa(log.TimeHour))
+	form.Set(r.field("time_minute"), strconv.Itoa(log.TimeMinute))
+	if log.Severity != "" {
+		form.Set(r.field("severity"), log.Severity)
+	}
+	if log.Location != "" {
+		form.Set(r.field("location"), log.Location)
+	}
+	return form
+}
+
+// UpdateForm encodes the fields the patch sets. Cleared fields are sent
+// empty, which Procore takes as removing the value.
+func (r LogResource) UpdateForm(patch LogPatch) url.Values {
+	form := url.Values{}
+	setString := func(name string, f Field[string]) {
+		if f.Set {
+			form.Set(r.field(name), f.Value)
+		}
+	}
+	setInt := func(name string, f Field[int]) {
+		if f.Set && f.Null {
+			form.Set(r.field(name), "")
+		} else if f.Set {
+			form.Set(r.field(name), strconv.Itoa(f.Value))
+		}
+	}
+
+	setString("comments", patch.Comments)
+	setString("date", patch.Date)
+	setString("datetime", patch.Datetime)
+	setString("involved_company", patch.InvolvedCompany)
+	setString("involved_name", patch.InvolvedName)
+	setInt("time_hour", patch.TimeHour)
+	setInt("time_minute", patch.TimeMinute)
+	setString("severity", patch.Severity)
+	setString("location", patch.Location)
+	return form
+}
+
+func (r LogResource) List(ctx context.Context, c *Client, query url.Values) (*http.Response, error) {
+	return c.Do(ctx, http.MethodGet, c.ProjectPath(r.Name), query, nil)
+}
+
+func (r LogResource) Get(ctx context.Context, c *Client, id string) (*http.Response, error) {
+	return c.Do(ctx, http.MethodGet, c.ProjectPath(r.Name, id), nil, nil)
+}
+
+func (r LogResource) Create(ctx context.Context, c *Client, log Log) (*http.Response, error) {
+	return c.Do(ctx, http.MethodPost, c.ProjectPath(r.Name), nil, r.CreateForm(log))
+}
+
+func (r LogResource) Update(ctx context.Context, c *Client, id string, patch LogPatch) (*http.Response, error) {
+	return c.Do(ctx, http.MethodPut, c.ProjectPath(r.Name, id), nil, r.UpdateForm(patch))
+}
+
+func (r LogResource) Delete(ctx context.Context, c *Client, id string) (*http.Response, error) {
+	return c.Do(ctx, http.MethodDelete, c.ProjectPath(r.Name, id), nil, nil)
+}
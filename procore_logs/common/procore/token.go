@@ -0,0 +1,52 @@
+package procore
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// expiryDelta renews tokens a little before Procore would reject them.
+const expiryDelta = time.Minute
+
+// Token is an OAuth access token together with what is needed to renew it.
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+// Token converts a token endpoint response, stamping the expiry from
+// expires_in.
+func (r *TokenResponse) Token() *Token {
+	token := &Token{
+		AccessToken:  r.AccessToken,
+		TokenType:    r.TokenType,
+		RefreshToken: r.RefreshToken,
+	}
+	if r.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+	}
+	return token
+}
+
+// Expired reports whether the access token is expired or about to be.
+func (t *Token) Expired() bool {
+	return !t.Expiry.IsZero() && time.Now().Add(expiryDelta).After(t.Expiry)
+}
+
+// Header is the Authorization header value for the token.
+func (t *Token) Header() string {
+	return "Bearer " + t.AccessToken
+}
+
+// Refresh trades a refresh token for a new access token. Procore rotates
+// refresh tokens, so the returned RefreshToken replaces the old one.
+func (o OAuth) Refresh(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+
+	return o.requestToken(ctx, data)
+}
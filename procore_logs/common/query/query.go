@@ -0,0 +1,453 @@
+// Package query parses the sort, fields and comparison parameters of the
+// log filter endpoints into a typed AST and applies it to decoded records.
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Op is a comparison operator.
+type Op string
+
+const (
+	Eq       Op = "="
+	NotEq    Op = "!="
+	Greater  Op = ">"
+	GreaterE Op = ">="
+	Less     Op = "<"
+	LessE    Op = "<="
+	Contains Op = "~"
+)
+
+// Kind is the type a literal was recognised as.
+type Kind int
+
+const (
+	String Kind = iota
+	Number
+	Date
+)
+
+// Literal is the typed right-hand side of a condition.
+type Literal struct {
+	Raw  string
+	Kind Kind
+	Num  float64
+	Time time.Time
+}
+
+// Expr is a node of the filter AST.
+type Expr interface {
+	Match(record map[string]interface{}) bool
+	String() string
+}
+
+// And matches when every child matches; an empty And matches everything.
+type And []Expr
+
+func (a And) Match(record map[string]interface{}) bool {
+	for _, expr := range a {
+		if !expr.Match(record) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a And) String() string {
+	parts := make([]string, len(a))
+	for i, expr := range a {
+		parts[i] = expr.String()
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Condition compares one record field with a literal.
+type Condition struct {
+	Field string
+	Op    Op
+	Value Literal
+}
+
+func (c Condition) String() string {
+	return c.Field + string(c.Op) + c.Value.Raw
+}
+
+// Match compares the record's field. A list field matches when one of its
+// elements does, and != when none is equal.
+func (c Condition) Match(record map[string]interface{}) bool {
+	value, ok := Lookup(record, c.Field)
+	list, isList := value.([]interface{})
+	if !isList {
+		return c.matchValue(value, ok)
+	}
+	if c.Op == NotEq {
+		equal := Condition{Field: c.Field, Op: Eq, Value: c.Value}
+		for _, element := range list {
+			if equal.matchValue(element, true) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, element := range list {
+		if c.matchValue(element, true) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Condition) matchValue(value interface{}, ok bool) bool {
+	if !ok || value == nil {
+		return c.Op == NotEq
+	}
+
+	if c.Op == Contains {
+		return strings.Contains(strings.ToLower(fmt.Sprint(value)), strings.ToLower(c.Value.Raw))
+	}
+
+	cmp, ok := compareLiteral(value, c.Value)
+	if !ok {
+		return c.Op == NotEq
+	}
+	switch c.Op {
+	case Eq:
+		return cmp == 0
+	case NotEq:
+		return cmp != 0
+	case Greater:
+		return cmp > 0
+	case GreaterE:
+		return cmp >= 0
+	case Less:
+		return cmp < 0
+	case LessE:
+		return cmp <= 0
+	}
+	return false
+}
+
+// SortKey orders records by one field.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Query is the parsed form of the sort, fields and comparison parameters.
+type Query struct {
+	Where  And
+	Sort   []SortKey
+	Fields []string
+	// Paths maps a name in Fields to the path it is read from when the
+	// two differ, so a projection keeps the name that was asked for.
+	Paths map[string]string
+}
+
+// conditionPattern splits "field<op>value"; two-character operators are
+// listed first so ">=" is not read as ">" followed by "=value".
+var conditionPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.]*)\s*(!=|>=|<=|=|>|<|~)\s*(.*)$`)
+
+// andPattern separates conditions inside a where parameter, where it is
+// not inside a quoted value (see splitConditions).
+var andPattern = regexp.MustCompile(`(?i)\s+and\s+|;`)
+
+// splitConditions splits a where parameter at each andPattern outside
+// single or double quotes, so `comments="tools and gear"` stays whole.
+func splitConditions(where string) []string {
+	var conditions []string
+	start, quote, pos := 0, byte(0), 0
+	for _, m := range andPattern.FindAllStringIndex(where, -1) {
+		for ; pos < m[0]; pos++ {
+			switch c := where[pos]; {
+			case quote == 0 && (c == '"' || c == '\''):
+				quote = c
+			case c == quote:
+				quote = 0
+			}
+		}
+		if quote != 0 {
+			continue
+		}
+		conditions = append(conditions, where[start:m[0]])
+		start, pos = m[1], m[1]
+	}
+	return append(conditions, where[start:])
+}
+
+// Parse reads a request's query parameters:
+//
+//	sort=-date,severity        sort keys, "-" for descending
+//	fields=id,date,severity    keep only these fields
+//	where=time_hour>=12 and date>2024-01-01
+//	where=comments~"tools and gear"
+//
+// Comparisons may also be written directly as parameters, e.g.
+// ?time_hour>=12&date>2024-01-01, which arrive as keys containing the
+// operator. Operators are =, !=, >, >=, <, <= and ~ (contains).
+func Parse(values url.Values) (*Query, error) {
+	q := &Query{}
+
+	for _, key := range splitList(values.Get("sort")) {
+		desc := strings.HasPrefix(key, "-")
+		q.Sort = append(q.Sort, SortKey{Field: strings.TrimLeft(key, "-+"), Desc: desc})
+	}
+	q.Fields = splitList(values.Get("fields"))
+
+	var conditions []string
+	for _, where := range values["where"] {
+		conditions = append(conditions, splitConditions(where)...)
+	}
+	var inline []string
+	for key, vals := range values {
+		if !strings.ContainsAny(key, "<>!~") {
+			continue
+		}
+		for _, v := range vals {
+			// "time_hour>=12" arrives as key "time_hour>" and value "12";
+			// "date>2024-01-01" as a key with an empty value.
+			if v != "" {
+				inline = append(inline, key+"="+v)
+			} else {
+				inline = append(inline, key)
+			}
+		}
+	}
+	sort.Strings(inline)
+	conditions = append(conditions, inline...)
+
+	for _, raw := range conditions {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		condition, err := ParseCondition(raw)
+		if err != nil {
+			return nil, err
+		}
+		q.Where = append(q.Where, condition)
+	}
+	return q, nil
+}
+
+// ParseCondition parses a single "field<op>value" comparison.
+func ParseCondition(raw string) (Condition, error) {
+	m := conditionPattern.FindStringSubmatch(raw)
+	if m == nil {
+		return Condition{}, fmt.Errorf("invalid condition %q", raw)
+	}
+	return Condition{Field: m[1], Op: Op(m[2]), Value: ParseLiteral(strings.TrimSpace(m[3]))}, nil
+}
+
+// ParseLiteral recognises numbers and dates; anything else is a string.
+// A value in single or double quotes is always a string, without them.
+func ParseLiteral(raw string) Literal {
+	if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+		return Literal{Raw: raw[1 : len(raw)-1], Kind: String}
+	}
+	lit := Literal{Raw: raw, Kind: String}
+	if n, err := strconv.ParseFloat(raw, 64); err == nil {
+		lit.Kind, lit.Num = Number, n
+	} else if t, ok := parseTime(raw); ok {
+		lit.Kind, lit.Time = Date, t
+	}
+	return lit
+}
+
+func parseTime(raw string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// compareLiteral compares a record value with lit using lit's kind. It
+// reports false when the value cannot be read as that kind.
+func compareLiteral(value interface{}, lit Literal) (int, bool) {
+	switch lit.Kind {
+	case Number:
+		n, ok := toNumber(value)
+		if !ok {
+			return 0, false
+		}
+		return compareFloat(n, lit.Num), true
+	case Date:
+		s, ok := value.(string)
+		if !ok {
+			return 0, false
+		}
+		t, ok := parseTime(s)
+		if !ok {
+			return 0, false
+		}
+		// A date-only literal compares against the record's calendar day.
+		if len(lit.Raw) == len("2006-01-02") {
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		}
+		return t.Compare(lit.Time), true
+	}
+	return strings.Compare(strings.ToLower(fmt.Sprint(value)), strings.ToLower(lit.Raw)), true
+}
+
+// Compare orders two record values: numbers numerically, dates
+// chronologically, everything else case-insensitively. Missing values sort
+// last.
+func Compare(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return compareFloat(x, y)
+		}
+	}
+	if s, ok := a.(string); ok {
+		if t, ok := parseTime(s); ok {
+			if s2, ok := b.(string); ok {
+				if u, ok := parseTime(s2); ok {
+					return t.Compare(u)
+				}
+			}
+		}
+	}
+	return strings.Compare(strings.ToLower(fmt.Sprint(a)), strings.ToLower(fmt.Sprint(b)))
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Lookup returns a record field. A dotted name such as tags.BodyPart reads
+// into nested objects when the record has no field of that exact name;
+// nested keys match case-insensitively.
+func Lookup(record map[string]interface{}, field string) (interface{}, bool) {
+	if value, ok := record[field]; ok || !strings.Contains(field, ".") {
+		return value, ok
+	}
+	var value interface{} = record
+	for _, part := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			for key, v := range object {
+				if strings.EqualFold(key, part) {
+					value, ok = v, true
+					break
+				}
+			}
+			if !ok {
+				return nil, false
+			}
+		}
+	}
+	return value, true
+}
+
+// Filter returns the records matching Where.
+func (q *Query) Filter(records []map[string]interface{}) []map[string]interface{} {
+	if len(q.Where) == 0 {
+		return records
+	}
+	matched := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		if q.Where.Match(record) {
+			matched = append(matched, record)
+		}
+	}
+	return matched
+}
+
+// SortRecords orders records in place by the sort keys. The sort is
+// stable, so records equal on every key keep their previous order (e.g.
+// search relevance).
+func (q *Query) SortRecords(records []map[string]interface{}) {
+	if len(q.Sort) == 0 {
+		return
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		for _, key := range q.Sort {
+			a, _ := Lookup(records[i], key.Field)
+			b, _ := Lookup(records[j], key.Field)
+			cmp := Compare(a, b)
+			if cmp == 0 {
+				continue
+			}
+			if key.Desc {
+				// Keep missing values last in both directions.
+				if a == nil || b == nil {
+					return cmp < 0
+				}
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// Project returns copies of records holding only Fields, or records
+// unchanged when no fields were requested.
+func (q *Query) Project(records []map[string]interface{}) []map[string]interface{} {
+	if len(q.Fields) == 0 {
+		return records
+	}
+	projected := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		out := make(map[string]interface{}, len(q.Fields))
+		for _, field := range q.Fields {
+			path, ok := q.Paths[field]
+			if !ok {
+				path = field
+			}
+			if value, ok := Lookup(record, path); ok {
+				out[field] = value
+			}
+		}
+		projected[i] = out
+	}
+	return projected
+}
@@ -0,0 +1,143 @@
+package query
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	values := url.Values{
+		"sort":            {"-date,severity"},
+		"fields":          {"id,date"},
+		"where":           {"time_hour>=12 and severity=high;comments~slip"},
+		"date>2024-01-01": {""},
+	}
+	q, err := Parse(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []SortKey{{Field: "date", Desc: true}, {Field: "severity"}}; !reflect.DeepEqual(q.Sort, want) {
+		t.Errorf("Sort = %+v, want %+v", q.Sort, want)
+	}
+	if want := []string{"id", "date"}; !reflect.DeepEqual(q.Fields, want) {
+		t.Errorf("Fields = %v, want %v", q.Fields, want)
+	}
+	if got, want := q.Where.String(), "time_hour>=12 and severity=high and comments~slip and date>2024-01-01"; got != want {
+		t.Errorf("Where = %q, want %q", got, want)
+	}
+}
+
+func TestParseInlineConditions(t *testing.T) {
+	// "time_hour>=12" arrives as key "time_hour>" and value "12".
+	values, err := url.ParseQuery("time_hour>=12&severity!=low")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := Parse(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := q.Where.String(), "severity!=low and time_hour>=12"; got != want {
+		t.Errorf("Where = %q, want %q", got, want)
+	}
+}
+
+func TestParseQuotedValues(t *testing.T) {
+	q, err := Parse(url.Values{"where": {`description = "tools and gear" and severity=high; comments~'a;b' AND time_hour="12"`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := And{
+		Condition{Field: "description", Op: Eq, Value: Literal{Raw: "tools and gear", Kind: String}},
+		Condition{Field: "severity", Op: Eq, Value: Literal{Raw: "high", Kind: String}},
+		Condition{Field: "comments", Op: Contains, Value: Literal{Raw: "a;b", Kind: String}},
+		Condition{Field: "time_hour", Op: Eq, Value: Literal{Raw: "12", Kind: String}},
+	}
+	if !reflect.DeepEqual(q.Where, want) {
+		t.Errorf("Where = %#v, want %#v", q.Where, want)
+	}
+	if !q.Where.Match(map[string]interface{}{"description": "Tools and gear", "severity": "high", "comments": "a;b;c", "time_hour": "12"}) {
+		t.Errorf("%s did not match", q.Where)
+	}
+}
+
+func TestParseInvalidCondition(t *testing.T) {
+	if _, err := Parse(url.Values{"where": {"=12"}}); err == nil {
+		t.Error("Parse accepted a condition without a field")
+	}
+}
+
+func TestParseLiteral(t *testing.T) {
+	tests := []struct {
+		raw  string
+		kind Kind
+	}{
+		{"12", Number},
+		{"-1.5", Number},
+		{"2024-01-02", Date},
+		{"2024-01-02T10:00:00Z", Date},
+		{"high", String},
+		{"", String},
+	}
+	for _, tt := range tests {
+		if got := ParseLiteral(tt.raw).Kind; got != tt.kind {
+			t.Errorf("ParseLiteral(%q).Kind = %v, want %v", tt.raw, got, tt.kind)
+		}
+	}
+}
+
+func TestConditionMatch(t *testing.T) {
+	record := map[string]interface{}{
+		"time_hour": float64(14),
+		"date":      "2024-03-01",
+		"severity":  "High",
+		"comments":  "Slipped on ice",
+		"created_by": map[string]interface{}{
+			"name": "Sam Reyes",
+		},
+		"tags": map[string]interface{}{
+			"Witness": []interface{}{"Ann Lee", "Bo Chen"},
+		},
+	}
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{"time_hour>=12", true},
+		{"time_hour<12", false},
+		{"date>2024-01-01", true},
+		{"date<=2024-01-01", false},
+		{"comments~slip", true},
+		{"severity!=low", true},
+		{"created_by.name=Sam Reyes", true},
+		{"location=Site", false},
+		{"location!=Site", true},
+		{"tags.witness=bo chen", true},
+		{"tags.witness=Ann", false},
+		{"tags.witness~ann", true},
+		{"tags.witness!=Ann Lee", false},
+		{"tags.witness!=Cy", true},
+		{"tags.witness>Az", true},
+	}
+	for _, tt := range tests {
+		condition, err := ParseCondition(tt.condition)
+		if err != nil {
+			t.Fatalf("ParseCondition(%q): %v", tt.condition, err)
+		}
+		if got := condition.Match(record); got != tt.want {
+			t.Errorf("%s matched %v, want %v", tt.condition, got, tt.want)
+		}
+	}
+}
+
+func TestProjectPaths(t *testing.T) {
+	q := &Query{Fields: []string{"id", "tag.Witness", "missing"}, Paths: map[string]string{"tag.Witness": "tags.Witness"}}
+	records := []map[string]interface{}{{"id": 1, "tags": map[string]interface{}{"witness": "Ann"}}}
+	got := q.Project(records)
+	want := []map[string]interface{}{{"id": 1, "tag.Witness": "Ann"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Project = %v, want %v", got, want)
+	}
+}
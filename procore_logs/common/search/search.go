@@ -0,0 +1,187 @@
+// Package search implements the free-text search shared by the log filter
+// endpoints: AND-ed terms, "quoted phrases", field prefixes such as
+// company:acme, and relevance ordering.
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Fields are the log fields searched by unprefixed terms, weighted by how
+// much a match in them says about relevance.
+var Fields = map[string]float64{
+	"involved_name":    3,
+	"involved_company": 3,
+	"severity":         2,
+	"location":         2,
+	"comments":         1,
+	"date":             1,
+}
+
+// aliases are the short field prefixes accepted in queries.
+var aliases = map[string]string{
+	"name":     "involved_name",
+	"company":  "involved_company",
+	"comment":  "comments",
+	"location": "location",
+	"severity": "severity",
+	"date":     "date",
+}
+
+// Term is one condition of a query. Field is empty for terms that may
+// match any of Fields.
+type Term struct {
+	Field string
+	Text  string
+}
+
+// Query is a parsed search string. A record matches when every term does.
+type Query struct {
+	Terms []Term
+}
+
+// Parse splits s into terms. Whitespace separates terms, double quotes
+// group a phrase, and a known field name or alias followed by a colon
+// (company:acme, name:"jane doe") restricts a term to that field. Matching
+// is case-insensitive.
+func Parse(s string) Query {
+	var q Query
+	for _, token := range tokenize(s) {
+		term := Term{Text: token.text}
+		if field, value, ok := strings.Cut(token.text, ":"); ok && !token.quoted {
+			if name, known := fieldName(field); known {
+				term = Term{Field: name, Text: value}
+			}
+		}
+		term.Text = strings.ToLower(strings.TrimSpace(term.Text))
+		if term.Text != "" {
+			q.Terms = append(q.Terms, term)
+		}
+	}
+	return q
+}
+
+func fieldName(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if alias, ok := aliases[name]; ok {
+		return alias, true
+	}
+	_, ok := Fields[name]
+	return name, ok
+}
+
+type token struct {
+	text string
+	// quoted is set for a token that is entirely a "phrase", which is
+	// never read as field:value.
+	quoted bool
+}
+
+func tokenize(s string) []token {
+	var tokens []token
+	var current strings.Builder
+	inQuotes, sawQuote, startedQuoted := false, false, false
+
+	flush := func() {
+		if current.Len() > 0 || sawQuote {
+			text := current.String()
+			tokens = append(tokens, token{text: text, quoted: sawQuote && startedQuoted})
+		}
+		current.Reset()
+		sawQuote, startedQuoted = false, false
+	}
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			if !inQuotes && current.Len() == 0 {
+				startedQuoted = true
+			}
+			inQuotes = !inQuotes
+			sawQuote = true
+		case unicode.IsSpace(r) && !inQuotes:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// Empty reports whether the query has no terms and so matches everything.
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0
+}
+
+// Score reports whether record matches every term and, if so, how relevant
+// it is. Each matching field adds its weight, doubled for an exact value
+// match and raised by half for a match at the start of a word.
+func (q Query) Score(record map[string]interface{}) (float64, bool) {
+	total := 0.0
+	for _, term := range q.Terms {
+		score := 0.0
+		if term.Field != "" {
+			weight, ok := Fields[term.Field]
+			if !ok {
+				weight = 1
+			}
+			score = fieldScore(record[term.Field], term.Text, weight)
+		} else {
+			for field, weight := range Fields {
+				score += fieldScore(record[field], term.Text, weight)
+			}
+		}
+		if score == 0 {
+			return 0, false
+		}
+		total += score
+	}
+	return total, true
+}
+
+func fieldScore(value interface{}, text string, weight float64) float64 {
+	if value == nil {
+		return 0
+	}
+	s := strings.ToLower(fmt.Sprint(value))
+	i := strings.Index(s, text)
+	if i < 0 {
+		return 0
+	}
+
+	if s == text {
+		return 2 * weight
+	}
+	if before, _ := utf8.DecodeLastRuneInString(s[:i]); i == 0 || !unicode.IsLetter(before) && !unicode.IsDigit(before) {
+		return weight * 1.5
+	}
+	return weight
+}
+
+// Rank returns the records matching the query, most relevant first. Ties
+// keep their original order.
+func (q Query) Rank(records []map[string]interface{}) []map[string]interface{} {
+	type scored struct {
+		record map[string]interface{}
+		score  float64
+	}
+
+	matches := make([]scored, 0, len(records))
+	for _, record := range records {
+		if score, ok := q.Score(record); ok {
+			matches = append(matches, scored{record, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	ranked := make([]map[string]interface{}, len(matches))
+	for i, m := range matches {
+		ranked[i] = m.record
+	}
+	return ranked
+}
@@ -0,0 +1,103 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []Term
+	}{
+		{"", nil},
+		{"  ", nil},
+		{"Jane", []Term{{Text: "jane"}}},
+		{"jane  DOE", []Term{{Text: "jane"}, {Text: "doe"}}},
+		{`"jane doe"`, []Term{{Text: "jane doe"}}},
+		{`"jane doe" acme`, []Term{{Text: "jane doe"}, {Text: "acme"}}},
+		{"company:Acme", []Term{{Field: "involved_company", Text: "acme"}}},
+		{"COMPANY:acme", []Term{{Field: "involved_company", Text: "acme"}}},
+		{"involved_name:jane", []Term{{Field: "involved_name", Text: "jane"}}},
+		{`name:"jane doe" severity:high`, []Term{{Field: "involved_name", Text: "jane doe"}, {Field: "severity", Text: "high"}}},
+		{"unknown:value", []Term{{Text: "unknown:value"}}},
+		{"time:10:30", []Term{{Text: "time:10:30"}}},
+		{"date:2024-01-02", []Term{{Field: "date", Text: "2024-01-02"}}},
+		{`"company:acme"`, []Term{{Text: "company:acme"}}},
+		{"company:", nil},
+		{`""`, nil},
+		{`"unclosed phrase`, []Term{{Text: "unclosed phrase"}}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.in).Terms; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []token
+	}{
+		{"a b", []token{{text: "a"}, {text: "b"}}},
+		{`"a b" c`, []token{{text: "a b", quoted: true}, {text: "c"}}},
+		{`name:"a b"`, []token{{text: "name:a b"}}},
+		{"a\tb\nc", []token{{text: "a"}, {text: "b"}, {text: "c"}}},
+		{`""`, []token{{text: "", quoted: true}}},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		query  string
+		record map[string]interface{}
+		score  float64
+		ok     bool
+	}{
+		{"acme", map[string]interface{}{"involved_company": "Acme"}, 6, true},
+		{"acme", map[string]interface{}{"involved_company": "Acme Builders"}, 4.5, true},
+		{"acme", map[string]interface{}{"involved_company": "Big Acme"}, 4.5, true},
+		{"acme", map[string]interface{}{"involved_company": "Bigacme"}, 3, true},
+		{"acme", map[string]interface{}{"comments": "acme"}, 2, true},
+		{"acme", map[string]interface{}{"involved_company": "Acme", "comments": "acme"}, 8, true},
+		{"acme", map[string]interface{}{"involved_company": "Other"}, 0, false},
+		{"acme jane", map[string]interface{}{"involved_company": "Acme"}, 0, false},
+		{"company:acme", map[string]interface{}{"comments": "acme"}, 0, false},
+		{"company:acme", map[string]interface{}{"involved_company": "acme"}, 6, true},
+		{`"big acme"`, map[string]interface{}{"involved_company": "Big Acme"}, 6, true},
+		{"acme", map[string]interface{}{"involved_company": "éacme"}, 3, true},
+	}
+	for _, tt := range tests {
+		score, ok := Parse(tt.query).Score(tt.record)
+		if score != tt.score || ok != tt.ok {
+			t.Errorf("%q on %v = %v, %v; want %v, %v", tt.query, tt.record, score, ok, tt.score, tt.ok)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	records := []map[string]interface{}{
+		{"id": 1, "comments": "acme delivered"},
+		{"id": 2, "involved_company": "Acme"},
+		{"id": 3, "location": "north gate"},
+		{"id": 4, "involved_company": "Acme Builders"},
+		{"id": 5, "comments": "called acme"},
+	}
+	var ids []interface{}
+	for _, record := range Parse("acme").Rank(records) {
+		ids = append(ids, record["id"])
+	}
+	// Exact before word-start before comments; equal scores keep their order.
+	if want := []interface{}{2, 4, 1, 5}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Rank = %v, want %v", ids, want)
+	}
+	if got := Parse("").Rank(records); len(got) != len(records) {
+		t.Errorf("empty query kept %d of %d records", len(got), len(records))
+	}
+}
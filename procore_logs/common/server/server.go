@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"procore-common/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds the HTTP settings shared by every service binary.
+type Config struct {
+	Port string
+	// ExtraPorts are additional ports served by the same router, so
+	// frontends pinned to the old per-service ports keep working.
+	ExtraPorts []string
+	// FrontendURLs are the origins allowed by CORS.
+	FrontendURLs []string
+}
+
+// LoadConfig reads PORT, EXTRA_PORTS and FRONTEND_URLS (or FRONTEND_URL)
+// from the environment, falling back to the given defaults.
+func LoadConfig(defaultPort string, defaultFrontendURLs ...string) Config {
+	cfg := Config{
+		Port:         os.Getenv("PORT"),
+		ExtraPorts:   splitList(os.Getenv("EXTRA_PORTS")),
+		FrontendURLs: splitList(os.Getenv("FRONTEND_URLS")),
+	}
+	if cfg.Port == "" {
+		cfg.Port = defaultPort
+	}
+	if len(cfg.FrontendURLs) == 0 {
+		if frontendURL := os.Getenv("FRONTEND_URL"); frontendURL != "" {
+			cfg.FrontendURLs = []string{frontendURL}
+		} else {
+			cfg.FrontendURLs = defaultFrontendURLs
+		}
+	}
+	return cfg
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// New returns a router with CORS and the auth endpoints installed and the
+// given log resources mounted on svc.
+func New(cfg Config, svc *logs.Service, resources ...*logs.Resource) *gin.Engine {
+	router := gin.Default()
+	router.Use(CORS(cfg.FrontendURLs))
+
+	svc.ReturnURLs = cfg.FrontendURLs
+	router.GET("/api/auth/login", svc.Login)
+	router.GET("/api/auth/callback", svc.Callback)
+	router.POST("/api/auth/token", svc.GetAuthToken)
+	router.POST("/api/auth/refresh", svc.RefreshAuthToken)
+	router.POST("/api/auth/logout", svc.Logout)
+	router.GET("/api/companies", svc.Companies)
+	router.GET("/api/projects", svc.Projects)
+	router.GET("/api/companies/:company_id/projects", svc.Projects)
+	router.POST("/api/webhooks/procore", svc.ProcoreHook)
+	for _, prefix := range []string{"/api", logs.ScopePrefix} {
+		router.GET(prefix+"/outbox", svc.ListOutbox)
+		router.POST(prefix+"/outbox/:id/retry", svc.RetryOutbox)
+		router.DELETE(prefix+"/outbox/:id", svc.DiscardOutbox)
+		router.GET(prefix+"/webhooks/subscriptions", svc.ListWebhooks)
+		router.POST(prefix+"/webhooks/subscriptions", svc.CreateWebhook)
+		router.DELETE(prefix+"/webhooks/subscriptions/:id", svc.DeleteWebhook)
+		router.GET(prefix+"/webhooks/deliveries", svc.ListDeliveries)
+		router.POST(prefix+"/webhooks/deliveries/:id/retry", svc.RetryDelivery)
+		router.GET(prefix+"/webhooks/procore/hooks", svc.ListProcoreHooks)
+		router.POST(prefix+"/webhooks/procore/hooks", svc.RegisterProcoreHooks)
+		router.DELETE(prefix+"/webhooks/procore/hooks", svc.UnregisterProcoreHooks)
+	}
+	for _, resource := range resources {
+		svc.Register(router, resource)
+	}
+	return router
+}
+
+// CORS allows the given frontend origins. The first origin is sent when the
+// request's Origin is not in the list.
+func CORS(origins []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := ""
+		if len(origins) > 0 {
+			origin = origins[0]
+		}
+		for _, allowed := range origins {
+			if allowed == c.GetHeader("Origin") {
+				origin = allowed
+				break
+			}
+		}
+
+		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+logs.SessionHeader+", "+logs.IdempotencyHeader+", "+logs.BaseUpdatedAtHeader)
+		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Total, Per-Page, Content-Disposition, "+logs.SourceHeader+", "+logs.SyncedAtHeader)
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Run serves router on cfg.Port and every extra port, returning the first
+// listener error.
+func Run(router http.Handler, cfg Config) error {
+	errs := make(chan error, 1+len(cfg.ExtraPorts))
+	for _, port := range append([]string{cfg.Port}, cfg.ExtraPorts...) {
+		go func(port string) {
+			errs <- http.ListenAndServe(":"+port, router)
+		}(port)
+	}
+	return <-errs
+}
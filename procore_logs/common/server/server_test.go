@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"procore-common/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// procoreStub records the requests it gets and answers the token
+// endpoint and one project's call logs.
+type procoreStub struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (p *procoreStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch req.URL.Path {
+	case "/oauth/token":
+		w.Write([]byte(`{"access_token":"stub-token","token_type":"Bearer","expires_in":7200,"refresh_token":"stub-refresh"}`))
+	case "/rest/v1.1/projects/22/call_logs":
+		w.Write([]byte(`[{"id":1,"comments":"from the stub"}]`))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (p *procoreStub) last() *http.Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.requests) == 0 {
+		return nil
+	}
+	return p.requests[len(p.requests)-1]
+}
+
+// newRouter mounts the call logs on a service whose Procore hosts are
+// overridden to point at stub.
+func newRouter(t *testing.T, stub *procoreStub) http.Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	procore := httptest.NewServer(stub)
+	t.Cleanup(procore.Close)
+
+	t.Setenv("PROCORE_ENV", "custom")
+	t.Setenv("PROCORE_API_URL", procore.URL+"/")
+	t.Setenv("PROCORE_LOGIN_URL", procore.URL)
+	t.Setenv("PROCORE_API_VERSION", "v1.1")
+	t.Setenv("PROCORE_COMPANY_ID", "11")
+	t.Setenv("PROCORE_PROJECT_ID", "22")
+	for _, name := range []string{"AUTH_SESSIONS", "PROCORE_REDIRECT_URI", "PROCORE_SERVICE_ACCOUNT", "MIRROR_PATH", "OUTBOX_PATH", "WEBHOOKS_PATH", "SYNC_INTERVAL"} {
+		t.Setenv(name, "")
+	}
+
+	cfg, err := logs.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := logs.NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(Config{FrontendURLs: []string{"http://localhost:3000"}}, svc, logs.CallLogs)
+}
+
+func TestBaseURLOverrideList(t *testing.T) {
+	stub := &procoreStub{}
+	router := newRouter(t, stub)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/call_logs", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "from the stub") {
+		t.Errorf("body = %s, want the stub's logs", w.Body)
+	}
+	sent := stub.last()
+	if sent == nil {
+		t.Fatal("no request reached the stub")
+	}
+	if sent.URL.Path != "/rest/v1.1/projects/22/call_logs" {
+		t.Errorf("path = %s", sent.URL.Path)
+	}
+	if got := sent.Header.Get("Authorization"); got != "Bearer user-token" {
+		t.Errorf("Authorization = %q, want the caller's", got)
+	}
+	if got := sent.Header.Get("Procore-Company-Id"); got != "11" {
+		t.Errorf("Procore-Company-Id = %q, want 11", got)
+	}
+}
+
+func TestBaseURLOverrideScopedRoute(t *testing.T) {
+	stub := &procoreStub{}
+	router := newRouter(t, stub)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/companies/33/projects/22/call_logs", nil)
+	req.Header.Set("Authorization", "Bearer user-token")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if got := stub.last().Header.Get("Procore-Company-Id"); got != "33" {
+		t.Errorf("Procore-Company-Id = %q, want the route's 33", got)
+	}
+}
+
+func TestBaseURLOverrideToken(t *testing.T) {
+	stub := &procoreStub{}
+	router := newRouter(t, stub)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/token", strings.NewReader(`{"code":"abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if sent := stub.last(); sent == nil || sent.URL.Path != "/oauth/token" {
+		t.Fatalf("token request = %v, want /oauth/token on the login override", sent)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &token); err != nil || token.AccessToken != "stub-token" {
+		t.Errorf("body = %s, want the stub's token", w.Body)
+	}
+}
@@ -0,0 +1,72 @@
+package session
+
+import (
+	"time"
+
+	"procore-common/procore"
+)
+
+// LoginTTL bounds how long a user may take on Procore's login page.
+const LoginTTL = 10 * time.Minute
+
+// Login is an authorization-code flow in progress, keyed by its state.
+type Login struct {
+	State    string
+	Verifier string
+	// Challenge is the PKCE challenge sent to the authorize endpoint.
+	Challenge string
+	// ReturnTo is where the browser goes once the session is created.
+	ReturnTo string
+	Created  time.Time
+}
+
+// BeginLogin starts an authorization-code flow with a fresh state and PKCE
+// verifier.
+func (m *Manager) BeginLogin(returnTo string) (*Login, error) {
+	state, err := procore.RandomString(24)
+	if err != nil {
+		return nil, err
+	}
+	verifier, challenge, err := procore.NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	login := &Login{
+		State:     state,
+		Verifier:  verifier,
+		Challenge: challenge,
+		ReturnTo:  returnTo,
+		Created:   time.Now(),
+	}
+
+	m.loginsMu.Lock()
+	defer m.loginsMu.Unlock()
+	if m.logins == nil {
+		m.logins = make(map[string]*Login)
+	}
+	for key, pending := range m.logins {
+		if time.Since(pending.Created) > LoginTTL {
+			delete(m.logins, key)
+		}
+	}
+	m.logins[state] = login
+	return login, nil
+}
+
+// FinishLogin consumes the login started with state. It reports false for
+// unknown, reused or expired states.
+func (m *Manager) FinishLogin(state string) (*Login, bool) {
+	m.loginsMu.Lock()
+	defer m.loginsMu.Unlock()
+
+	login, ok := m.logins[state]
+	if !ok {
+		return nil, false
+	}
+	delete(m.logins, state)
+	if time.Since(login.Created) > LoginTTL {
+		return nil, false
+	}
+	return login, true
+}
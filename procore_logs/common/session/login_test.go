@@ -0,0 +1,36 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"procore-common/procore"
+)
+
+func TestLogin(t *testing.T) {
+	m := NewManager(NewMemoryStore(0), procore.OAuth{})
+	login, err := m.BeginLogin("http://localhost:3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.State == "" || login.Verifier == "" || login.Challenge == "" {
+		t.Fatalf("incomplete login %+v", login)
+	}
+
+	if _, ok := m.FinishLogin("other"); ok {
+		t.Error("FinishLogin accepted an unknown state")
+	}
+	got, ok := m.FinishLogin(login.State)
+	if !ok || got.ReturnTo != "http://localhost:3000" {
+		t.Errorf("FinishLogin = %+v, %v", got, ok)
+	}
+	if _, ok := m.FinishLogin(login.State); ok {
+		t.Error("FinishLogin accepted a state twice")
+	}
+
+	stale, _ := m.BeginLogin("")
+	stale.Created = time.Now().Add(-2 * LoginTTL)
+	if _, ok := m.FinishLogin(stale.State); ok {
+		t.Error("FinishLogin accepted an expired login")
+	}
+}
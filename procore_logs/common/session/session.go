@@ -0,0 +1,236 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"procore-common/procore"
+)
+
+// ErrExpired is returned when a session is unknown or its token can no
+// longer be refreshed; the user has to log in again.
+var ErrExpired = errors.New("session expired, please log in again")
+
+// Store keeps Procore tokens keyed by opaque session ID.
+type Store interface {
+	Get(id string) (*procore.Token, bool)
+	Put(id string, token *procore.Token)
+	Delete(id string)
+}
+
+// DefaultTTL is how long a session may go unused before a MemoryStore
+// forgets it.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// sweepInterval is how often a MemoryStore looks for idle sessions.
+const sweepInterval = time.Minute
+
+// MemoryStore is a Store that lives for the lifetime of the process.
+// Sessions unused for longer than its TTL are dropped.
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	swept   time.Time
+}
+
+type memoryEntry struct {
+	token    *procore.Token
+	lastUsed time.Time
+}
+
+// NewMemoryStore returns a MemoryStore forgetting sessions unused for ttl,
+// or DefaultTTL when ttl is not positive.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &MemoryStore{ttl: ttl, entries: make(map[string]*memoryEntry)}
+}
+
+func (s *MemoryStore) Get(id string) (*procore.Token, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked()
+	entry, ok := s.entries[id]
+	if !ok || time.Since(entry.lastUsed) > s.ttl {
+		delete(s.entries, id)
+		return nil, false
+	}
+	entry.lastUsed = time.Now()
+	return entry.token, true
+}
+
+func (s *MemoryStore) Put(id string, token *procore.Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweepLocked()
+	s.entries[id] = &memoryEntry{token: token, lastUsed: time.Now()}
+}
+
+func (s *MemoryStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+}
+
+// sweepLocked drops idle sessions, at most once per sweepInterval.
+func (s *MemoryStore) sweepLocked() {
+	if time.Since(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = time.Now()
+	for id, entry := range s.entries {
+		if time.Since(entry.lastUsed) > s.ttl {
+			delete(s.entries, id)
+		}
+	}
+}
+
+// Manager hands out sessions and keeps their access tokens fresh.
+type Manager struct {
+	Store Store
+	OAuth procore.OAuth
+
+	// locks serialize the refreshes of each session: Procore refresh
+	// tokens are single use, so two concurrent refreshes of one session
+	// would log it out. Other sessions do not wait.
+	locksMu sync.Mutex
+	locks   map[string]*sessionLock
+
+	loginsMu sync.Mutex
+	logins   map[string]*Login
+}
+
+func NewManager(store Store, oauth procore.OAuth) *Manager {
+	return &Manager{Store: store, OAuth: oauth}
+}
+
+type sessionLock struct {
+	mu sync.Mutex
+	// users counts the callers holding or waiting for mu, so the lock is
+	// dropped once nobody needs it.
+	users int
+}
+
+// lock locks session id and returns its unlock.
+func (m *Manager) lock(id string) func() {
+	m.locksMu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*sessionLock)
+	}
+	l := m.locks[id]
+	if l == nil {
+		l = &sessionLock{}
+		m.locks[id] = l
+	}
+	l.users++
+	m.locksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		m.locksMu.Lock()
+		if l.users--; l.users == 0 {
+			delete(m.locks, id)
+		}
+		m.locksMu.Unlock()
+	}
+}
+
+// Create stores token under a new random session ID.
+func (m *Manager) Create(token *procore.Token) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	id := hex.EncodeToString(buf)
+	m.Store.Put(id, token)
+	return id, nil
+}
+
+// Exists reports whether id names a live session.
+func (m *Manager) Exists(id string) bool {
+	_, ok := m.Store.Get(id)
+	return ok
+}
+
+// Token returns the session's token, refreshing it first when it has
+// expired.
+func (m *Manager) Token(ctx context.Context, id string) (*procore.Token, error) {
+	defer m.lock(id)()
+
+	token, ok := m.Store.Get(id)
+	if !ok {
+		return nil, ErrExpired
+	}
+	if !token.Expired() {
+		return token, nil
+	}
+	return m.refreshLocked(ctx, id, token)
+}
+
+// Refresh renews the session's token regardless of its expiry.
+func (m *Manager) Refresh(ctx context.Context, id string) (*procore.Token, error) {
+	defer m.lock(id)()
+
+	token, ok := m.Store.Get(id)
+	if !ok {
+		return nil, ErrExpired
+	}
+	return m.refreshLocked(ctx, id, token)
+}
+
+func (m *Manager) refreshLocked(ctx context.Context, id string, token *procore.Token) (*procore.Token, error) {
+	if token.RefreshToken == "" {
+		m.Store.Delete(id)
+		return nil, ErrExpired
+	}
+
+	resp, err := m.OAuth.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		var apiErr *procore.APIError
+		if errors.As(err, &apiErr) {
+			// Procore rejected the refresh token; it will not work again.
+			m.Store.Delete(id)
+			return nil, fmt.Errorf("%w: %v", ErrExpired, err)
+		}
+		return nil, err
+	}
+
+	refreshed := resp.Token()
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	m.Store.Put(id, refreshed)
+	return refreshed, nil
+}
+
+// Delete ends the session.
+func (m *Manager) Delete(id string) {
+	m.Store.Delete(id)
+}
+
+// TokenSource returns a procore.TokenSource backed by the session.
+func (m *Manager) TokenSource(id string) procore.TokenSource {
+	return sessionToken{manager: m, id: id}
+}
+
+type sessionToken struct {
+	manager *Manager
+	id      string
+}
+
+func (t sessionToken) Token(ctx context.Context) (string, error) {
+	token, err := t.manager.Token(ctx, t.id)
+	if err != nil {
+		return "", err
+	}
+	return token.Header(), nil
+}
@@ -0,0 +1,166 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"procore-common/procore"
+)
+
+// tokenStub is a token endpoint whose refresh tokens, like Procore's, work
+// once. Refreshes of the refresh token "slow" wait for release.
+type tokenStub struct {
+	mu        sync.Mutex
+	refreshes int
+	used      map[string]bool
+	release   chan struct{}
+}
+
+func (s *tokenStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	refreshToken := req.PostFormValue("refresh_token")
+	if refreshToken == "slow" {
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used[refreshToken] || refreshToken == "revoked" {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	s.used[refreshToken] = true
+	s.refreshes++
+	fmt.Fprintf(w, `{"access_token":"access-%d","token_type":"Bearer","expires_in":7200,"refresh_token":"refresh-%d"}`, s.refreshes, s.refreshes)
+}
+
+func newManager(t *testing.T) (*Manager, *tokenStub) {
+	t.Helper()
+	stub := &tokenStub{used: map[string]bool{}, release: make(chan struct{})}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	oauth := procore.OAuth{Environment: procore.Environment{LoginBaseURL: server.URL}}
+	return NewManager(NewMemoryStore(time.Hour), oauth), stub
+}
+
+func expired(refreshToken string) *procore.Token {
+	return &procore.Token{AccessToken: "old", RefreshToken: refreshToken, Expiry: time.Now().Add(-time.Hour)}
+}
+
+func TestTokenRefreshesOnce(t *testing.T) {
+	m, stub := newManager(t)
+	id, err := m.Create(expired("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	errs := make([]error, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := m.Token(context.Background(), id)
+			if err == nil {
+				tokens[i] = token.AccessToken
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range tokens {
+		if errs[i] != nil || tokens[i] != "access-1" {
+			t.Errorf("caller %d got %q, %v; want access-1", i, tokens[i], errs[i])
+		}
+	}
+	if stub.refreshes != 1 {
+		t.Errorf("%d refreshes, want 1", stub.refreshes)
+	}
+}
+
+func TestRefreshKeepsRotatedToken(t *testing.T) {
+	m, _ := newManager(t)
+	id, _ := m.Create(expired("first"))
+
+	for want := 1; want <= 2; want++ {
+		token, err := m.Refresh(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.RefreshToken != fmt.Sprintf("refresh-%d", want) {
+			t.Errorf("refresh token = %s after %d refreshes", token.RefreshToken, want)
+		}
+	}
+}
+
+func TestRefreshRejected(t *testing.T) {
+	m, _ := newManager(t)
+	id, _ := m.Create(expired("revoked"))
+
+	if _, err := m.Token(context.Background(), id); !errors.Is(err, ErrExpired) {
+		t.Errorf("Token = %v, want ErrExpired", err)
+	}
+	if m.Exists(id) {
+		t.Error("session with a rejected refresh token still exists")
+	}
+}
+
+func TestRefreshDoesNotBlockOtherSessions(t *testing.T) {
+	m, stub := newManager(t)
+	slow, _ := m.Create(expired("slow"))
+	fresh, _ := m.Create(&procore.Token{AccessToken: "fresh", Expiry: time.Now().Add(time.Hour)})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Token(context.Background(), slow)
+	}()
+	defer func() {
+		close(stub.release)
+		<-done
+	}()
+	time.Sleep(20 * time.Millisecond) // let the slow refresh take its lock
+
+	got := make(chan string, 1)
+	go func() {
+		token, _ := m.Token(context.Background(), fresh)
+		got <- token.AccessToken
+	}()
+	select {
+	case token := <-got:
+		if token != "fresh" {
+			t.Errorf("token = %s, want fresh", token)
+		}
+	case <-time.After(time.Second):
+		t.Error("a session waited on another session's refresh")
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	s := NewMemoryStore(50 * time.Millisecond)
+	s.Put("idle", &procore.Token{AccessToken: "a"})
+	s.Put("used", &procore.Token{AccessToken: "b"})
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		if _, ok := s.Get("used"); !ok {
+			t.Fatalf("session in use expired after %d reads", i)
+		}
+	}
+	if _, ok := s.Get("idle"); ok {
+		t.Error("idle session outlived the TTL")
+	}
+
+	s.swept = time.Time{}
+	time.Sleep(60 * time.Millisecond)
+	s.Put("new", &procore.Token{})
+	if _, ok := s.entries["used"]; ok {
+		t.Error("sweep kept an idle session")
+	}
+}
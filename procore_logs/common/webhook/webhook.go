@@ -0,0 +1,425 @@
+// Package webhook keeps outbound webhook subscriptions and their delivery
+// log in an embedded BoltDB file, and signs and sends deliveries.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	subscriptionsBucket = []byte("subscriptions")
+	deliveriesBucket    = []byte("deliveries")
+	// pendingBucket indexes the pending deliveries by ID, so they are
+	// found without reading the delivery log.
+	pendingBucket = []byte("pending")
+)
+
+// Headers of a delivery.
+const (
+	// SignatureHeader is "sha256=" and the hex HMAC-SHA256 of
+	// "<timestamp>.<body>" keyed with the subscription's secret.
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Statuses of a Delivery.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// ErrNotFound is returned for an unknown subscription or delivery.
+var ErrNotFound = errors.New("not found")
+
+// ErrPrivateAddress is returned for a subscriber on a loopback, private,
+// link-local or otherwise internal address, which would let subscriptions
+// reach services behind the gateway.
+var ErrPrivateAddress = errors.New("address is not public")
+
+// Subscription asks for the events matching it to be posted to URL.
+type Subscription struct {
+	ID        string `json:"id"`
+	CompanyID string `json:"company_id"`
+	ProjectID string `json:"project_id"`
+	URL       string `json:"url"`
+	// Secret keys the signature of every delivery.
+	Secret string `json:"secret,omitempty"`
+	// Events are the event types wanted, e.g. "created"; empty means all.
+	Events []string `json:"events"`
+	// LogTypes are the Procore log types wanted, e.g. "accident_logs";
+	// empty means all.
+	LogTypes []string `json:"log_types"`
+	// Where filters the logs in the query language of the filter
+	// endpoints, e.g. "severity=high and involved_company=Acme".
+	Where     string    `json:"where,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Event is the body of a delivery.
+type Event struct {
+	ID string `json:"id"`
+	// Type is "created", "updated" or "deleted".
+	Type      string `json:"type"`
+	LogType   string `json:"log_type"`
+	CompanyID string `json:"company_id"`
+	ProjectID string `json:"project_id"`
+	LogID     string `json:"log_id"`
+	// Source says how the change was seen: "gateway" for a write made
+	// through it, "sync" for one found in Procore and "procore" for one
+	// Procore reported through a hook.
+	Source     string    `json:"source"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Record is the log after the change, or as last seen when deleted.
+	Record map[string]interface{} `json:"record"`
+}
+
+// Delivery is an Event on its way to one Subscription, with the outcome
+// of its latest attempt.
+type Delivery struct {
+	ID             uint64          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	URL            string          `json:"url"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Body           json.RawMessage `json:"body"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	// ResponseStatus is the HTTP status of the last attempt.
+	ResponseStatus int        `json:"response_status,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Store is a BoltDB file holding subscriptions by ID and deliveries in ID
+// order, with an index of the pending ones.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the store at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open webhooks %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{subscriptionsBucket, deliveriesBucket, pendingBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open webhooks %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// AddSubscription stores sub under its ID.
+func (s *Store) AddSubscription(sub Subscription) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(subscriptionsBucket), []byte(sub.ID), sub)
+	})
+}
+
+// Subscriptions returns every subscription.
+func (s *Store) Subscriptions() ([]Subscription, error) {
+	subs := make([]Subscription, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(subscriptionsBucket).ForEach(func(_, v []byte) error {
+			var sub Subscription
+			if err := json.Unmarshal(v, &sub); err != nil {
+				return err
+			}
+			subs = append(subs, sub)
+			return nil
+		})
+	})
+	return subs, err
+}
+
+// Subscription returns one subscription.
+func (s *Store) Subscription(id string) (sub Subscription, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(subscriptionsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &sub)
+	})
+	return sub, err
+}
+
+// DeleteSubscription removes a subscription. Its deliveries are kept.
+func (s *Store) DeleteSubscription(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(subscriptionsBucket)
+		if b.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+// AddDelivery queues a delivery as pending, with a new ID.
+func (s *Store) AddDelivery(d Delivery) (Delivery, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		d.ID, d.Status, d.NextAttemptAt, d.CreatedAt = id, StatusPending, now, now
+		return putDelivery(tx, d)
+	})
+	return d, err
+}
+
+// Delivery returns one delivery.
+func (s *Store) Delivery(id uint64) (d Delivery, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(deliveriesBucket).Get(deliveryKey(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &d)
+	})
+	return d, err
+}
+
+// Deliveries returns the deliveries match accepts, newest first, at most
+// limit of them when limit is positive.
+func (s *Store) Deliveries(match func(Delivery) bool, limit int) ([]Delivery, error) {
+	deliveries := make([]Delivery, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(deliveriesBucket).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(deliveries) < limit); k, v = c.Prev() {
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if match == nil || match(d) {
+				deliveries = append(deliveries, d)
+			}
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+// Due returns the pending deliveries whose next attempt is not after now,
+// oldest first. Only the pending index is read, however long the delivery
+// log.
+func (s *Store) Due(now time.Time) ([]Delivery, error) {
+	deliveries := make([]Delivery, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket)
+		return tx.Bucket(pendingBucket).ForEach(func(k, _ []byte) error {
+			var d Delivery
+			data := b.Get(k)
+			if data == nil {
+				return nil
+			}
+			if err := json.Unmarshal(data, &d); err != nil {
+				return err
+			}
+			if !d.NextAttemptAt.After(now) {
+				deliveries = append(deliveries, d)
+			}
+			return nil
+		})
+	})
+	return deliveries, err
+}
+
+// UpdateDelivery stores a changed delivery.
+func (s *Store) UpdateDelivery(d Delivery) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(deliveriesBucket).Get(deliveryKey(d.ID)) == nil {
+			return ErrNotFound
+		}
+		return putDelivery(tx, d)
+	})
+}
+
+// Prune drops the deliveries created before cutoff that are no longer
+// pending.
+func (s *Store) Prune(cutoff time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket)
+		var expired [][]byte
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var d Delivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if !d.CreatedAt.Before(cutoff) {
+				break
+			}
+			if d.Status != StatusPending {
+				expired = append(expired, k)
+			}
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// putDelivery stores d and keeps it in the pending index while it is
+// pending.
+func putDelivery(tx *bolt.Tx, d Delivery) error {
+	if err := put(tx.Bucket(deliveriesBucket), deliveryKey(d.ID), d); err != nil {
+		return err
+	}
+	pending := tx.Bucket(pendingBucket)
+	if d.Status == StatusPending {
+		return pending.Put(deliveryKey(d.ID), nil)
+	}
+	return pending.Delete(deliveryKey(d.ID))
+}
+
+func put(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// deliveryKey orders deliveries by ID by storing it big-endian.
+func deliveryKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+// Sign returns the SignatureHeader value of body sent at timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts a delivery to its URL, signed with secret, and returns the
+// response status. Statuses other than 2xx are returned with an error
+// naming only the status, so the response of whatever answered is not
+// kept.
+func Send(ctx context.Context, client *http.Client, d Delivery, secret string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(d.ID, 10))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, d.Body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// NewHTTPClient returns the client deliveries are sent with. It does not
+// follow redirects or use a proxy, and unless allowPrivate is set it
+// refuses to connect to addresses that are not public, whatever the
+// subscriber's host name resolves to at the time.
+func NewHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !public(ip) {
+				return fmt.Errorf("%s: %w", host, ErrPrivateAddress)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CheckURL reports whether raw is an http or https URL deliveries may be
+// sent to: unless allowPrivate is set, every address its host resolves to
+// must be public.
+func CheckURL(ctx context.Context, raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("must be an http or https URL")
+	}
+	if allowPrivate {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !public(addr.IP) {
+			return fmt.Errorf("%s: %w", u.Hostname(), ErrPrivateAddress)
+		}
+	}
+	return nil
+}
+
+// public reports whether ip is routable on the internet.
+func public(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip))
+}
+
+// sharedAddressSpace is carrier-grade NAT space (RFC 6598), internal like
+// the private ranges.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
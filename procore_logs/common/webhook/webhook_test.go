@@ -0,0 +1,131 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("shh", "1700000000", []byte(`{"event":"created"}`))
+	want := "sha256=8a17bc4e0b2911de88b16b652120d9a9472d9ca56198e6d92f435065298a636d"
+	if got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if Sign("other", "1700000000", []byte(`{"event":"created"}`)) == want {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign("shh", "1700000001", []byte(`{"event":"created"}`)) == want {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestSend(t *testing.T) {
+	body := []byte(`{"event":"created"}`)
+	var signed bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		signed = req.Header.Get(SignatureHeader) == Sign("shh", req.Header.Get(TimestampHeader), body)
+		if req.URL.Path == "/redirect" {
+			http.Redirect(w, req, "/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	client := NewHTTPClient(time.Second, true)
+
+	status, err := Send(context.Background(), client, Delivery{ID: 1, URL: server.URL, Body: body}, "shh")
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Send: status=%d err=%v", status, err)
+	}
+	if !signed {
+		t.Error("delivery signature does not verify")
+	}
+
+	status, err = Send(context.Background(), client, Delivery{ID: 2, URL: server.URL + "/redirect", Body: body}, "shh")
+	if err == nil || status != http.StatusFound {
+		t.Errorf("redirect: status=%d err=%v, want 302 not followed", status, err)
+	}
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+
+	_, err := Send(context.Background(), NewHTTPClient(time.Second, false), Delivery{URL: server.URL}, "shh")
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Send to loopback: err=%v, want ErrPrivateAddress", err)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://8.8.8.8/hook", nil},
+		{"http://127.0.0.1:8080/hook", ErrPrivateAddress},
+		{"http://10.0.0.5/hook", ErrPrivateAddress},
+		{"http://169.254.169.254/latest/meta-data", ErrPrivateAddress},
+		{"http://100.64.0.1/hook", ErrPrivateAddress},
+		{"http://[::1]/hook", ErrPrivateAddress},
+		{"http://[fe80::1]/hook", ErrPrivateAddress},
+	}
+	for _, tt := range tests {
+		if err := CheckURL(context.Background(), tt.url, false); !errors.Is(err, tt.want) {
+			t.Errorf("CheckURL(%s) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+	if err := CheckURL(context.Background(), "http://127.0.0.1/hook", true); err != nil {
+		t.Errorf("CheckURL with private addresses allowed = %v", err)
+	}
+	if err := CheckURL(context.Background(), "ftp://8.8.8.8/hook", false); err == nil {
+		t.Error("CheckURL accepted an ftp URL")
+	}
+}
+
+func TestDue(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "webhooks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var ids []uint64
+	for i := 0; i < 4; i++ {
+		d, err := s.AddDelivery(Delivery{SubscriptionID: "sub", EventID: "e"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, d.ID)
+	}
+	delivered, _ := s.Delivery(ids[1])
+	delivered.Status = StatusDelivered
+	waiting, _ := s.Delivery(ids[2])
+	waiting.NextAttemptAt = time.Now().Add(time.Hour)
+	for _, d := range []Delivery{delivered, waiting} {
+		if err := s.UpdateDelivery(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due := func(s *Store, at time.Time) []uint64 {
+		t.Helper()
+		deliveries, err := s.Due(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []uint64
+		for _, d := range deliveries {
+			got = append(got, d.ID)
+		}
+		return got
+	}
+	if got := due(s, time.Now()); len(got) != 2 || got[0] != ids[0] || got[1] != ids[3] {
+		t.Errorf("Due now = %v, want %d and %d", got, ids[0], ids[3])
+	}
+	if got := due(s, time.Now().Add(2*time.Hour)); len(got) != 3 || got[1] != ids[2] {
+		t.Errorf("Due in two hours = %v, want %d among them", got, ids[2])
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+
+	"procore-common/logs"
+	"procore-common/server"
+
+	"github.com/joho/godotenv"
+)
+
+// The gateway serves every log type from one router. Set EXTRA_PORTS=8081,8082,8083
+// to also answer on the per-service ports the frontends are configured with.
+func main() {
+	// Load environment variables; in k8s they come from the deployment instead
+	if err := godotenv.Load(".env"); err != nil {
+		log.Println("No .env file found, using process environment")
+	}
+
+	procoreCfg, err := logs.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := server.LoadConfig("8080",
+		"http://localhost:3000", // accident logs frontend
+		"http://localhost:3001", // equipment logs frontend
+		"http://localhost:3002", // call logs frontend
+	)
+	svc, err := logs.NewService(procoreCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	router := server.New(cfg, svc, logs.All...)
+
+	// Start server
+	log.Fatal(server.Run(router, cfg))
+}